@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"k8s_learning/internal/auth"
+)
+
+// runAPIKeyCommand handles `web apikey generate [flags]`, the key is printed once
+// and only its hash goes to the key file.
+func runAPIKeyCommand(args []string) error {
+	if len(args) == 0 || args[0] != "generate" {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("apikey: expect subcommand generate")
+	}
+	fs := flag.NewFlagSet("web apikey generate", flag.ContinueOnError)
+	id := fs.String("id", "", "id of the key, logged as the principal")
+	name := fs.String("name", "", "description of the key owner")
+	scopes := fs.String("scopes", "", "comma separated scopes, eg. notes:read,notes:write")
+	roles := fs.String("roles", "", "comma separated roles of the authz policy")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *id == "" {
+		return fmt.Errorf("apikey: -id is required")
+	}
+
+	key, err := auth.GenerateKey()
+	if err != nil {
+		return err
+	}
+	entry := auth.APIKey{ID: *id, Name: *name, Hash: auth.HashKey(key)}
+	if *scopes != "" {
+		entry.Scopes = strings.Split(*scopes, ",")
+	}
+	if *roles != "" {
+		entry.Roles = strings.Split(*roles, ",")
+	}
+	content, err := yaml.Marshal([]auth.APIKey{entry})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# api key, hand it to the client, it is not stored anywhere:\n# %s\n", key)
+	fmt.Printf("# entry to append under keys: of auth.api_keys.file\n%s", content)
+	return nil
+}
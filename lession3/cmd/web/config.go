@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"k8s_learning/internal/config"
+)
+
+// runConfigCommand handles `web config validate|print [flags]`,
+// the flags are the same as the ones of the web service.
+func runConfigCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "validate" && args[0] != "print") {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("config: expect subcommand validate or print")
+	}
+	cfg, err := config.Load("web config "+args[0], args[1:])
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "validate" {
+		fmt.Println("config is valid")
+		return nil
+	}
+	content, err := cfg.YAML()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(content)
+	return err
+}
@@ -1,28 +1,141 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"net/http"
+	"os"
 
-	"github.com/AfterShip/golang-common/http/server/gins/handlers"
-	"github.com/gin-gonic/gin"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/AfterShip/golang-common/http/server/health"
+	"github.com/AfterShip/golang-common/logger"
+	"go.uber.org/zap"
+
+	"k8s_learning/internal/auth"
+	"k8s_learning/internal/authz"
+	"k8s_learning/internal/chaos"
+	"k8s_learning/internal/config"
+	"k8s_learning/internal/healthz"
+	"k8s_learning/internal/lifecycle"
+	"k8s_learning/internal/metrics"
+	"k8s_learning/internal/tracing"
 )
 
+const usage = `usage:
+  web [flags]                    run the web service
+  web config validate [flags]    load and validate the config, then exit
+  web config print [flags]       print the effective config with secrets redacted
+  web manifests [flags]          print the Kubernetes manifests of the service
+  web apikey generate [-id id]   print a new api key and its entry for auth.api_keys.file
+
+run "web -h" to list the flags, every flag can also be set by env or the YAML file.
+`
+
 func main() {
-	devopsHttpServer := &http.Server{
-		Addr: fmt.Sprintf(":%d", 8080),
+	args := os.Args[1:]
+	var err error
+	switch {
+	case len(args) > 0 && args[0] == "config":
+		err = runConfigCommand(args[1:])
+	case len(args) > 0 && args[0] == "manifests":
+		err = runManifestsCommand(args[1:])
+	case len(args) > 0 && args[0] == "apikey":
+		err = runAPIKeyCommand(args[1:])
+	case len(args) > 0 && (args[0] == "help" || args[0] == "--help"):
+		fmt.Fprint(os.Stderr, usage)
+	default:
+		err = serve(args)
+	}
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "web:", err)
+		os.Exit(1)
 	}
+}
 
-	engine := gin.New()
-	engine.Use(gin.Recovery())
-	//debug info
-	//paths: /debug/requests、/debug/events、/debug/pprof
-	handlers.RegisterDebugHandler(engine)
+func serve(args []string) error {
+	cfg, err := config.Load("web", args)
+	if err != nil {
+		return err
+	}
+	zapLogger, err := logger.BuildZapLogger(cfg.Log)
+	if err != nil {
+		return err
+	}
+	logger.SetZapLogger(zapLogger)
+	logger.SetBeforeLogHook(auth.BeforeLogHook{Next: logger.DefaultBeforeLogHookImpl{}})
+	if err := tracing.SetEventsLogLevel(cfg.Events.LogLevel); err != nil {
+		return err
+	}
+	tracerOpts := []tracing.TracerOption{tracing.SampleRatio(cfg.Tracing.SampleRatio)}
+	if cfg.Tracing.Exporter == "stdout" {
+		tracerOpts = append(tracerOpts, tracing.Exporters(tracing.NewStdoutExporter()))
+	}
+	tracing.SetDefaultTracer(tracing.NewTracer(tracerOpts...))
+	gins.GlobalAPIErrorLoggerFunc = metrics.CountAPIErrors(gins.GlobalAPIErrorLoggerFunc)
 
-	//whoami
-	handlers.RegisterWhoamiHandler(engine.Group(""))
+	status := health.NewStatus(
+		health.DefaultStatus(cfg.Health.DefaultStatus),
+		health.AllowRemoteUpdate(cfg.Health.AllowRemoteUpdate),
+	)
+	checks := healthz.NewRegistry()
+	checks.Register(healthz.PingCheck, healthz.Probes(healthz.Livez, healthz.Readyz))
+	checks.Register(healthz.StatusCheck(status), healthz.Probes(healthz.Readyz, healthz.Startupz))
 
-	devopsHttpServer.Handler = engine
+	var injector *chaos.Injector
+	if cfg.Chaos.Enabled {
+		injector = chaos.NewInjector(chaos.MaxTTL(cfg.Chaos.MaxTTL))
+		checks.Register(injector.ProbeCheck(healthz.Readyz), healthz.Probes(healthz.Readyz))
+		checks.Register(injector.ProbeCheck(healthz.Livez), healthz.Probes(healthz.Livez))
+	}
 
-	devopsHttpServer.ListenAndServe()
+	manager := lifecycle.New(
+		lifecycle.HealthStatus(status),
+		lifecycle.OnlineWhenServing(cfg.Health.OnlineWhenServing),
+		lifecycle.PropagationDelay(cfg.Shutdown.PropagationDelay),
+		lifecycle.ShutdownTimeout(cfg.Shutdown.Timeout),
+	)
+
+	var authorizer *authz.Authorizer
+	if cfg.Authz.Enabled {
+		authorizer = authz.NewAuthorizer(&authz.Policy{})
+		reloader := authz.NewReloader(authorizer, cfg.Authz.PolicyFile, cfg.Authz.ReloadInterval)
+		if _, err := reloader.Reload(context.Background()); err != nil {
+			return err
+		}
+		manager.Register(reloader)
+	}
+
+	apiEngine, err := newAPIEngine(cfg, authorizer, injector)
+	if err != nil {
+		return err
+	}
+	apiHttpServer := &http.Server{
+		Addr:              cfg.Server.Addr(),
+		Handler:           apiEngine,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
+	devopsHttpServer := &http.Server{
+		Addr:              cfg.Admin.Addr(),
+		Handler:           newAdminEngine(cfg, status, checks, authorizer, injector, apiEngine.Routes()),
+		ReadHeaderTimeout: cfg.Admin.ReadHeaderTimeout,
+		IdleTimeout:       cfg.Admin.IdleTimeout,
+	}
+
+	manager.AddServer("api", apiHttpServer)
+	manager.AddServer("devops", devopsHttpServer)
+
+	if err := manager.Run(context.Background()); err != nil {
+		logger.Error(context.Background(), "web exited with error", zap.Error(err))
+		return err
+	}
+	return nil
 }
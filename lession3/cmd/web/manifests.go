@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/AfterShip/golang-common/whoami"
+
+	"k8s_learning/internal/config"
+	"k8s_learning/internal/manifests"
+)
+
+// runManifestsCommand handles `web manifests [flags]`, it accepts the config flags too
+// so the rendered ports and probes match the listeners.
+func runManifestsCommand(args []string) error {
+	fs := flag.NewFlagSet("web manifests", flag.ContinueOnError)
+	opts := manifests.Options{}
+	fs.StringVar(&opts.Name, "name", "k8slearning", "name of every object and value of the app label")
+	fs.StringVar(&opts.Namespace, "namespace", "default", "namespace of every object")
+	fs.StringVar(&opts.Image, "image", "chensunny/k8slearning", "image repository")
+	fs.StringVar(&opts.Tag, "tag", "", "image tag, default whoami version or the content of -version-file")
+	versionFile := fs.String("version-file", "version", "file holding the version, used when -tag is empty and no version is linked in")
+	fs.IntVar(&opts.Replicas, "replicas", 2, "replicas of the Deployment, used only with -max-replicas 0")
+	fs.StringVar(&opts.CPURequest, "cpu-request", "100m", "container cpu request")
+	fs.StringVar(&opts.CPULimit, "cpu-limit", "500m", "container cpu limit")
+	fs.StringVar(&opts.MemoryRequest, "memory-request", "64Mi", "container memory request")
+	fs.StringVar(&opts.MemoryLimit, "memory-limit", "256Mi", "container memory limit")
+	fs.StringVar(&opts.ServiceType, "service-type", "LoadBalancer", "type of the Service")
+	fs.IntVar(&opts.ServicePort, "service-port", 80, "port of the Service, targets the http container port")
+	fs.IntVar(&opts.MinReplicas, "min-replicas", 2, "HPA min replicas")
+	fs.IntVar(&opts.MaxReplicas, "max-replicas", 5, "HPA max replicas, 0 renders no HPA")
+	fs.IntVar(&opts.TargetCPUUtilization, "cpu-utilization", 70, "HPA target average cpu utilization in percent")
+	fs.IntVar(&opts.PDBMinAvailable, "pdb-min-available", 1, "PodDisruptionBudget min available pods")
+
+	cfg, err := config.LoadWithFlagSet(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if opts.Tag == "" {
+		opts.Tag = whoami.Version()
+	}
+	if opts.Tag == "" {
+		content, err := ioutil.ReadFile(*versionFile)
+		if err != nil {
+			return fmt.Errorf("manifests: no -tag given and %w", err)
+		}
+		opts.Tag = strings.TrimSpace(string(content))
+	}
+	return manifests.Render(os.Stdout, opts, cfg)
+}
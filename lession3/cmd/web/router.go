@@ -0,0 +1,246 @@
+package main
+
+import (
+	"github.com/AfterShip/golang-common/http/server/gins/handlers"
+	"github.com/AfterShip/golang-common/http/server/health"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/auth"
+	"k8s_learning/internal/authz"
+	"k8s_learning/internal/chaos"
+	"k8s_learning/internal/config"
+	"k8s_learning/internal/healthz"
+	"k8s_learning/internal/http/client"
+	"k8s_learning/internal/idempotency"
+	"k8s_learning/internal/metrics"
+	"k8s_learning/internal/middleware"
+	"k8s_learning/internal/notes"
+	"k8s_learning/internal/pagination"
+	"k8s_learning/internal/podinfo"
+	"k8s_learning/internal/ratelimit"
+)
+
+// newAPIEngine builds the public engine exposed by the Service, it only carries API routes.
+// authorizer is nil when authz is disabled.
+func newAPIEngine(cfg *config.Config, authorizer *authz.Authorizer, injector *chaos.Injector) (*gin.Engine, error) {
+	authenticateAPIKey, err := apiKeyAuth(cfg)
+	if err != nil {
+		return nil, err
+	}
+	authenticateJWT, err := jwtAuth(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	engine := gin.New()
+	engine.Use(
+		middleware.TraceContext(),
+		middleware.RequestTrace(),
+		accessLog(cfg),
+		metrics.Middleware(),
+		middleware.Recovery(),
+		middleware.InboundDeadline(cfg.Timeout.MaxInbound),
+		authenticateAPIKey,
+		authenticateJWT,
+		// after authentication, so that clients are keyed by the verified principal
+		rateLimit(cfg),
+	)
+	if authorizer != nil {
+		engine.Use(authorizer.Middleware())
+	}
+	engine.Use(idempotencyKey(cfg))
+	handlers.RegisterNotFoundHandlers(engine)
+
+	//notes, paths: /v1/notes、/v1/notes/:id
+	paginationBinder, err := newPaginationBinder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	noteRepo := notes.NewMemoryRepository()
+	noteOpts := append(noteScopes(cfg), notes.Pagination(paginationBinder))
+	v1 := engine.Group("/v1", middleware.Timeout(cfg.Timeout.Budget("/v1")))
+	if injector != nil {
+		// inside the deadline, an injected latency behaves like a slow handler
+		v1.Use(injector.Middleware())
+	}
+	if err := notes.RegisterHandlers(v1, noteRepo, noteOpts...); err != nil {
+		return nil, err
+	}
+	if authorizer != nil {
+		authorizer.RegisterOwner("/v1/notes/:id", notes.OwnerResolver(noteRepo))
+	}
+
+	return engine, nil
+}
+
+// newAdminEngine builds the engine of the admin listener, reachable only inside the cluster
+// (kubectl port-forward, probes, scrapers).
+func newAdminEngine(cfg *config.Config, status *health.Status, checks *healthz.Registry,
+	authorizer *authz.Authorizer, injector *chaos.Injector, apiRoutes gin.RoutesInfo) *gin.Engine {
+	engine := gin.New()
+	engine.Use(accessLog(cfg), middleware.Recovery())
+	handlers.RegisterNotFoundHandlers(engine)
+
+	//debug info
+	//paths: /debug/requests、/debug/events、/debug/pprof
+	handlers.RegisterDebugHandler(engine)
+
+	//health status, path: /devops/status
+	handlers.RegisterHealthHandler(engine, status)
+	//probes, paths: /livez、/readyz、/startupz
+	healthz.RegisterHandlers(engine, checks)
+
+	//whoami, with runtime and Downward API info
+	podinfo.RegisterWhoamiHandler(engine.Group(""), cfg.Pod.InfoDir, injector)
+
+	//prometheus scrape, path: /metrics
+	metrics.RegisterHandler(engine)
+
+	//authz explain, path: /devops/authz/explain
+	if authorizer != nil {
+		authz.RegisterExplainHandler(engine, authorizer, apiRoutes)
+	}
+
+	//outbound circuit breakers, path: /devops/circuits
+	client.RegisterCircuitHandler(engine)
+
+	//fault injection, paths: /chaos、/chaos/:id
+	if injector != nil {
+		chaos.RegisterHandlers(engine, injector)
+	}
+
+	return engine
+}
+
+// accessLog is a no-op when the access log is disabled.
+func accessLog(cfg *config.Config) gin.HandlerFunc {
+	if !cfg.AccessLog.Enabled {
+		return func(c *gin.Context) {}
+	}
+	return middleware.AccessLog(
+		middleware.SampleRate(cfg.AccessLog.SampleRate),
+		middleware.RouteSampleRates(cfg.AccessLog.RouteSampleRates),
+		middleware.SkipRoutes(cfg.AccessLog.SkipRoutes...),
+		middleware.LogHeaders(cfg.AccessLog.Headers),
+	)
+}
+
+// rateLimit is a no-op when rate limiting is disabled.
+func rateLimit(cfg *config.Config) gin.HandlerFunc {
+	if !cfg.RateLimit.Enabled {
+		return func(c *gin.Context) {}
+	}
+	opts := []ratelimit.Option{
+		ratelimit.DefaultPolicy(rateLimitPolicy("default", cfg.RateLimit.Default)),
+	}
+	for route, policy := range cfg.RateLimit.Routes {
+		if policy.Key == "" {
+			policy.Key = cfg.RateLimit.Default.Key
+		}
+		opts = append(opts, ratelimit.RoutePolicy(route, rateLimitPolicy(route, policy)))
+	}
+	return ratelimit.Middleware(ratelimit.NewMemoryStore(ratelimit.MaxKeys(cfg.RateLimit.MaxKeys)), opts...)
+}
+
+func rateLimitPolicy(name string, p config.RateLimitPolicy) ratelimit.Policy {
+	policy := ratelimit.Policy{Name: name, Key: ratelimit.ByIP}
+	if p.Key == "principal" {
+		policy.Key = ratelimit.ByPrincipal
+	}
+	switch p.Algorithm {
+	case "token_bucket":
+		policy.Algorithm = ratelimit.TokenBucket{Rate: p.Rate, Burst: p.Burst}
+	case "sliding_window":
+		policy.Algorithm = ratelimit.SlidingWindow{Limit: p.Limit, Window: p.Window}
+	}
+	return policy
+}
+
+// apiKeyAuth is a no-op when api keys are disabled, requests are then all anonymous.
+func apiKeyAuth(cfg *config.Config) (gin.HandlerFunc, error) {
+	if !cfg.Auth.APIKeys.Enabled {
+		return func(c *gin.Context) {}, nil
+	}
+	store, err := auth.NewFileKeyStore(cfg.Auth.APIKeys.File)
+	if err != nil {
+		return nil, err
+	}
+	opts := []auth.APIKeyOption{auth.APIKeyHeaders(cfg.Auth.APIKeys.Headers...)}
+	if !cfg.Auth.APIKeys.Required {
+		opts = append(opts, auth.Optional())
+	}
+	if cfg.Auth.JWT.Enabled {
+		// the token is checked by jwtAuth, which runs next
+		opts = append(opts, auth.BearerFallback())
+	}
+	return auth.APIKeyAuth(store, opts...), nil
+}
+
+// jwtAuth is a no-op when bearer tokens are disabled.
+func jwtAuth(cfg *config.Config) (gin.HandlerFunc, error) {
+	jwt := cfg.Auth.JWT
+	if !jwt.Enabled {
+		return func(c *gin.Context) {}, nil
+	}
+	var keys auth.KeySource
+	switch {
+	case jwt.KeyFile != "":
+		fileKeys, err := auth.LoadKeyFile(jwt.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = fileKeys
+	case jwt.JWKSURL != "":
+		keys = auth.NewJWKSKeySource(jwt.JWKSURL, auth.JWKSRefreshInterval(jwt.JWKSRefreshInterval))
+	default:
+		keys = auth.HMACKeySource([]byte(jwt.HMACSecret))
+	}
+	verifier := auth.NewVerifier(keys,
+		auth.Issuer(jwt.Issuer),
+		auth.Audience(jwt.Audience),
+		auth.ClockSkew(jwt.ClockSkew),
+		auth.RequiredClaims(jwt.RequiredClaims...),
+		auth.Algorithms(jwt.Algorithms...),
+	)
+	var opts []auth.JWTOption
+	if !jwt.Required {
+		opts = append(opts, auth.JWTOptional())
+	}
+	return auth.JWTAuth(verifier, opts...), nil
+}
+
+// idempotencyKey is a no-op when idempotency is disabled, it runs after authentication to scope keys by principal.
+func idempotencyKey(cfg *config.Config) gin.HandlerFunc {
+	if !cfg.Idempotency.Enabled {
+		return func(c *gin.Context) {}
+	}
+	store := idempotency.NewMemoryStore(idempotency.MaxKeys(cfg.Idempotency.MaxKeys))
+	return idempotency.Middleware(store,
+		idempotency.TTL(cfg.Idempotency.TTL),
+		idempotency.LockTimeout(cfg.Idempotency.LockTimeout),
+		idempotency.MaxRequestBytes(cfg.Idempotency.MaxRequestBytes),
+	)
+}
+
+// newPaginationBinder builds the binder shared by the list endpoints.
+func newPaginationBinder(cfg *config.Config) (*pagination.Binder, error) {
+	codec, err := pagination.NewCodec([]byte(cfg.Pagination.CursorSecret))
+	if err != nil {
+		return nil, err
+	}
+	return pagination.NewBinder(codec,
+		pagination.DefaultLimit(cfg.Pagination.DefaultLimit),
+		pagination.MaxLimit(cfg.Pagination.MaxLimit),
+	), nil
+}
+
+// noteScopes requires notes:read and notes:write once callers can authenticate.
+func noteScopes(cfg *config.Config) []notes.Option {
+	if !cfg.Auth.APIKeys.Enabled && !cfg.Auth.JWT.Enabled {
+		return nil
+	}
+	return []notes.Option{
+		notes.ReadMiddleware(auth.RequireScopes("notes:read")),
+		notes.WriteMiddleware(auth.RequireScopes("notes:write")),
+	}
+}
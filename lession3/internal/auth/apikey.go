@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultAPIKeyHeaders are the api key headers of security.SensitiveHeaderKeys, in lookup order.
+var DefaultAPIKeyHeaders = []string{"am-api-key", "aftership-api-key", "automizely-api-key"}
+
+// ErrKeyNotFound is returned by a KeyStore for an unknown hash.
+var ErrKeyNotFound = stderrors.New("auth: api key not found")
+
+// APIKey is a key at rest, only the sha256 of the key is kept.
+type APIKey struct {
+	ID        string    `yaml:"id"`
+	Name      string    `yaml:"name,omitempty"`
+	Hash      string    `yaml:"hash"`
+	Scopes    []string  `yaml:"scopes,omitempty"`
+	Roles     []string  `yaml:"roles,omitempty"`
+	ExpiresAt time.Time `yaml:"expires_at,omitempty"`
+	Disabled  bool      `yaml:"disabled,omitempty"`
+}
+
+// KeyStore finds a key by the HashKey of the presented key.
+type KeyStore interface {
+	Lookup(ctx context.Context, hash string) (*APIKey, error)
+}
+
+// HashKey is the hex sha256 of key, keys are random so no salt or slow hash is needed.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateKey returns a random 256 bits key, hex encoded.
+func GenerateKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// MemoryKeyStore keeps the keys in a map, eg. for tests or keys built at startup.
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey
+}
+
+func NewMemoryKeyStore(keys ...APIKey) *MemoryKeyStore {
+	s := &MemoryKeyStore{keys: make(map[string]*APIKey, len(keys))}
+	for _, key := range keys {
+		s.Add(key)
+	}
+	return s
+}
+
+func (s *MemoryKeyStore) Add(key APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.Hash] = &key
+}
+
+func (s *MemoryKeyStore) Remove(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, hash)
+}
+
+func (s *MemoryKeyStore) Lookup(_ context.Context, hash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[hash]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// FileKeyStore loads the keys from a YAML file, usually a mounted Secret:
+//
+//	keys:
+//	  - id: ci
+//	    hash: <sha256 hex of the key>
+//	    scopes: [notes:read]
+type FileKeyStore struct {
+	path string
+	mu   sync.RWMutex
+	keys *MemoryKeyStore
+}
+
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload replaces the keys by the content of the file, the old keys stay when it fails.
+func (s *FileKeyStore) Reload() error {
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("auth: read api keys: %w", err)
+	}
+	var file struct {
+		Keys []APIKey `yaml:"keys"`
+	}
+	if err := yaml.UnmarshalStrict(content, &file); err != nil {
+		return fmt.Errorf("auth: parse api keys %s: %w", s.path, err)
+	}
+	keys := NewMemoryKeyStore()
+	for i, key := range file.Keys {
+		if key.ID == "" || len(key.Hash) != sha256.Size*2 {
+			return fmt.Errorf("auth: api key #%d of %s needs an id and a sha256 hex hash", i, s.path)
+		}
+		keys.Add(key)
+	}
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FileKeyStore) Lookup(ctx context.Context, hash string) (*APIKey, error) {
+	s.mu.RLock()
+	keys := s.keys
+	s.mu.RUnlock()
+	return keys.Lookup(ctx, hash)
+}
+
+type APIKeyOption func(conf *apiKeyConf)
+
+type apiKeyConf struct {
+	headers        []string
+	optional       bool
+	bearerFallback bool
+}
+
+// APIKeyHeaders replaces DefaultAPIKeyHeaders.
+func APIKeyHeaders(headers ...string) APIKeyOption {
+	return func(conf *apiKeyConf) {
+		conf.headers = headers
+	}
+}
+
+// Optional lets requests without key through anonymously, routes then use RequireScopes.
+// A presented key is still checked.
+func Optional() APIKeyOption {
+	return func(conf *apiKeyConf) {
+		conf.optional = true
+	}
+}
+
+// BearerFallback passes requests without key but with a bearer token on to JWTAuth,
+// which must follow and checks the token. Without it a required key rejects token callers.
+func BearerFallback() APIKeyOption {
+	return func(conf *apiKeyConf) {
+		conf.bearerFallback = true
+	}
+}
+
+// APIKeyAuth authenticates the key of the request header against store:
+// a missing key is 40100, an unknown one 40102, a disabled one 40101 and an expired one 40103.
+func APIKeyAuth(store KeyStore, opts ...APIKeyOption) gin.HandlerFunc {
+	conf := &apiKeyConf{headers: DefaultAPIKeyHeaders}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return func(c *gin.Context) {
+		var presented string
+		for _, header := range conf.headers {
+			if presented = c.GetHeader(header); presented != "" {
+				break
+			}
+		}
+		if presented == "" {
+			if conf.optional || conf.bearerFallback && bearerToken(c.GetHeader("Authorization")) != "" {
+				c.Next()
+				return
+			}
+			abort(c, errors.ErrUnauthorized)
+			return
+		}
+
+		key, err := store.Lookup(c.Request.Context(), HashKey(presented))
+		switch {
+		case stderrors.Is(err, ErrKeyNotFound):
+			abort(c, errors.ErrInvalidToken, errors.Field("auth_method", MethodAPIKey))
+			return
+		case err != nil:
+			abort(c, errors.ErrUnavailable, errors.Cause(err), errors.Field("auth_method", MethodAPIKey))
+			return
+		case key.Disabled:
+			abort(c, errors.ErrInvalidPrivilege, errors.Field("api_key_id", key.ID))
+			return
+		case !key.ExpiresAt.IsZero() && time.Now().After(key.ExpiresAt):
+			abort(c, errors.ErrTokenExpired, errors.Field("api_key_id", key.ID))
+			return
+		}
+
+		SetPrincipal(c, &Principal{
+			Subject: key.ID,
+			Name:    key.Name,
+			Method:  MethodAPIKey,
+			Scopes:  key.Scopes,
+			Roles:   key.Roles,
+		})
+		c.Next()
+	}
+}
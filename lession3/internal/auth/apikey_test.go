@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve runs req through handlers and returns the status, the meta code and the principal.
+func serve(t *testing.T, req *http.Request, handlers ...gin.HandlerFunc) (int, int, *Principal) {
+	t.Helper()
+	var principal *Principal
+	engine := gin.New()
+	engine.Use(handlers...)
+	engine.GET("/v1", func(c *gin.Context) {
+		principal, _ = PrincipalFromContext(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"meta": gin.H{"code": 20000}})
+	})
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	var body struct {
+		Meta struct {
+			Code int `json:"code"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q: %v", w.Body, err)
+	}
+	return w.Code, body.Meta.Code, principal
+}
+
+type failingKeyStore struct{}
+
+func (failingKeyStore) Lookup(context.Context, string) (*APIKey, error) {
+	return nil, stderrors.New("store down")
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	store := NewMemoryKeyStore(
+		APIKey{ID: "ci", Hash: HashKey("ci-key"), Scopes: []string{"notes:read"}, Roles: []string{"reader"}},
+		APIKey{ID: "old", Hash: HashKey("disabled-key"), Disabled: true},
+		APIKey{ID: "temp", Hash: HashKey("expired-key"), ExpiresAt: time.Now().Add(-time.Minute)},
+		APIKey{ID: "later", Hash: HashKey("expiring-key"), ExpiresAt: time.Now().Add(time.Hour)},
+	)
+	tests := []struct {
+		name          string
+		store         KeyStore
+		opts          []APIKeyOption
+		headers       map[string]string
+		wantStatus    int
+		wantCode      int
+		wantPrincipal string
+	}{
+		{name: "missing", wantStatus: http.StatusUnauthorized, wantCode: 40100},
+		{name: "unknown", headers: map[string]string{"am-api-key": "other"}, wantStatus: http.StatusUnauthorized, wantCode: 40102},
+		{name: "disabled", headers: map[string]string{"am-api-key": "disabled-key"}, wantStatus: http.StatusUnauthorized, wantCode: 40101},
+		{name: "expired", headers: map[string]string{"am-api-key": "expired-key"}, wantStatus: http.StatusUnauthorized, wantCode: 40103},
+		{name: "not expired yet", headers: map[string]string{"am-api-key": "expiring-key"}, wantStatus: http.StatusOK, wantCode: 20000, wantPrincipal: "later"},
+		{name: "valid", headers: map[string]string{"am-api-key": "ci-key"}, wantStatus: http.StatusOK, wantCode: 20000, wantPrincipal: "ci"},
+		{name: "fallback header", headers: map[string]string{"automizely-api-key": "ci-key"}, wantStatus: http.StatusOK, wantCode: 20000, wantPrincipal: "ci"},
+		{
+			name:       "header not configured",
+			opts:       []APIKeyOption{APIKeyHeaders("x-api-key")},
+			headers:    map[string]string{"am-api-key": "ci-key"},
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   40100,
+		},
+		{
+			name:          "configured header",
+			opts:          []APIKeyOption{APIKeyHeaders("x-api-key")},
+			headers:       map[string]string{"x-api-key": "ci-key"},
+			wantStatus:    http.StatusOK,
+			wantCode:      20000,
+			wantPrincipal: "ci",
+		},
+		{name: "optional anonymous", opts: []APIKeyOption{Optional()}, wantStatus: http.StatusOK, wantCode: 20000},
+		{
+			name:       "optional still checks a presented key",
+			opts:       []APIKeyOption{Optional()},
+			headers:    map[string]string{"am-api-key": "other"},
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   40102,
+		},
+		{
+			name:       "bearer passed on",
+			opts:       []APIKeyOption{BearerFallback()},
+			headers:    map[string]string{"Authorization": "Bearer token"},
+			wantStatus: http.StatusOK,
+			wantCode:   20000,
+		},
+		{
+			name:       "bearer rejected without fallback",
+			headers:    map[string]string{"Authorization": "Bearer token"},
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   40100,
+		},
+		{
+			name:       "basic auth not a bearer",
+			opts:       []APIKeyOption{BearerFallback()},
+			headers:    map[string]string{"Authorization": "Basic dXNlcjpwYXNz"},
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   40100,
+		},
+		{
+			name:       "store unavailable",
+			store:      failingKeyStore{},
+			headers:    map[string]string{"am-api-key": "ci-key"},
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   50300,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := tt.store
+			if keys == nil {
+				keys = store
+			}
+			req := httptest.NewRequest(http.MethodGet, "/v1", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			status, code, principal := serve(t, req, APIKeyAuth(keys, tt.opts...))
+			if status != tt.wantStatus || code != tt.wantCode {
+				t.Fatalf("status %d meta code %d, want %d %d", status, code, tt.wantStatus, tt.wantCode)
+			}
+			var subject string
+			if principal != nil {
+				subject = principal.Subject
+				if principal.Method != MethodAPIKey {
+					t.Errorf("Method = %q, want %q", principal.Method, MethodAPIKey)
+				}
+			}
+			if subject != tt.wantPrincipal {
+				t.Errorf("principal = %q, want %q", subject, tt.wantPrincipal)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuthRequiredWithJWT(t *testing.T) {
+	now := time.Now().Unix()
+	token := signHS256(t, testSecret, map[string]interface{}{"alg": HS256, "typ": "JWT"},
+		map[string]interface{}{"sub": "user-1", "exp": now + 60, "iat": now})
+	keys := NewMemoryKeyStore(APIKey{ID: "ci", Hash: HashKey("ci-key")})
+	handlers := []gin.HandlerFunc{
+		APIKeyAuth(keys, BearerFallback()),
+		JWTAuth(NewVerifier(HMACKeySource(testSecret)), JWTOptional()),
+	}
+
+	tests := []struct {
+		name          string
+		headers       map[string]string
+		wantStatus    int
+		wantPrincipal string
+	}{
+		{name: "key", headers: map[string]string{"am-api-key": "ci-key"}, wantStatus: http.StatusOK, wantPrincipal: "ci"},
+		{name: "token", headers: map[string]string{"Authorization": "Bearer " + token}, wantStatus: http.StatusOK, wantPrincipal: "user-1"},
+		{name: "invalid token", headers: map[string]string{"Authorization": "Bearer " + token + "x"}, wantStatus: http.StatusUnauthorized},
+		{name: "neither", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			status, _, principal := serve(t, req, handlers...)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.wantPrincipal != "" && (principal == nil || principal.Subject != tt.wantPrincipal) {
+				t.Fatalf("principal = %+v, want %q", principal, tt.wantPrincipal)
+			}
+		})
+	}
+}
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("keys:\n  - id: ci\n    hash: " + HashKey("ci-key") + "\n    scopes: [notes:read]\n")
+
+	store, err := NewFileKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := store.Lookup(context.Background(), HashKey("ci-key"))
+	if err != nil || key.ID != "ci" {
+		t.Fatalf("Lookup(hash) = %+v, %v, want ci", key, err)
+	}
+	// only the hash is a lookup key, never the key itself
+	if _, err := store.Lookup(context.Background(), "ci-key"); !stderrors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Lookup(key) error = %v, want ErrKeyNotFound", err)
+	}
+
+	for _, content := range []string{
+		"keys:\n  - id: ci\n    hash: ci-key\n",
+		"keys:\n  - hash: " + HashKey("ci-key") + "\n",
+		"keys:\n  - id: ci\n    hash: " + HashKey("ci-key") + "\n    scope: [notes:read]\n",
+	} {
+		write(content)
+		if err := store.Reload(); err == nil {
+			t.Errorf("Reload() of %q = nil, want an error", content)
+		}
+	}
+	if _, err := store.Lookup(context.Background(), HashKey("ci-key")); err != nil {
+		t.Fatalf("Lookup() after failed reloads = %v, want the old keys kept", err)
+	}
+
+	write("keys:\n  - id: deploy\n    hash: " + HashKey("deploy-key") + "\n")
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(context.Background(), HashKey("ci-key")); !stderrors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Lookup(removed key) error = %v, want ErrKeyNotFound", err)
+	}
+	if key, err := store.Lookup(context.Background(), HashKey("deploy-key")); err != nil || key.ID != "deploy" {
+		t.Errorf("Lookup(new key) = %+v, %v, want deploy", key, err)
+	}
+}
+
+func TestMemoryKeyStore(t *testing.T) {
+	store := NewMemoryKeyStore(APIKey{ID: "ci", Hash: HashKey("ci-key")})
+	if key, err := store.Lookup(context.Background(), HashKey("ci-key")); err != nil || key.ID != "ci" {
+		t.Fatalf("Lookup() = %+v, %v, want ci", key, err)
+	}
+	store.Remove(HashKey("ci-key"))
+	if _, err := store.Lookup(context.Background(), HashKey("ci-key")); !stderrors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Lookup() after Remove = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  *Principal
+		scopes     []string
+		wantStatus int
+		wantCode   int
+	}{
+		{name: "anonymous", scopes: []string{"notes:read"}, wantStatus: http.StatusUnauthorized, wantCode: 40100},
+		{name: "granted", principal: &Principal{Scopes: []string{"notes:read"}}, scopes: []string{"notes:read"}, wantStatus: http.StatusOK, wantCode: 20000},
+		{name: "missing", principal: &Principal{Scopes: []string{"notes:read"}}, scopes: []string{"notes:read", "notes:write"}, wantStatus: http.StatusForbidden, wantCode: 40301},
+		{name: "resource wildcard", principal: &Principal{Scopes: []string{"notes:*"}}, scopes: []string{"notes:write"}, wantStatus: http.StatusOK, wantCode: 20000},
+		{name: "wildcard of another resource", principal: &Principal{Scopes: []string{"users:*"}}, scopes: []string{"notes:read"}, wantStatus: http.StatusForbidden, wantCode: 40301},
+		{name: "prefix is not a resource", principal: &Principal{Scopes: []string{"note:*"}}, scopes: []string{"notes:read"}, wantStatus: http.StatusForbidden, wantCode: 40301},
+		{name: "everything", principal: &Principal{Scopes: []string{"*"}}, scopes: []string{"notes:write"}, wantStatus: http.StatusOK, wantCode: 20000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticate := func(c *gin.Context) {
+				if tt.principal != nil {
+					SetPrincipal(c, tt.principal)
+				}
+			}
+			status, code, _ := serve(t, httptest.NewRequest(http.MethodGet, "/v1", nil), authenticate, RequireScopes(tt.scopes...))
+			if status != tt.wantStatus || code != tt.wantCode {
+				t.Fatalf("status %d meta code %d, want %d %d", status, code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
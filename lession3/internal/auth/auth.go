@@ -0,0 +1,131 @@
+// Package auth authenticates API callers into a Principal and checks its scopes,
+// failures are answered with the 401xx and 403xx APIErrors of golang-common errors.
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/model"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/AfterShip/golang-common/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ErrInsufficientScope is the 40301 answered when the principal lacks a scope required by the route.
+var ErrInsufficientScope = errors.NewAPIError(errors.CodeForbidden, errors.NewCode(1, "errors.insufficient_scope"))
+
+func init() {
+	unauthorized := model.GetStatusCodeDescription(40100)
+	model.AddStatusCodeDescriptions(map[int]model.StatusCodeDescription{
+		// 40104 and 40105 are defined by errors but have no description in model
+		40104: unauthorized,
+		40105: unauthorized,
+		40301: {
+			TypeName: "Forbidden",
+			Message:  "The credentials of the request do not carry the scope required by this action.",
+		},
+	})
+}
+
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	// Subject is the stable id of the caller, the key id or the token subject
+	Subject string   `json:"subject"`
+	Name    string   `json:"name,omitempty"`
+	Method  string   `json:"method"`
+	Scopes  []string `json:"scopes,omitempty"`
+	// Roles are granted by the credentials, the authz policy may bind more
+	Roles []string `json:"roles,omitempty"`
+}
+
+// HasScope tells whether one of the granted scopes covers scope,
+// "*" covers everything and "notes:*" covers "notes:read".
+func (p *Principal) HasScope(scope string) bool {
+	for _, granted := range p.Scopes {
+		if granted == "*" || granted == scope {
+			return true
+		}
+		if strings.HasSuffix(granted, ":*") && strings.HasPrefix(scope, strings.TrimSuffix(granted, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// ContextKeyPrincipal is the gin.Context key of the principal.
+const ContextKeyPrincipal = "auth_principal"
+
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// SetPrincipal puts the principal on the request context, for handlers and logs,
+// and on the gin.Context.
+func SetPrincipal(c *gin.Context, principal *Principal) {
+	c.Request = c.Request.WithContext(ContextWithPrincipal(c.Request.Context(), principal))
+	c.Set(ContextKeyPrincipal, principal)
+}
+
+// RequireScopes answers errors.ErrUnauthorized without principal
+// and ErrInsufficientScope when one of the scopes is missing.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		principal, ok := PrincipalFromContext(ctx)
+		if !ok {
+			abort(c, errors.ErrUnauthorized)
+			return
+		}
+		for _, scope := range scopes {
+			if !principal.HasScope(scope) {
+				abort(c, ErrInsufficientScope,
+					errors.Field("principal", principal.Subject),
+					errors.Field("required_scope", scope),
+				)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// abort answers basic, the scene stack points at the caller of abort.
+func abort(c *gin.Context, basic *errors.APIError, fields ...errors.SceneField) {
+	fields = append(fields, errors.Stack(errors.SmallerStacktrace(2, 1)))
+	gins.ResponseAPIErrorWithLogging(c, c.Request.Context(), errors.APIErrorWithScene(basic, fields...))
+}
+
+// BeforeLogHook adds the principal of the context to every log line, on top of next,
+// usually logger.DefaultBeforeLogHookImpl.
+type BeforeLogHook struct {
+	Next logger.BeforeLogHook
+}
+
+func (h BeforeLogHook) BeforeLog(ctx context.Context, msg string, fields []zap.Field) (context.Context, string, []zap.Field) {
+	ctx, msg, fields = h.Next.BeforeLog(ctx, msg, fields)
+	if ctx == nil {
+		return ctx, msg, fields
+	}
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		fields = append(fields,
+			zap.String("context_principal", principal.Subject),
+			zap.String("context_auth_method", principal.Method),
+		)
+	}
+	return ctx, msg, fields
+}
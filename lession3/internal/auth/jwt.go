@@ -0,0 +1,377 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// SupportedAlgorithms are the JWS algorithms a Verifier accepts by default, never "none".
+var SupportedAlgorithms = []string{HS256, RS256, ES256}
+
+var errSignature = stderrors.New("auth: invalid token signature")
+
+// Claims is the JWT payload, numbers are kept as json.Number.
+type Claims map[string]interface{}
+
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings reads a claim that is either a string or an array of strings, eg. aud.
+func (c Claims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Time reads a NumericDate claim, eg. exp.
+func (c Claims) Time(name string) (time.Time, bool) {
+	number, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)), true
+}
+
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// Scopes reads the space separated scope claim of RFC 8693, or the scp array.
+func (c Claims) Scopes() []string {
+	if scope := c.String("scope"); scope != "" {
+		return strings.Fields(scope)
+	}
+	return c.Strings("scp")
+}
+
+type claimsKey struct{}
+
+// ContextKeyClaims is the gin.Context key of the verified claims.
+const ContextKeyClaims = "auth_claims"
+
+func ContextWithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+type VerifierOption func(v *Verifier)
+
+// Issuer is the expected iss claim, not checked when empty.
+func Issuer(issuer string) VerifierOption {
+	return func(v *Verifier) {
+		v.issuer = issuer
+	}
+}
+
+// Audience must be one of the aud claim values, not checked when empty.
+func Audience(audience string) VerifierOption {
+	return func(v *Verifier) {
+		v.audience = audience
+	}
+}
+
+// ClockSkew is the tolerance on exp, nbf and iat, default 30s.
+func ClockSkew(skew time.Duration) VerifierOption {
+	return func(v *Verifier) {
+		v.skew = skew
+	}
+}
+
+// RequiredClaims must be present on top of sub, which is always required.
+func RequiredClaims(names ...string) VerifierOption {
+	return func(v *Verifier) {
+		v.required = append(v.required, names...)
+	}
+}
+
+// Algorithms restricts the accepted algorithms, default SupportedAlgorithms.
+func Algorithms(algorithms ...string) VerifierOption {
+	return func(v *Verifier) {
+		v.algorithms = make(map[string]bool, len(algorithms))
+		for _, alg := range algorithms {
+			v.algorithms[alg] = true
+		}
+	}
+}
+
+// Verifier checks compact JWS tokens against the keys of a KeySource.
+// Failures are APIErrors with the reserved 401 sub-codes:
+// a malformed token or a failed claim check is 40102, an expired token 40103,
+// a bad signature or unknown key 40104 and a token without sub 40105.
+type Verifier struct {
+	keys       KeySource
+	issuer     string
+	audience   string
+	skew       time.Duration
+	required   []string
+	algorithms map[string]bool
+}
+
+func NewVerifier(keys KeySource, opts ...VerifierOption) *Verifier {
+	v := &Verifier{keys: keys, skew: 30 * time.Second}
+	Algorithms(SupportedAlgorithms...)(v)
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, tokenError(errors.ErrInvalidToken, "token is not a compact JWS")
+	}
+	var header jwsHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, tokenError(errors.ErrInvalidToken, "malformed header", errors.Cause(err))
+	}
+	if !v.algorithms[header.Alg] {
+		return nil, tokenError(errors.ErrInvalidToken, "algorithm not accepted", errors.Field("alg", header.Alg))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, tokenError(errors.ErrInvalidToken, "malformed signature", errors.Cause(err))
+	}
+
+	key, err := v.keys.Key(ctx, header.Kid, header.Alg)
+	if stderrors.Is(err, ErrUnknownKey) {
+		return nil, tokenError(errors.ErrTokenVerifyingFailed, "unknown key", errors.Field("kid", header.Kid))
+	}
+	if err != nil {
+		return nil, tokenError(errors.ErrUnavailable, "keys unavailable", errors.Cause(err))
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, tokenError(errors.ErrTokenVerifyingFailed, "signature mismatch",
+			errors.Cause(err), errors.Field("kid", header.Kid), errors.Field("alg", header.Alg))
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, tokenError(errors.ErrInvalidToken, "malformed payload", errors.Cause(err))
+	}
+	if err := v.checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// timeClaims are the registered NumericDate claims, a token carrying one of another type is
+// invalid rather than never expiring.
+var timeClaims = []string{"exp", "nbf", "iat"}
+
+func (v *Verifier) checkClaims(claims Claims, now time.Time) error {
+	for _, name := range timeClaims {
+		if _, present := claims[name]; !present {
+			continue
+		}
+		if _, ok := claims.Time(name); !ok {
+			return tokenError(errors.ErrInvalidToken, "time claim not a number", errors.Field("claim", name))
+		}
+	}
+	if exp, ok := claims.Time("exp"); ok && now.After(exp.Add(v.skew)) {
+		return tokenError(errors.ErrTokenExpired, "token expired", errors.Field("exp", exp))
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(v.skew).Before(nbf) {
+		return tokenError(errors.ErrInvalidToken, "token not valid yet", errors.Field("nbf", nbf))
+	}
+	if iat, ok := claims.Time("iat"); ok && now.Add(v.skew).Before(iat) {
+		return tokenError(errors.ErrInvalidToken, "token issued in the future", errors.Field("iat", iat))
+	}
+	if v.issuer != "" && claims.String("iss") != v.issuer {
+		return tokenError(errors.ErrInvalidToken, "issuer mismatch", errors.Field("iss", claims.String("iss")))
+	}
+	if v.audience != "" && !contains(claims.Strings("aud"), v.audience) {
+		return tokenError(errors.ErrInvalidToken, "audience mismatch", errors.Field("aud", claims.Strings("aud")))
+	}
+	if claims.Subject() == "" {
+		return tokenError(errors.ErrTokenNotContainsUser, "sub claim missing")
+	}
+	for _, name := range v.required {
+		if _, ok := claims[name]; !ok {
+			return tokenError(errors.ErrInvalidToken, "required claim missing", errors.Field("claim", name))
+		}
+	}
+	return nil
+}
+
+func verifySignature(alg string, key interface{}, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case HS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrUnknownKey
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errSignature
+		}
+		return nil
+	case RS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnknownKey
+		}
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature)
+	case ES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return ErrUnknownKey
+		}
+		// r and s are concatenated, 32 bytes each
+		if len(signature) != 64 {
+			return errSignature
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return errSignature
+		}
+		return nil
+	}
+	return ErrUnknownKey
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	content, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// tokenError builds the APIError of a failed verification, the reason stays in the scene
+// so the client only sees the fuzzy message of the sub-code.
+func tokenError(basic *errors.APIError, reason string, fields ...errors.SceneField) *errors.APIError {
+	fields = append(fields, errors.Field("reason", reason), errors.Stack(errors.SmallerStacktrace(2, 1)))
+	return errors.APIErrorWithScene(basic, fields...)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type JWTOption func(conf *jwtConf)
+
+type jwtConf struct {
+	optional bool
+}
+
+// JWTOptional lets requests without bearer token through anonymously, like Optional of APIKeyAuth.
+func JWTOptional() JWTOption {
+	return func(conf *jwtConf) {
+		conf.optional = true
+	}
+}
+
+// JWTAuth authenticates the bearer token of the Authorization header, the claims and the
+// principal built from them are put on the request context.
+// Requests already authenticated, eg. by APIKeyAuth, are left alone.
+func JWTAuth(verifier *Verifier, opts ...JWTOption) gin.HandlerFunc {
+	conf := &jwtConf{}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return func(c *gin.Context) {
+		if _, ok := PrincipalFromContext(c.Request.Context()); ok {
+			c.Next()
+			return
+		}
+		token := bearerToken(c.GetHeader("Authorization"))
+		if token == "" {
+			if conf.optional {
+				c.Next()
+				return
+			}
+			abort(c, errors.ErrUnauthorized)
+			return
+		}
+
+		ctx := c.Request.Context()
+		claims, err := verifier.Verify(ctx, token)
+		if err != nil {
+			apiErr, ok := err.(*errors.APIError)
+			if !ok {
+				apiErr = errors.APIErrorWithScene(errors.ErrInvalidToken, errors.Cause(err))
+			}
+			gins.ResponseAPIErrorWithLogging(c, ctx, apiErr)
+			return
+		}
+
+		c.Request = c.Request.WithContext(ContextWithClaims(ctx, claims))
+		c.Set(ContextKeyClaims, claims)
+		SetPrincipal(c, &Principal{
+			Subject: claims.Subject(),
+			Name:    claims.String("name"),
+			Method:  MethodJWT,
+			Scopes:  claims.Scopes(),
+			Roles:   claims.Strings("roles"),
+		})
+		c.Next()
+	}
+}
+
+func bearerToken(authorization string) string {
+	const prefix = "bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(prefix):])
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+)
+
+var testSecret = []byte("test-secret")
+
+func segment(t *testing.T, v interface{}) string {
+	t.Helper()
+	content, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+// signHS256 builds a compact JWS of header and claims signed with secret.
+func signHS256(t *testing.T, secret []byte, header, claims map[string]interface{}) string {
+	t.Helper()
+	signed := segment(t, header) + "." + segment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifierVerify(t *testing.T) {
+	now := time.Now().Unix()
+	hs256 := map[string]interface{}{"alg": HS256, "typ": "JWT"}
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"sub": "user-1", "iss": "issuer", "aud": "web", "exp": now + 60, "iat": now}
+	}
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := valid()
+		claims[name] = value
+		return claims
+	}
+	without := func(name string) map[string]interface{} {
+		claims := valid()
+		delete(claims, name)
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr *errors.APIError
+	}{
+		{name: "valid", token: signHS256(t, testSecret, hs256, valid())},
+		{name: "not a compact jws", token: "a.b", wantErr: errors.ErrInvalidToken},
+		{name: "malformed header", token: "!!." + segment(t, valid()) + ".sig", wantErr: errors.ErrInvalidToken},
+		{
+			name:    "alg none",
+			token:   segment(t, map[string]interface{}{"alg": "none"}) + "." + segment(t, valid()) + ".",
+			wantErr: errors.ErrInvalidToken,
+		},
+		{name: "wrong secret", token: signHS256(t, []byte("other"), hs256, valid()), wantErr: errors.ErrTokenVerifyingFailed},
+		{
+			name:    "tampered payload",
+			token:   segment(t, hs256) + "." + segment(t, with("sub", "admin")) + "." + lastSegment(signHS256(t, testSecret, hs256, valid())),
+			wantErr: errors.ErrTokenVerifyingFailed,
+		},
+		{name: "expired", token: signHS256(t, testSecret, hs256, with("exp", now-3600)), wantErr: errors.ErrTokenExpired},
+		{name: "expired within skew", token: signHS256(t, testSecret, hs256, with("exp", now-10))},
+		{name: "not valid yet", token: signHS256(t, testSecret, hs256, with("nbf", now+3600)), wantErr: errors.ErrInvalidToken},
+		{name: "issued in the future", token: signHS256(t, testSecret, hs256, with("iat", now+3600)), wantErr: errors.ErrInvalidToken},
+		{name: "exp not a number", token: signHS256(t, testSecret, hs256, with("exp", "never")), wantErr: errors.ErrInvalidToken},
+		{name: "exp null", token: signHS256(t, testSecret, hs256, with("exp", nil)), wantErr: errors.ErrInvalidToken},
+		{name: "nbf not a number", token: signHS256(t, testSecret, hs256, with("nbf", true)), wantErr: errors.ErrInvalidToken},
+		{name: "iat not a number", token: signHS256(t, testSecret, hs256, with("iat", []int{1})), wantErr: errors.ErrInvalidToken},
+		{name: "without exp", token: signHS256(t, testSecret, hs256, without("exp"))},
+		{name: "issuer mismatch", token: signHS256(t, testSecret, hs256, with("iss", "other")), wantErr: errors.ErrInvalidToken},
+		{name: "audience mismatch", token: signHS256(t, testSecret, hs256, with("aud", []string{"a", "b"})), wantErr: errors.ErrInvalidToken},
+		{name: "audience in array", token: signHS256(t, testSecret, hs256, with("aud", []string{"a", "web"}))},
+		{name: "missing sub", token: signHS256(t, testSecret, hs256, without("sub")), wantErr: errors.ErrTokenNotContainsUser},
+		{name: "missing required claim", token: signHS256(t, testSecret, hs256, without("iat")), wantErr: errors.ErrInvalidToken},
+	}
+
+	verifier := NewVerifier(HMACKeySource(testSecret), Issuer("issuer"), Audience("web"), RequiredClaims("iat"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Verify() error = %v, want nil", err)
+				}
+				if claims.Subject() != "user-1" {
+					t.Errorf("Subject() = %q, want user-1", claims.Subject())
+				}
+				return
+			}
+			if !stderrors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifierAlgorithms(t *testing.T) {
+	token := signHS256(t, testSecret, map[string]interface{}{"alg": HS256}, map[string]interface{}{"sub": "user-1"})
+	verifier := NewVerifier(HMACKeySource(testSecret), Algorithms(RS256))
+	if _, err := verifier.Verify(context.Background(), token); !stderrors.Is(err, errors.ErrInvalidToken) {
+		t.Fatalf("Verify() error = %v, want %v", err, errors.ErrInvalidToken)
+	}
+}
+
+func TestVerifierKeysUnavailable(t *testing.T) {
+	token := signHS256(t, testSecret, map[string]interface{}{"alg": HS256}, map[string]interface{}{"sub": "user-1"})
+	verifier := NewVerifier(keySourceFunc(func(context.Context, string, string) (interface{}, error) {
+		return nil, stderrors.New("jwks down")
+	}))
+	if _, err := verifier.Verify(context.Background(), token); !stderrors.Is(err, errors.ErrUnavailable) {
+		t.Fatalf("Verify() error = %v, want %v", err, errors.ErrUnavailable)
+	}
+}
+
+type keySourceFunc func(ctx context.Context, kid, alg string) (interface{}, error)
+
+func (f keySourceFunc) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	return f(ctx, kid, alg)
+}
+
+func lastSegment(token string) string {
+	for i := len(token) - 1; i >= 0; i-- {
+		if token[i] == '.' {
+			return token[i+1:]
+		}
+	}
+	return token
+}
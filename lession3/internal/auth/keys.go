@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	stderrors "errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AfterShip/golang-common/logger"
+	"go.uber.org/zap"
+)
+
+// ErrUnknownKey is returned by a KeySource without key for the kid and alg of a token.
+var ErrUnknownKey = stderrors.New("auth: no key for the token")
+
+// KeySource gives the verification key of a token, []byte for HS256,
+// *rsa.PublicKey for RS256 and *ecdsa.PublicKey for ES256.
+type KeySource interface {
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+type verificationKey struct {
+	// alg restricts the key to one algorithm, empty accepts any algorithm of the key type
+	alg string
+	key interface{}
+}
+
+// keySet is keyed by kid, the "" key verifies the tokens whose kid is not listed.
+type keySet map[string]verificationKey
+
+func (s keySet) lookup(kid, alg string) (interface{}, error) {
+	key, ok := s[kid]
+	if !ok {
+		key, ok = s[""]
+	}
+	if !ok || (key.alg != "" && key.alg != alg) {
+		return nil, ErrUnknownKey
+	}
+	return key.key, nil
+}
+
+// StaticKeySource serves keys loaded once.
+type StaticKeySource struct {
+	keys keySet
+}
+
+func (s *StaticKeySource) Key(_ context.Context, kid, alg string) (interface{}, error) {
+	return s.keys.lookup(kid, alg)
+}
+
+// HMACKeySource verifies HS256 tokens with one shared secret.
+func HMACKeySource(secret []byte) *StaticKeySource {
+	return &StaticKeySource{keys: keySet{"": {alg: HS256, key: secret}}}
+}
+
+// LoadKeyFile reads a JWKS document, a PEM public key or certificate, or else an HMAC secret.
+func LoadKeyFile(path string) (*StaticKeySource, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: read key file: %w", err)
+	}
+	trimmed := bytes.TrimSpace(content)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		keys, err := parseJWKS(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("auth: parse jwks %s: %w", path, err)
+		}
+		return &StaticKeySource{keys: keys}, nil
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN")):
+		key, err := parsePEM(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("auth: parse pem %s: %w", path, err)
+		}
+		return &StaticKeySource{keys: keySet{"": {key: key}}}, nil
+	case len(trimmed) == 0:
+		return nil, fmt.Errorf("auth: key file %s is empty", path)
+	}
+	return HMACKeySource(trimmed), nil
+}
+
+func parsePEM(content []byte) (interface{}, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unsupported pem block %q, expect a public key or a certificate", block.Type)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// oct
+	K string `json:"k"`
+}
+
+// parseJWKS keeps the signature keys of the supported types, the others are skipped
+// so a provider adding a new key type does not break verification.
+func parseJWKS(content []byte) (keySet, error) {
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	keys := make(keySet, len(document.Keys))
+	for _, k := range document.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.key()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = verificationKey{alg: k.Alg, key: key}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no supported signature key")
+	}
+	return keys, nil
+}
+
+func (k jwk) key() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point not on curve P-256")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	content, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(content), nil
+}
+
+type JWKSOption func(s *JWKSKeySource)
+
+// JWKSRefreshInterval is how long the keys are cached, default 1h.
+func JWKSRefreshInterval(interval time.Duration) JWKSOption {
+	return func(s *JWKSKeySource) {
+		s.refreshInterval = interval
+	}
+}
+
+// JWKSMinRefreshInterval bounds the fetches triggered by unknown kids and failures, default 1m.
+func JWKSMinRefreshInterval(interval time.Duration) JWKSOption {
+	return func(s *JWKSKeySource) {
+		s.minRefreshInterval = interval
+	}
+}
+
+func JWKSHTTPClient(client *http.Client) JWKSOption {
+	return func(s *JWKSKeySource) {
+		s.client = client
+	}
+}
+
+// JWKSFetchTimeout bounds a fetch, default 5s.
+func JWKSFetchTimeout(timeout time.Duration) JWKSOption {
+	return func(s *JWKSKeySource) {
+		s.fetchTimeout = timeout
+	}
+}
+
+// JWKSKeySource fetches the keys from a JWKS URL lazily and caches them.
+// A token signed by a kid not cached yet triggers a fetch, which picks up rotated keys,
+// and a failed fetch keeps serving the cached keys.
+// One fetch runs at a time, on its own goroutine and deadline: callers whose key is cached
+// are answered at once, the others wait for the fetch or until their context is done,
+// which does not cancel the fetch.
+type JWKSKeySource struct {
+	url                string
+	client             *http.Client
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	fetchTimeout       time.Duration
+
+	mu        sync.Mutex
+	keys      keySet
+	fetchedAt time.Time
+	attempted time.Time
+	lastErr   error
+	// inflight is closed once the running fetch is done, nil without one
+	inflight chan struct{}
+}
+
+func NewJWKSKeySource(url string, opts ...JWKSOption) *JWKSKeySource {
+	s := &JWKSKeySource{
+		url:                url,
+		client:             &http.Client{},
+		refreshInterval:    time.Hour,
+		minRefreshInterval: time.Minute,
+		fetchTimeout:       5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *JWKSKeySource) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		_, known := s.keys[kid]
+		expired := s.keys == nil || now.Sub(s.fetchedAt) >= s.refreshInterval
+		if (expired || !known) && now.Sub(s.attempted) >= s.minRefreshInterval && s.inflight == nil {
+			s.inflight = make(chan struct{})
+			go s.refresh(s.inflight)
+		}
+		inflight := s.inflight
+		keys, lastErr := s.keys, s.lastErr
+		s.mu.Unlock()
+
+		// an expired but known key is served while the fetch runs
+		if known || inflight == nil {
+			if keys == nil {
+				return nil, lastErr
+			}
+			return keys.lookup(kid, alg)
+		}
+		select {
+		case <-inflight:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// refresh fetches the keys and closes done, detached from the request that triggered it.
+func (s *JWKSKeySource) refresh(done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.fetchTimeout)
+	defer cancel()
+	keys, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.attempted = now
+	if err == nil {
+		s.keys, s.fetchedAt, s.lastErr = keys, now, nil
+	} else {
+		s.lastErr = err
+		logger.Warn(ctx, "[WARNING] jwks fetch failed", zap.String("category", "auth"),
+			zap.String("jwks_url", s.url), zap.Bool("cached_keys", s.keys != nil), zap.Error(err))
+	}
+	s.inflight = nil
+	close(done)
+}
+
+func (s *JWKSKeySource) fetch(ctx context.Context) (keySet, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth: jwks %s answered %d", s.url, resp.StatusCode)
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(content)
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer serves an oct JWKS of kid after delay, counting the fetches.
+type jwksServer struct {
+	*httptest.Server
+	fetches int32
+	delay   int64
+	status  int32
+}
+
+func newJWKSServer(t *testing.T, kid string, delay time.Duration) *jwksServer {
+	t.Helper()
+	s := &jwksServer{delay: int64(delay), status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.fetches, 1)
+		time.Sleep(time.Duration(atomic.LoadInt64(&s.delay)))
+		if status := atomic.LoadInt32(&s.status); status != http.StatusOK {
+			w.WriteHeader(int(status))
+			return
+		}
+		fmt.Fprintf(w, `{"keys":[{"kty":"oct","kid":%q,"alg":"HS256","k":%q}]}`,
+			kid, base64.RawURLEncoding.EncodeToString(testSecret))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestJWKSKeySourceKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		kid     string
+		alg     string
+		status  int32
+		wantErr error
+	}{
+		{name: "known kid", kid: "k1", alg: HS256},
+		{name: "unknown kid", kid: "k2", alg: HS256, wantErr: ErrUnknownKey},
+		{name: "other alg", kid: "k1", alg: RS256, wantErr: ErrUnknownKey},
+		{name: "endpoint failing", kid: "k1", alg: HS256, status: http.StatusInternalServerError, wantErr: errAny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newJWKSServer(t, "k1", 0)
+			if tt.status != 0 {
+				server.status = tt.status
+			}
+			keys := NewJWKSKeySource(server.URL)
+			_, err := keys.Key(context.Background(), tt.kid, tt.alg)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Key() error = %v, want nil", err)
+			case tt.wantErr == errAny && err == nil:
+				t.Fatal("Key() error = nil, want an error")
+			case tt.wantErr != nil && tt.wantErr != errAny && !stderrors.Is(err, tt.wantErr):
+				t.Fatalf("Key() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+var errAny = stderrors.New("any error")
+
+func TestJWKSKeySourceSingleFetch(t *testing.T) {
+	server := newJWKSServer(t, "k1", 50*time.Millisecond)
+	keys := NewJWKSKeySource(server.URL)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keys.Key(context.Background(), "k1", HS256)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Key() error = %v", err)
+		}
+	}
+	if fetches := atomic.LoadInt32(&server.fetches); fetches != 1 {
+		t.Fatalf("fetches = %d, want 1", fetches)
+	}
+}
+
+// A canceled caller must neither cancel the fetch nor count as an attempt,
+// the next caller is served the fetched keys.
+func TestJWKSKeySourceCallerCanceled(t *testing.T) {
+	server := newJWKSServer(t, "k1", 100*time.Millisecond)
+	keys := NewJWKSKeySource(server.URL, JWKSMinRefreshInterval(time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := keys.Key(ctx, "k1", HS256); !stderrors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Key() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := keys.Key(context.Background(), "k1", HS256); err != nil {
+		t.Fatalf("Key() after a canceled caller error = %v, want nil", err)
+	}
+	if fetches := atomic.LoadInt32(&server.fetches); fetches != 1 {
+		t.Fatalf("fetches = %d, want 1", fetches)
+	}
+}
+
+// A slow refresh must not hold back the callers whose key is cached.
+func TestJWKSKeySourceServesCachedKeysWhileRefreshing(t *testing.T) {
+	server := newJWKSServer(t, "k1", 0)
+	keys := NewJWKSKeySource(server.URL, JWKSRefreshInterval(time.Nanosecond), JWKSMinRefreshInterval(0))
+	if _, err := keys.Key(context.Background(), "k1", HS256); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt64(&server.delay, int64(500*time.Millisecond))
+	start := time.Now()
+	if _, err := keys.Key(context.Background(), "k1", HS256); err != nil {
+		t.Fatalf("Key() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("Key() of a cached kid took %s while refreshing", elapsed)
+	}
+}
@@ -0,0 +1,192 @@
+package authz
+
+import (
+	"sync"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/model"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/auth"
+	"k8s_learning/internal/ginx"
+)
+
+var (
+	// ErrPermissionDenied is the 40302 answered when no role of the principal grants the route.
+	ErrPermissionDenied = errors.NewAPIError(errors.CodeForbidden, errors.NewCode(2, "errors.permission_denied"))
+	// ErrNotResourceOwner is the 40303 answered when only owner rules grant the route
+	// and the principal does not own the resource.
+	ErrNotResourceOwner = errors.NewAPIError(errors.CodeForbidden, errors.NewCode(3, "errors.not_resource_owner"))
+)
+
+func init() {
+	model.AddStatusCodeDescriptions(map[int]model.StatusCodeDescription{
+		40302: {
+			TypeName: "Forbidden",
+			Message:  "None of the roles of the credentials grants this action, see errors for the missing permission.",
+		},
+		40303: {
+			TypeName: "Forbidden",
+			Message:  "This action is only granted on the resources owned by the credentials.",
+		},
+	})
+}
+
+// OwnerResolver returns the subject owning the resource of a request, eg. by loading it by :id.
+// Its error is answered as is, so a missing resource stays a 404.
+type OwnerResolver func(c *gin.Context) (string, error)
+
+// Grant is a rule of a role matching the request.
+type Grant struct {
+	Role  string `json:"role"`
+	Rule  Rule   `json:"rule"`
+	Owner bool   `json:"owner,omitempty"`
+}
+
+// Decision explains the evaluation of a request.
+type Decision struct {
+	Allowed    bool     `json:"allowed"`
+	Permission string   `json:"permission"`
+	Subject    string   `json:"subject,omitempty"`
+	Roles      []string `json:"roles"`
+	Grants     []Grant  `json:"grants,omitempty"`
+	// OwnerRequired is set when only owner rules grant the request
+	OwnerRequired bool   `json:"owner_required,omitempty"`
+	Owner         string `json:"owner,omitempty"`
+	Reason        string `json:"reason"`
+}
+
+// Authorizer evaluates requests against the current policy, the policy can be swapped at any time.
+type Authorizer struct {
+	mu     sync.RWMutex
+	policy *Policy
+	owners map[string]OwnerResolver
+}
+
+func NewAuthorizer(policy *Policy) *Authorizer {
+	return &Authorizer{policy: policy, owners: make(map[string]OwnerResolver)}
+}
+
+func (a *Authorizer) Policy() *Policy {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.policy
+}
+
+func (a *Authorizer) SetPolicy(policy *Policy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policy = policy
+}
+
+// RegisterOwner sets the resolver of the owner rules of a route template,
+// owner rules of routes without resolver never grant.
+func (a *Authorizer) RegisterOwner(route string, resolver OwnerResolver) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.owners[route] = resolver
+}
+
+func (a *Authorizer) ownerResolver(route string) OwnerResolver {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.owners[route]
+}
+
+// Evaluate decides on method and route template for principal, nil for anonymous requests.
+// owner is only called when owner rules are the only grants, it may be nil when the owner is unknown.
+func (a *Authorizer) Evaluate(method, route string, principal *auth.Principal, owner func() (string, error)) (Decision, error) {
+	policy := a.Policy()
+	decision := Decision{
+		Permission: method + " " + route,
+		Roles:      policy.rolesOf(principal),
+	}
+	if principal != nil {
+		decision.Subject = principal.Subject
+	}
+
+	for _, role := range decision.Roles {
+		for _, rule := range policy.Roles[role] {
+			if rule.matches(method, route) {
+				decision.Grants = append(decision.Grants, Grant{Role: role, Rule: rule, Owner: rule.Owner})
+			}
+		}
+	}
+	for _, grant := range decision.Grants {
+		if !grant.Owner {
+			decision.Allowed = true
+			decision.Reason = "granted by role " + grant.Role
+			return decision, nil
+		}
+	}
+	if len(decision.Grants) == 0 {
+		decision.Reason = "no role grants " + decision.Permission
+		return decision, nil
+	}
+
+	decision.OwnerRequired = true
+	switch {
+	case principal == nil:
+		decision.Reason = "owner rules need an authenticated principal"
+	case owner == nil:
+		decision.Reason = "owner of the resource is unknown"
+	default:
+		resourceOwner, err := owner()
+		if err != nil {
+			return decision, err
+		}
+		decision.Owner = resourceOwner
+		if resourceOwner != "" && resourceOwner == principal.Subject {
+			decision.Allowed = true
+			decision.Reason = "granted by role " + decision.Grants[0].Role + " as owner of the resource"
+		} else {
+			decision.Reason = "only granted to the owner of the resource"
+		}
+	}
+	return decision, nil
+}
+
+// Middleware evaluates every matched route: anonymous requests that are denied get
+// errors.ErrUnauthorized, authenticated ones ErrPermissionDenied or ErrNotResourceOwner
+// with the missing permission in the response errors.
+func (a *Authorizer) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := ginx.Route(c)
+		if route == ginx.UnmatchedRoute {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		principal, _ := auth.PrincipalFromContext(ctx)
+
+		var owner func() (string, error)
+		if resolver := a.ownerResolver(route); resolver != nil {
+			owner = func() (string, error) {
+				return resolver(c)
+			}
+		}
+		decision, err := a.Evaluate(c.Request.Method, route, principal, owner)
+		if err != nil {
+			gins.ResponseError(c, ctx, err)
+			return
+		}
+		if decision.Allowed {
+			c.Next()
+			return
+		}
+
+		basic := ErrPermissionDenied
+		switch {
+		case principal == nil:
+			basic = errors.ErrUnauthorized
+		case decision.OwnerRequired:
+			basic = ErrNotResourceOwner
+		}
+		gins.ResponseAPIErrorWithLogging(c, ctx, errors.APIErrorWithScene(basic,
+			errors.Items(map[string]string{"permission": decision.Permission}),
+			errors.Field("roles", decision.Roles),
+			errors.Field("reason", decision.Reason),
+		))
+	}
+}
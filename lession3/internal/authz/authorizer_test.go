@@ -0,0 +1,291 @@
+package authz
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/auth"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+const testPolicy = `
+roles:
+  public:
+    - methods: [GET]
+      routes: [/v1/ping]
+  notes-reader:
+    - methods: [GET]
+      routes: ["/v1/notes*"]
+  notes-writer:
+    - methods: [POST, PATCH]
+      routes: [/v1/notes, /v1/notes/:id]
+  notes-owner:
+    - methods: [PATCH, DELETE]
+      routes: [/v1/notes/:id]
+      owner: true
+  admin:
+    - methods: ["*"]
+      routes: ["*"]
+bindings:
+  - subjects: [ops]
+    roles: [admin]
+authenticated_roles: [notes-owner]
+anonymous_roles: [public]
+`
+
+func newTestAuthorizer(t *testing.T) *Authorizer {
+	t.Helper()
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthorizer(policy)
+}
+
+func TestAuthorizerEvaluate(t *testing.T) {
+	authorizer := newTestAuthorizer(t)
+	ownedBy := func(subject string) func() (string, error) {
+		return func() (string, error) { return subject, nil }
+	}
+	notCalled := func() (string, error) {
+		t.Error("owner resolved although a role grants the route")
+		return "", nil
+	}
+
+	tests := []struct {
+		name              string
+		method            string
+		route             string
+		principal         *auth.Principal
+		owner             func() (string, error)
+		wantAllowed       bool
+		wantRoles         []string
+		wantOwnerRequired bool
+		wantReason        string
+	}{
+		{
+			name: "anonymous role", method: "GET", route: "/v1/ping",
+			wantAllowed: true, wantRoles: []string{"public"}, wantReason: "granted by role public",
+		},
+		{
+			name: "anonymous denied", method: "GET", route: "/v1/notes",
+			wantRoles: []string{"public"}, wantReason: "no role grants GET /v1/notes",
+		},
+		{
+			name: "anonymous and owner rules", method: "DELETE", route: "/v1/notes/:id",
+			wantRoles: []string{"public"}, wantReason: "no role grants DELETE /v1/notes/:id",
+		},
+		{
+			name: "role of the credentials", method: "GET", route: "/v1/notes/:id",
+			principal:   &auth.Principal{Subject: "alice", Roles: []string{"notes-reader"}},
+			owner:       notCalled,
+			wantAllowed: true, wantRoles: []string{"notes-owner", "notes-reader"}, wantReason: "granted by role notes-reader",
+		},
+		{
+			name: "method case", method: "get", route: "/v1/notes",
+			principal:   &auth.Principal{Subject: "alice", Roles: []string{"notes-reader"}},
+			wantAllowed: true, wantRoles: []string{"notes-owner", "notes-reader"}, wantReason: "granted by role notes-reader",
+		},
+		{
+			name: "authenticated roles only", method: "GET", route: "/v1/notes",
+			principal: &auth.Principal{Subject: "bob"},
+			wantRoles: []string{"notes-owner"}, wantReason: "no role grants GET /v1/notes",
+		},
+		{
+			name: "binding", method: "DELETE", route: "/v1/users/:id",
+			principal:   &auth.Principal{Subject: "ops"},
+			owner:       notCalled,
+			wantAllowed: true, wantRoles: []string{"admin", "notes-owner"}, wantReason: "granted by role admin",
+		},
+		{
+			name: "duplicate roles", method: "GET", route: "/v1/notes",
+			principal:   &auth.Principal{Subject: "ops", Roles: []string{"admin", "notes-owner"}},
+			wantAllowed: true, wantRoles: []string{"admin", "notes-owner"}, wantReason: "granted by role admin",
+		},
+		{
+			name: "non owner rule wins", method: "PATCH", route: "/v1/notes/:id",
+			principal:   &auth.Principal{Subject: "bob", Roles: []string{"notes-writer"}},
+			owner:       notCalled,
+			wantAllowed: true, wantRoles: []string{"notes-owner", "notes-writer"}, wantReason: "granted by role notes-writer",
+		},
+		{
+			name: "owner", method: "DELETE", route: "/v1/notes/:id",
+			principal:   &auth.Principal{Subject: "alice"},
+			owner:       ownedBy("alice"),
+			wantAllowed: true, wantRoles: []string{"notes-owner"}, wantOwnerRequired: true,
+			wantReason: "granted by role notes-owner as owner of the resource",
+		},
+		{
+			name: "not the owner", method: "DELETE", route: "/v1/notes/:id",
+			principal: &auth.Principal{Subject: "bob"},
+			owner:     ownedBy("alice"),
+			wantRoles: []string{"notes-owner"}, wantOwnerRequired: true, wantReason: "only granted to the owner of the resource",
+		},
+		{
+			name: "resource without owner", method: "DELETE", route: "/v1/notes/:id",
+			principal: &auth.Principal{Subject: ""},
+			owner:     ownedBy(""),
+			wantRoles: []string{"notes-owner"}, wantOwnerRequired: true, wantReason: "only granted to the owner of the resource",
+		},
+		{
+			name: "owner unknown", method: "DELETE", route: "/v1/notes/:id",
+			principal: &auth.Principal{Subject: "alice"},
+			wantRoles: []string{"notes-owner"}, wantOwnerRequired: true, wantReason: "owner of the resource is unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := authorizer.Evaluate(tt.method, tt.route, tt.principal, tt.owner)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if decision.Allowed != tt.wantAllowed {
+				t.Errorf("Allowed = %v, want %v", decision.Allowed, tt.wantAllowed)
+			}
+			if !reflect.DeepEqual(decision.Roles, tt.wantRoles) {
+				t.Errorf("Roles = %v, want %v", decision.Roles, tt.wantRoles)
+			}
+			if decision.OwnerRequired != tt.wantOwnerRequired {
+				t.Errorf("OwnerRequired = %v, want %v", decision.OwnerRequired, tt.wantOwnerRequired)
+			}
+			if decision.Reason != tt.wantReason {
+				t.Errorf("Reason = %q, want %q", decision.Reason, tt.wantReason)
+			}
+		})
+	}
+
+	t.Run("owner error", func(t *testing.T) {
+		lookupErr := stderrors.New("store down")
+		_, err := authorizer.Evaluate("DELETE", "/v1/notes/:id", &auth.Principal{Subject: "alice"},
+			func() (string, error) { return "", lookupErr })
+		if err != lookupErr {
+			t.Fatalf("Evaluate() error = %v, want the error of owner", err)
+		}
+	})
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "valid", content: testPolicy},
+		{name: "unknown field", content: "roles: {}\nbinding: []\n", wantErr: "parse policy"},
+		{
+			name:    "undefined roles",
+			content: "roles: {}\nauthenticated_roles: [a]\nanonymous_roles: [b]\nbindings:\n  - subjects: [ci]\n    roles: [c]\n",
+			wantErr: "role a is not defined; role b is not defined; role c is not defined",
+		},
+		{name: "rule without routes", content: "roles:\n  a:\n    - methods: [GET]\n", wantErr: "rule #0 of role a needs methods and routes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(tt.content))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParsePolicy() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParsePolicy() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorizerMiddleware(t *testing.T) {
+	authorizer := newTestAuthorizer(t)
+	authorizer.RegisterOwner("/v1/notes/:id", func(c *gin.Context) (string, error) {
+		if c.Param("id") == "missing" {
+			return "", errors.ErrNotFound
+		}
+		return "alice", nil
+	})
+
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		// stands in for auth, X-Subject authenticates and X-Roles are the roles of the credentials
+		if subject := c.GetHeader("X-Subject"); subject != "" {
+			var roles []string
+			if header := c.GetHeader("X-Roles"); header != "" {
+				roles = strings.Split(header, ",")
+			}
+			auth.SetPrincipal(c, &auth.Principal{Subject: subject, Roles: roles})
+		}
+	}, authorizer.Middleware())
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"meta": gin.H{"code": 20000}}) }
+	engine.GET("/v1/ping", ok)
+	engine.GET("/v1/notes", ok)
+	engine.DELETE("/v1/notes/:id", ok)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		subject        string
+		roles          string
+		wantStatus     int
+		wantCode       int
+		wantPermission string
+	}{
+		{name: "anonymous allowed", method: "GET", path: "/v1/ping", wantStatus: http.StatusOK, wantCode: 20000},
+		{name: "anonymous denied", method: "GET", path: "/v1/notes", wantStatus: http.StatusUnauthorized, wantCode: 40100, wantPermission: "GET /v1/notes"},
+		{name: "permission denied", method: "GET", path: "/v1/notes", subject: "bob", wantStatus: http.StatusForbidden, wantCode: 40302, wantPermission: "GET /v1/notes"},
+		{name: "granted", method: "GET", path: "/v1/notes", subject: "bob", roles: "notes-reader", wantStatus: http.StatusOK, wantCode: 20000},
+		{name: "not the owner", method: "DELETE", path: "/v1/notes/1", subject: "bob", wantStatus: http.StatusForbidden, wantCode: 40303, wantPermission: "DELETE /v1/notes/:id"},
+		{name: "owner", method: "DELETE", path: "/v1/notes/1", subject: "alice", wantStatus: http.StatusOK, wantCode: 20000},
+		{name: "owner lookup error answered as is", method: "DELETE", path: "/v1/notes/missing", subject: "alice", wantStatus: http.StatusNotFound, wantCode: 40400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.subject != "" {
+				req.Header.Set("X-Subject", tt.subject)
+				req.Header.Set("X-Roles", tt.roles)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var body struct {
+				Meta struct {
+					Code   int                 `json:"code"`
+					Errors []map[string]string `json:"errors"`
+				} `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q: %v", w.Body, err)
+			}
+			if body.Meta.Code != tt.wantCode {
+				t.Errorf("meta code = %d, want %d", body.Meta.Code, tt.wantCode)
+			}
+			if tt.wantPermission != "" {
+				if len(body.Meta.Errors) != 1 || body.Meta.Errors[0]["permission"] != tt.wantPermission {
+					t.Errorf("errors = %v, want the permission %q", body.Meta.Errors, tt.wantPermission)
+				}
+			}
+		})
+	}
+
+	t.Run("unmatched route left to the router", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/nothing", nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
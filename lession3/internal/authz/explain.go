@@ -0,0 +1,92 @@
+package authz
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/auth"
+)
+
+const explainPath = "/devops/authz/explain"
+
+// RegisterExplainHandler mounts GET /devops/authz/explain, which evaluates a hypothetical request:
+//
+//	?method=PATCH&path=/v1/notes/abc&subject=ci&roles=notes-writer&owner=ci
+//
+// path is resolved to a route template with the routes of the API engine, route takes a template
+// directly. Without subject nor roles the request is anonymous, without owner the owner is unknown.
+func RegisterExplainHandler(engine *gin.Engine, authorizer *Authorizer, apiRoutes gin.RoutesInfo) {
+	engine.GET(explainPath, func(c *gin.Context) {
+		ctx := c.Request.Context()
+		method := strings.ToUpper(c.DefaultQuery("method", http.MethodGet))
+		route := c.Query("route")
+		if route == "" {
+			path := c.Query("path")
+			if path == "" {
+				gins.ResponseAPIErrorWithLogging(c, ctx, errors.APIErrorWithScene(errors.ErrUnprocessableEntity,
+					errors.Items(map[string]string{"field": "route", "message": "route or path is required"})))
+				return
+			}
+			if route = resolveRoute(apiRoutes, method, path); route == "" {
+				gins.ResponseAPIErrorWithLogging(c, ctx, errors.APIErrorWithScene(errors.ErrUnprocessableEntity,
+					errors.Items(map[string]string{"field": "path", "message": "no API route matches " + method + " " + path})))
+				return
+			}
+		}
+
+		var principal *auth.Principal
+		subject, roles := c.Query("subject"), c.Query("roles")
+		if subject != "" || roles != "" {
+			principal = &auth.Principal{Subject: subject}
+			if roles != "" {
+				principal.Roles = strings.Split(roles, ",")
+			}
+		}
+		var owner func() (string, error)
+		if resourceOwner, ok := c.GetQuery("owner"); ok {
+			owner = func() (string, error) {
+				return resourceOwner, nil
+			}
+		}
+
+		decision, err := authorizer.Evaluate(method, route, principal, owner)
+		if err != nil {
+			gins.ResponseError(c, ctx, err)
+			return
+		}
+		gins.ResponseOK(c, decision)
+	})
+}
+
+// resolveRoute finds the template of the route serving method and path.
+func resolveRoute(routes gin.RoutesInfo, method, path string) string {
+	for _, route := range routes {
+		if route.Method == method && matchTemplate(route.Path, path) {
+			return route.Path
+		}
+	}
+	return ""
+}
+
+// matchTemplate matches a path against a gin route template, :param is one segment
+// and *param the rest of the path.
+func matchTemplate(template, path string) bool {
+	templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range templateSegments {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if !strings.HasPrefix(segment, ":") && segment != pathSegments[i] {
+			return false
+		}
+	}
+	return len(templateSegments) == len(pathSegments)
+}
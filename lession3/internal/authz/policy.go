@@ -0,0 +1,131 @@
+// Package authz authorizes the principal of auth against a declarative RBAC policy:
+// roles grant method and route template pairs, optionally only on the resources the principal owns.
+package authz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"k8s_learning/internal/auth"
+)
+
+// Rule grants Methods on Routes. "*" matches any method or route, and a route ending
+// with "*" matches the templates with that prefix, eg. "/v1/notes*".
+// An Owner rule only applies to the resources owned by the principal.
+type Rule struct {
+	Methods []string `yaml:"methods" json:"methods"`
+	Routes  []string `yaml:"routes" json:"routes"`
+	Owner   bool     `yaml:"owner,omitempty" json:"owner,omitempty"`
+}
+
+// Binding grants Roles to principals by subject, on top of the roles of their credentials.
+type Binding struct {
+	Subjects []string `yaml:"subjects"`
+	Roles    []string `yaml:"roles"`
+}
+
+// Policy is the YAML policy file:
+//
+//	roles:
+//	  notes-reader:
+//	    - methods: [GET]
+//	      routes: ["/v1/notes*"]
+//	  notes-owner:
+//	    - methods: [PATCH, DELETE]
+//	      routes: ["/v1/notes/:id"]
+//	      owner: true
+//	bindings:
+//	  - subjects: [ci]
+//	    roles: [notes-reader]
+//	authenticated_roles: [notes-owner]
+type Policy struct {
+	Roles    map[string][]Rule `yaml:"roles"`
+	Bindings []Binding         `yaml:"bindings"`
+	// AuthenticatedRoles are granted to every principal
+	AuthenticatedRoles []string `yaml:"authenticated_roles"`
+	// AnonymousRoles are granted to requests without principal
+	AnonymousRoles []string `yaml:"anonymous_roles"`
+}
+
+// ParsePolicy parses and checks a policy, every referenced role must be defined.
+func ParsePolicy(content []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(content, policy); err != nil {
+		return nil, fmt.Errorf("authz: parse policy: %w", err)
+	}
+	var problems []string
+	for role, rules := range policy.Roles {
+		for i, rule := range rules {
+			if len(rule.Methods) == 0 || len(rule.Routes) == 0 {
+				problems = append(problems, fmt.Sprintf("rule #%d of role %s needs methods and routes", i, role))
+			}
+		}
+	}
+	referenced := append(append([]string{}, policy.AuthenticatedRoles...), policy.AnonymousRoles...)
+	for _, binding := range policy.Bindings {
+		referenced = append(referenced, binding.Roles...)
+	}
+	for _, role := range referenced {
+		if _, ok := policy.Roles[role]; !ok {
+			problems = append(problems, fmt.Sprintf("role %s is not defined", role))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("authz: invalid policy: %s", strings.Join(problems, "; "))
+	}
+	return policy, nil
+}
+
+// rolesOf lists the roles of a principal, nil for anonymous requests, sorted and deduplicated.
+func (p *Policy) rolesOf(principal *auth.Principal) []string {
+	var roles []string
+	if principal == nil {
+		roles = append(roles, p.AnonymousRoles...)
+	} else {
+		roles = append(roles, principal.Roles...)
+		roles = append(roles, p.AuthenticatedRoles...)
+		for _, binding := range p.Bindings {
+			for _, subject := range binding.Subjects {
+				if subject == principal.Subject {
+					roles = append(roles, binding.Roles...)
+				}
+			}
+		}
+	}
+	sort.Strings(roles)
+	unique := roles[:0]
+	for i, role := range roles {
+		if i == 0 || role != roles[i-1] {
+			unique = append(unique, role)
+		}
+	}
+	return unique
+}
+
+func (r Rule) matches(method, route string) bool {
+	return matchAny(r.Methods, method, matchMethod) && matchAny(r.Routes, route, matchRoute)
+}
+
+func matchAny(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchMethod(pattern, method string) bool {
+	return pattern == "*" || strings.EqualFold(pattern, method)
+}
+
+func matchRoute(pattern, route string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(route, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == route
+}
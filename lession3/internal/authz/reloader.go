@@ -0,0 +1,87 @@
+package authz
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"k8s_learning/internal/tracing"
+)
+
+// Reloader polls the policy file and swaps the policy of the Authorizer when the content changes,
+// which also catches the symlink swap of a ConfigMap volume. An invalid file keeps the current policy.
+// It is a lifecycle.Component.
+type Reloader struct {
+	authorizer *Authorizer
+	path       string
+	interval   time.Duration
+
+	sum    [sha256.Size]byte
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewReloader(authorizer *Authorizer, path string, interval time.Duration) *Reloader {
+	return &Reloader{authorizer: authorizer, path: path, interval: interval}
+}
+
+func (r *Reloader) Name() string {
+	return "authz-policy-reloader"
+}
+
+// Reload loads the file when its content changed, reporting whether the policy was swapped.
+func (r *Reloader) Reload(ctx context.Context) (bool, error) {
+	content, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return false, fmt.Errorf("authz: read policy: %w", err)
+	}
+	sum := sha256.Sum256(content)
+	if sum == r.sum {
+		return false, nil
+	}
+	policy, err := ParsePolicy(content)
+	if err != nil {
+		return false, err
+	}
+	r.authorizer.SetPolicy(policy)
+	r.sum = sum
+	tracing.ComponentEvents(r.Name()).Printf("policy loaded from %s, %d roles, sha256 %x", r.path, len(policy.Roles), sum[:8])
+	return true, nil
+}
+
+func (r *Reloader) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := r.Reload(ctx); err != nil {
+					tracing.ComponentEvents(r.Name()).Errorf("reload of %s failed, keeping the current policy: %v", r.path, err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Reloader) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,92 @@
+package authz
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const readerPolicy = `
+roles:
+  notes-reader:
+    - methods: [GET]
+      routes: ["/v1/notes*"]
+authenticated_roles: [notes-reader]
+`
+
+func writePolicy(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloaderReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	authorizer := NewAuthorizer(&Policy{})
+	reloader := NewReloader(authorizer, path, time.Hour)
+
+	steps := []struct {
+		name        string
+		content     string
+		wantChanged bool
+		wantErr     bool
+		wantRoles   int
+	}{
+		{name: "first load", content: testPolicy, wantChanged: true, wantRoles: 5},
+		{name: "same content rewritten", content: testPolicy, wantRoles: 5},
+		{name: "changed", content: readerPolicy, wantChanged: true, wantRoles: 1},
+		{name: "invalid kept out", content: "roles: [", wantErr: true, wantRoles: 1},
+		{name: "undefined role kept out", content: "roles: {}\nanonymous_roles: [a]\n", wantErr: true, wantRoles: 1},
+		{name: "back to the loaded content", content: readerPolicy, wantRoles: 1},
+		{name: "changed again", content: testPolicy, wantChanged: true, wantRoles: 5},
+	}
+	for _, step := range steps {
+		writePolicy(t, path, step.content)
+		changed, err := reloader.Reload(context.Background())
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: Reload() error = %v, want error %v", step.name, err, step.wantErr)
+		}
+		if changed != step.wantChanged {
+			t.Errorf("%s: Reload() = %v, want %v", step.name, changed, step.wantChanged)
+		}
+		if got := len(authorizer.Policy().Roles); got != step.wantRoles {
+			t.Errorf("%s: policy has %d roles, want %d", step.name, got, step.wantRoles)
+		}
+	}
+
+	missing := NewReloader(authorizer, filepath.Join(t.TempDir(), "missing.yaml"), time.Hour)
+	if _, err := missing.Reload(context.Background()); err == nil {
+		t.Error("Reload() of a missing file = nil, want an error")
+	}
+}
+
+func TestReloaderPolls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, readerPolicy)
+	authorizer := NewAuthorizer(&Policy{})
+	reloader := NewReloader(authorizer, path, 10*time.Millisecond)
+	if _, err := reloader.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	writePolicy(t, path, testPolicy)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(authorizer.Policy().Roles) != 5 {
+		if time.Now().After(deadline) {
+			t.Fatal("policy change not picked up by the poll")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := reloader.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package chaos injects faults on purpose, to watch how Kubernetes reacts to a misbehaving pod:
+// slow or failing routes, CPU and memory pressure, failing probes, leaked goroutines and crashes.
+// Every injection expires after its TTL, and is listed by the admin /chaos API and /whoami.
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AfterShip/golang-common/uuid"
+
+	"k8s_learning/internal/ginx"
+	"k8s_learning/internal/tracing"
+)
+
+// Kind of fault.
+type Kind string
+
+const (
+	// KindLatency delays the matching requests by Latency.
+	KindLatency Kind = "latency"
+	// KindError answers the matching requests with Status.
+	KindError Kind = "error"
+	// KindCPU keeps Percent of the CPUs of the process busy.
+	KindCPU Kind = "cpu"
+	// KindMemory allocates and holds MB megabytes.
+	KindMemory Kind = "memory"
+	// KindFailReadyz fails the readiness probe, the pod leaves the Service endpoints.
+	KindFailReadyz Kind = "fail_readyz"
+	// KindFailLivez fails the liveness probe, kubelet restarts the container.
+	KindFailLivez Kind = "fail_livez"
+	// KindGoroutineLeak parks Count goroutines.
+	KindGoroutineLeak Kind = "goroutine_leak"
+	// KindExit exits the process with Code once the TTL is over, skipping the graceful shutdown.
+	KindExit Kind = "exit"
+)
+
+// Duration is a time.Duration written as a string in JSON, eg. "250ms".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"250ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Spec describes an injection, the fields used depend on Kind.
+type Spec struct {
+	Kind Kind     `json:"kind"`
+	TTL  Duration `json:"ttl"`
+	// Route is a route template of the API, "*" or empty for all, a trailing "*" matches a prefix,
+	// for latency and error
+	Route string `json:"route,omitempty"`
+	// Method limits latency and error to one method, empty for all
+	Method string `json:"method,omitempty"`
+	// Percent is the share of the matching requests for latency and error, default 100,
+	// and the CPU target for cpu
+	Percent float64  `json:"percent,omitempty"`
+	Latency Duration `json:"latency,omitempty"`
+	// Status is the http status of error, one of 429, 500, 503 and 504, default 500
+	Status int `json:"status,omitempty"`
+	MB     int `json:"mb,omitempty"`
+	Count  int `json:"count,omitempty"`
+	// Code is the exit code of exit
+	Code int `json:"code,omitempty"`
+}
+
+// Injection is an active Spec.
+type Injection struct {
+	ID string `json:"id"`
+	Spec
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type injection struct {
+	Injection
+	timer *time.Timer
+	// stop releases what the injection holds, eg. the CPU burners
+	stop func()
+}
+
+type Option func(i *Injector)
+
+// MaxTTL bounds the TTL of the injections, default 1h.
+func MaxTTL(ttl time.Duration) Option {
+	return func(i *Injector) {
+		i.maxTTL = ttl
+	}
+}
+
+// Injector holds the active injections.
+type Injector struct {
+	mu         sync.Mutex
+	injections map[string]*injection
+	maxTTL     time.Duration
+	exit       func(code int)
+	// events records the expirations, which happen outside of any request
+	events *tracing.Events
+}
+
+func NewInjector(opts ...Option) *Injector {
+	i := &Injector{
+		injections: make(map[string]*injection),
+		maxTTL:     time.Hour,
+		exit:       os.Exit,
+		events:     tracing.EventsOf("chaos", "injector"),
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// Add starts the injection of spec, which must pass Validate.
+func (i *Injector) Add(spec Spec) (Injection, error) {
+	if items := i.Validate(&spec); len(items) > 0 {
+		item := items[0].(ginx.ValidationItem)
+		return Injection{}, fmt.Errorf("chaos: %s", item.Info)
+	}
+	id, err := uuid.GenerateC24()
+	if err != nil {
+		return Injection{}, err
+	}
+	now := time.Now()
+	inj := &injection{
+		Injection: Injection{ID: id.String(), Spec: spec, CreatedAt: now, ExpiresAt: now.Add(time.Duration(spec.TTL))},
+		stop:      func() {},
+	}
+	switch spec.Kind {
+	case KindCPU:
+		inj.stop = burnCPU(spec.Percent)
+	case KindMemory:
+		inj.stop = holdMemory(spec.MB)
+	case KindGoroutineLeak:
+		inj.stop = leakGoroutines(spec.Count)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.injections[inj.ID] = inj
+	inj.timer = time.AfterFunc(time.Duration(spec.TTL), func() {
+		if !i.remove(inj.ID) {
+			return
+		}
+		if spec.Kind == KindExit {
+			i.events.Errorf("injection %s expired, exiting with code %d", inj.ID, spec.Code)
+			i.exit(spec.Code)
+			return
+		}
+		i.events.Printf("injection %s of kind %s expired", inj.ID, spec.Kind)
+	})
+	return inj.Injection, nil
+}
+
+// Remove stops the injection, an exit that did not fire yet is cancelled.
+func (i *Injector) Remove(id string) bool {
+	i.mu.Lock()
+	inj, ok := i.injections[id]
+	i.mu.Unlock()
+	if !ok {
+		return false
+	}
+	inj.timer.Stop()
+	return i.remove(id)
+}
+
+// Clear stops every injection.
+func (i *Injector) Clear() int {
+	n := 0
+	for _, inj := range i.List() {
+		if i.Remove(inj.ID) {
+			n++
+		}
+	}
+	return n
+}
+
+// List returns the active injections by creation time.
+func (i *Injector) List() []Injection {
+	i.mu.Lock()
+	list := make([]Injection, 0, len(i.injections))
+	for _, inj := range i.injections {
+		list = append(list, inj.Injection)
+	}
+	i.mu.Unlock()
+	sort.Slice(list, func(a, b int) bool {
+		if list[a].CreatedAt.Equal(list[b].CreatedAt) {
+			return list[a].ID < list[b].ID
+		}
+		return list[a].CreatedAt.Before(list[b].CreatedAt)
+	})
+	return list
+}
+
+// Active tells whether an injection of kind is active.
+func (i *Injector) Active(kind Kind) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, inj := range i.injections {
+		if inj.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// remove drops the injection and releases what it holds, reporting whether it was still active.
+func (i *Injector) remove(id string) bool {
+	i.mu.Lock()
+	inj, ok := i.injections[id]
+	delete(i.injections, id)
+	i.mu.Unlock()
+	if ok {
+		inj.stop()
+	}
+	return ok
+}
+
+// matching returns the latency and error injections of a request.
+func (i *Injector) matching(method, route string) []Injection {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var matched []Injection
+	for _, inj := range i.injections {
+		if inj.Kind != KindLatency && inj.Kind != KindError {
+			continue
+		}
+		if inj.Method != "" && inj.Method != method {
+			continue
+		}
+		if matchRoute(inj.Route, route) {
+			matched = append(matched, inj.Injection)
+		}
+	}
+	return matched
+}
+
+// matchRoute matches a route template against "", "*", a trailing "*" prefix or the template itself.
+func matchRoute(pattern, route string) bool {
+	switch {
+	case pattern == "" || pattern == "*":
+		return true
+	case strings.HasSuffix(pattern, "*"):
+		return strings.HasPrefix(route, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == route
+}
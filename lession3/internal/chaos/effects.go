@@ -0,0 +1,62 @@
+package chaos
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// burnPeriod is the duty cycle of the CPU burners, short enough for the CFS quota
+// accounting of the container to see a steady load.
+const burnPeriod = 10 * time.Millisecond
+
+// burnCPU keeps percent of GOMAXPROCS busy, one burner per P alternating spin and sleep.
+func burnCPU(percent float64) (stop func()) {
+	done := make(chan struct{})
+	busy := time.Duration(float64(burnPeriod) * percent / 100)
+	for n := runtime.GOMAXPROCS(0); n > 0; n-- {
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				start := time.Now()
+				for time.Since(start) < busy {
+				}
+				if idle := burnPeriod - busy; idle > 0 {
+					time.Sleep(idle)
+				}
+			}
+		}()
+	}
+	return func() { close(done) }
+}
+
+// holdMemory allocates mb megabytes and writes every page, so they count in the working set
+// the kubelet and the OOM killer look at.
+func holdMemory(mb int) (stop func()) {
+	held := make([][]byte, mb)
+	pageSize := os.Getpagesize()
+	for i := range held {
+		held[i] = make([]byte, 1<<20)
+		for j := 0; j < len(held[i]); j += pageSize {
+			held[i][j] = 1
+		}
+	}
+	return func() {
+		held = nil
+		debug.FreeOSMemory()
+	}
+}
+
+// leakGoroutines parks count goroutines, as a handler waiting forever on a channel would.
+func leakGoroutines(count int) (stop func()) {
+	done := make(chan struct{})
+	for n := 0; n < count; n++ {
+		go func() { <-done }()
+	}
+	return func() { close(done) }
+}
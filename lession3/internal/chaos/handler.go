@@ -0,0 +1,60 @@
+package chaos
+
+import (
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/AfterShip/golang-common/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"k8s_learning/internal/ginx"
+)
+
+const chaosPath = "/chaos"
+
+// RegisterHandlers mounts the chaos API on the admin engine:
+// GET /chaos lists the injections, POST /chaos adds one from a Spec,
+// DELETE /chaos/:id removes one and DELETE /chaos removes all.
+func RegisterHandlers(engine *gin.Engine, injector *Injector) {
+	group := engine.Group(chaosPath)
+	group.GET("", func(c *gin.Context) {
+		gins.ResponseOK(c, listResponse{Injections: injector.List()})
+	})
+	group.POST("", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		var spec Spec
+		if err := gins.ShouldBindJSON(c, &spec); err != nil {
+			gins.ResponseInputBindingError(c, ctx, err)
+			return
+		}
+		if items := injector.Validate(&spec); len(items) > 0 {
+			ginx.ResponseValidationError(c, items...)
+			return
+		}
+		injection, err := injector.Add(spec)
+		if err != nil {
+			gins.ResponseError(c, ctx, err)
+			return
+		}
+		logger.Warn(ctx, "[chaos] injection added", zap.String("category", "chaos"),
+			zap.String("chaos_id", injection.ID), zap.String("chaos_kind", string(injection.Kind)),
+			zap.Time("chaos_expires_at", injection.ExpiresAt))
+		gins.ResponseCreated(c, injection)
+	})
+	group.DELETE("/:id", func(c *gin.Context) {
+		if !injector.Remove(c.Param("id")) {
+			gins.ResponseAPIErrorWithLogging(c, c.Request.Context(),
+				errors.APIErrorWithScene(errors.ErrNotFound, errors.Field("chaos_id", c.Param("id"))))
+			return
+		}
+		gins.ResponseOK(c, listResponse{Injections: injector.List()})
+	})
+	group.DELETE("", func(c *gin.Context) {
+		injector.Clear()
+		gins.ResponseOK(c, listResponse{Injections: injector.List()})
+	})
+}
+
+type listResponse struct {
+	Injections []Injection `json:"injections"`
+}
@@ -0,0 +1,84 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/ginx"
+	"k8s_learning/internal/healthz"
+)
+
+// statusErrors are the APIErrors answered by the error injections, by status.
+var statusErrors = map[int]*errors.APIError{
+	http.StatusTooManyRequests:     errors.ErrTooManyRequests,
+	http.StatusInternalServerError: errors.ErrInternalError,
+	http.StatusServiceUnavailable:  errors.ErrUnavailable,
+	http.StatusGatewayTimeout:      errors.ErrDeadlineExceeded,
+}
+
+// Middleware applies the latency and error injections matching the route template and method.
+// Latencies add up and are cut short by the request deadline, the first error injection
+// drawn answers the request.
+func (i *Injector) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		matched := i.matching(c.Request.Method, ginx.Route(c))
+		if len(matched) == 0 {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		for _, injection := range matched {
+			if rand.Float64()*100 >= injection.Percent {
+				continue
+			}
+			switch injection.Kind {
+			case KindLatency:
+				if !sleep(ctx, time.Duration(injection.Latency)) {
+					gins.ResponseError(c, ctx, ctx.Err())
+					return
+				}
+			case KindError:
+				gins.ResponseAPIErrorWithLogging(c, ctx, errors.APIErrorWithScene(statusErrors[injection.Status],
+					errors.Cause(fmt.Errorf("chaos: injected %d", injection.Status)),
+					errors.Field("chaos_id", injection.ID),
+				))
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// ProbeCheck is a healthz.Checker failing while a fail_readyz or fail_livez injection is active,
+// to register on the probe it fails.
+func (i *Injector) ProbeCheck(probe healthz.Probe) healthz.Checker {
+	kind := KindFailReadyz
+	if probe == healthz.Livez {
+		kind = KindFailLivez
+	}
+	return healthz.NamedCheck("chaos-"+string(probe), func(ctx context.Context) error {
+		if i.Active(kind) {
+			return fmt.Errorf("chaos: %s injected", kind)
+		}
+		return nil
+	})
+}
+
+// sleep waits d unless ctx ends first, reporting whether d elapsed.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
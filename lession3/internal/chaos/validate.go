@@ -0,0 +1,70 @@
+package chaos
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s_learning/internal/ginx"
+)
+
+const (
+	maxLatency    = 5 * time.Minute
+	maxMemoryMB   = 64 * 1024
+	maxGoroutines = 1000000
+)
+
+// Validate fills the defaults of spec and returns an item per invalid field.
+func (i *Injector) Validate(spec *Spec) []interface{} {
+	var items []interface{}
+	invalid := func(path, format string, args ...interface{}) {
+		items = append(items, ginx.ValidationItem{Path: path, Info: fmt.Sprintf(format, args...)})
+	}
+
+	spec.Method = strings.ToUpper(spec.Method)
+	if ttl := time.Duration(spec.TTL); ttl <= 0 || ttl > i.maxTTL {
+		invalid("ttl", "ttl must be in (0, %s], got %s", i.maxTTL, ttl)
+	}
+	switch spec.Kind {
+	case KindLatency, KindError:
+		if spec.Percent == 0 {
+			spec.Percent = 100
+		}
+		if spec.Percent < 0 || spec.Percent > 100 {
+			invalid("percent", "percent must be in (0, 100], got %v", spec.Percent)
+		}
+		if spec.Kind == KindLatency {
+			if latency := time.Duration(spec.Latency); latency <= 0 || latency > maxLatency {
+				invalid("latency", "latency must be in (0, %s], got %s", maxLatency, latency)
+			}
+			break
+		}
+		if spec.Status == 0 {
+			spec.Status = http.StatusInternalServerError
+		}
+		if statusErrors[spec.Status] == nil {
+			invalid("status", "status must be one of 429, 500, 503 and 504, got %d", spec.Status)
+		}
+	case KindCPU:
+		if spec.Percent <= 0 || spec.Percent > 100 {
+			invalid("percent", "percent must be in (0, 100], got %v", spec.Percent)
+		}
+	case KindMemory:
+		if spec.MB < 1 || spec.MB > maxMemoryMB {
+			invalid("mb", "mb must be in [1, %d], got %d", maxMemoryMB, spec.MB)
+		}
+	case KindGoroutineLeak:
+		if spec.Count < 1 || spec.Count > maxGoroutines {
+			invalid("count", "count must be in [1, %d], got %d", maxGoroutines, spec.Count)
+		}
+	case KindExit:
+		if spec.Code < 0 || spec.Code > 125 {
+			invalid("code", "code must be in [0, 125], got %d", spec.Code)
+		}
+	case KindFailReadyz, KindFailLivez:
+	default:
+		invalid("kind", "kind must be one of latency, error, cpu, memory, fail_readyz, fail_livez, goroutine_leak and exit, got %q", spec.Kind)
+	}
+	return items
+}
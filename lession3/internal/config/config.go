@@ -0,0 +1,490 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AfterShip/golang-common/logger"
+	"go.uber.org/zap/zapcore"
+
+	"k8s_learning/internal/podinfo"
+	"k8s_learning/internal/tracing"
+)
+
+// Config of the web service.
+// Every leaf field can be set from the YAML file by its yaml path, from env WEB_<PATH>
+// and from flag -<path>, eg. server.read_timeout / WEB_SERVER_READ_TIMEOUT / -server-read-timeout.
+// Fields tagged with `secret:"true"` are redacted by Redact.
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Log         logger.LoggerConf `yaml:"log"`
+	AccessLog   AccessLogConfig   `yaml:"access_log"`
+	Events      EventsConfig      `yaml:"events"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Authz       AuthzConfig       `yaml:"authz"`
+	Pagination  PaginationConfig  `yaml:"pagination"`
+	Timeout     TimeoutConfig     `yaml:"timeout"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Chaos       ChaosConfig       `yaml:"chaos"`
+	Health      HealthConfig      `yaml:"health"`
+	Pod         PodConfig         `yaml:"pod"`
+	Shutdown    ShutdownConfig    `yaml:"shutdown"`
+}
+
+type ServerConfig struct {
+	Port              int           `yaml:"port"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`
+}
+
+// AdminConfig is the listener of debug, pprof, whoami and devops endpoints, never exposed by the Service.
+// It has no write timeout as pprof profiles and traces stream for as long as asked.
+type AdminConfig struct {
+	Port              int           `yaml:"port"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+}
+
+// HealthConfig maps onto the health.Status options. DefaultStatus holds until every listener
+// is bound; then the status goes online when OnlineWhenServing is set, otherwise it waits
+// for /devops/status, which needs AllowRemoteUpdate.
+type HealthConfig struct {
+	DefaultStatus     int32 `yaml:"default_status"`
+	AllowRemoteUpdate bool  `yaml:"allow_remote_update"`
+	OnlineWhenServing bool  `yaml:"online_when_serving"`
+}
+
+// AccessLogConfig of the access log middleware, RouteSampleRates is file only.
+type AccessLogConfig struct {
+	Enabled          bool               `yaml:"enabled"`
+	SampleRate       float64            `yaml:"sample_rate"`
+	RouteSampleRates map[string]float64 `yaml:"route_sample_rates"`
+	SkipRoutes       []string           `yaml:"skip_routes"`
+	Headers          bool               `yaml:"headers"`
+}
+
+// RateLimitConfig of the rate limit middleware of the API listener. Routes is file only,
+// keyed by route template optionally prefixed by a method, eg. "POST /v1/notes".
+// MaxKeys bounds the in-memory store, limits are per replica.
+type RateLimitConfig struct {
+	Enabled bool                       `yaml:"enabled"`
+	MaxKeys int                        `yaml:"max_keys"`
+	Default RateLimitPolicy            `yaml:"default"`
+	Routes  map[string]RateLimitPolicy `yaml:"routes"`
+}
+
+// RateLimitPolicy is a token bucket of Rate per second up to Burst,
+// or a sliding window of Limit requests per Window.
+type RateLimitPolicy struct {
+	// Algorithm is token_bucket, sliding_window or none
+	Algorithm string `yaml:"algorithm"`
+	// Key is ip or principal, the authenticated api key or token subject, which falls back
+	// to ip for anonymous requests; empty is the key of the default policy
+	Key    string        `yaml:"key"`
+	Rate   float64       `yaml:"rate"`
+	Burst  int           `yaml:"burst"`
+	Limit  int           `yaml:"limit"`
+	Window time.Duration `yaml:"window"`
+}
+
+// AuthConfig of the API listener authentication.
+type AuthConfig struct {
+	APIKeys APIKeysConfig `yaml:"api_keys"`
+	JWT     JWTConfig     `yaml:"jwt"`
+}
+
+// APIKeysConfig reads the hashed keys from File, see `web apikey generate`.
+// Unless Required, requests without key are anonymous and only rejected by the routes requiring a scope.
+// With auth.jwt enabled, a bearer token stands in for the key even when Required.
+type APIKeysConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	File     string   `yaml:"file"`
+	Headers  []string `yaml:"headers"`
+	Required bool     `yaml:"required"`
+}
+
+// JWTConfig verifies the bearer tokens with the keys of exactly one of KeyFile
+// (JWKS, PEM public key or certificate, or HMAC secret), JWKSURL or HMACSecret.
+// Requests already authenticated by an api key skip the token.
+type JWTConfig struct {
+	Enabled             bool          `yaml:"enabled"`
+	KeyFile             string        `yaml:"key_file"`
+	JWKSURL             string        `yaml:"jwks_url"`
+	JWKSRefreshInterval time.Duration `yaml:"jwks_refresh_interval"`
+	HMACSecret          string        `yaml:"hmac_secret" secret:"true"`
+	Issuer              string        `yaml:"issuer"`
+	Audience            string        `yaml:"audience"`
+	ClockSkew           time.Duration `yaml:"clock_skew"`
+	RequiredClaims      []string      `yaml:"required_claims"`
+	Algorithms          []string      `yaml:"algorithms"`
+	Required            bool          `yaml:"required"`
+}
+
+// AuthzConfig of the RBAC policy, PolicyFile is polled every ReloadInterval.
+type AuthzConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	PolicyFile     string        `yaml:"policy_file"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// TimeoutConfig is the request deadline of the API route groups. Groups is file only,
+// keyed by group prefix, eg. "/v1", the groups without one get Default and 0 disables the deadline.
+// The X-Request-Timeout budget of a caller shortens the deadline, it is clamped to MaxInbound.
+type TimeoutConfig struct {
+	Default    time.Duration            `yaml:"default"`
+	Groups     map[string]time.Duration `yaml:"groups"`
+	MaxInbound time.Duration            `yaml:"max_inbound"`
+}
+
+// Budget returns the deadline of the route group prefix.
+func (c TimeoutConfig) Budget(group string) time.Duration {
+	if budget, ok := c.Groups[group]; ok {
+		return budget
+	}
+	return c.Default
+}
+
+// PaginationConfig of the list endpoints. Cursors are signed with CursorSecret,
+// when empty every replica draws its own key and cursors break across replicas and restarts.
+type PaginationConfig struct {
+	DefaultLimit int    `yaml:"default_limit"`
+	MaxLimit     int    `yaml:"max_limit"`
+	CursorSecret string `yaml:"cursor_secret" secret:"true"`
+}
+
+// IdempotencyConfig of the Idempotency-Key middleware, responses are replayed for TTL
+// and a request in flight holds its key at most LockTimeout. Keys are per replica.
+// Bodies are hashed in memory, up to MaxRequestBytes.
+type IdempotencyConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	TTL             time.Duration `yaml:"ttl"`
+	LockTimeout     time.Duration `yaml:"lock_timeout"`
+	MaxKeys         int           `yaml:"max_keys"`
+	MaxRequestBytes int64         `yaml:"max_request_bytes"`
+}
+
+// EventsConfig of the event logs of the background components shown on /debug/events,
+// LogLevel is the level they are mirrored to the logger at: debug, info, warn, error or off.
+type EventsConfig struct {
+	LogLevel string `yaml:"log_level"`
+}
+
+// TracingConfig of the spans: SampleRatio is the share of the new traces sampled, in [0, 1],
+// the callers keep their decision; Exporter is where the sampled spans go: none or stdout.
+type TracingConfig struct {
+	SampleRatio float64 `yaml:"sample_ratio"`
+	Exporter    string  `yaml:"exporter"`
+}
+
+// ChaosConfig of the fault injection API of the admin listener, off by default,
+// no injection outlives MaxTTL.
+type ChaosConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	MaxTTL  time.Duration `yaml:"max_ttl"`
+}
+
+// PodConfig is where the Downward API volume is mounted.
+type PodConfig struct {
+	InfoDir string `yaml:"info_dir"`
+}
+
+type ShutdownConfig struct {
+	PropagationDelay time.Duration `yaml:"propagation_delay"`
+	Timeout          time.Duration `yaml:"timeout"`
+}
+
+// Default returns the config used when nothing else is given.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:              8080,
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       90 * time.Second,
+			MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+		},
+		Admin: AdminConfig{
+			Port:              8081,
+			ReadHeaderTimeout: 5 * time.Second,
+			IdleTimeout:       90 * time.Second,
+		},
+		Log: logger.LoggerConf{
+			Level:    "info",
+			Encoding: "json",
+		},
+		AccessLog: AccessLogConfig{
+			Enabled:    true,
+			SampleRate: 1,
+			SkipRoutes: []string{"/livez", "/readyz", "/startupz", "/metrics", "/devops/status"},
+		},
+		Events: EventsConfig{
+			LogLevel: "info",
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+			Exporter:    "none",
+		},
+		// the default API call limit of the 42900 description, 10 requests per second
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			MaxKeys: 100000,
+			Default: RateLimitPolicy{
+				Algorithm: "token_bucket",
+				Key:       "principal",
+				Rate:      10,
+				Burst:     10,
+				Limit:     10,
+				Window:    time.Second,
+			},
+		},
+		Auth: AuthConfig{
+			APIKeys: APIKeysConfig{
+				Headers: []string{"am-api-key", "aftership-api-key", "automizely-api-key"},
+			},
+			JWT: JWTConfig{
+				JWKSRefreshInterval: time.Hour,
+				ClockSkew:           30 * time.Second,
+				Algorithms:          []string{"HS256", "RS256", "ES256"},
+			},
+		},
+		Authz: AuthzConfig{
+			ReloadInterval: 10 * time.Second,
+		},
+		// under server.write_timeout, so the 504 envelope is sent before the connection is cut
+		Timeout: TimeoutConfig{
+			Default:    10 * time.Second,
+			MaxInbound: 25 * time.Second,
+		},
+		Pagination: PaginationConfig{
+			DefaultLimit: 20,
+			MaxLimit:     100,
+		},
+		Idempotency: IdempotencyConfig{
+			Enabled:         true,
+			TTL:             24 * time.Hour,
+			LockTimeout:     time.Minute,
+			MaxKeys:         100000,
+			MaxRequestBytes: 1 << 20,
+		},
+		Chaos: ChaosConfig{
+			MaxTTL: time.Hour,
+		},
+		Health: HealthConfig{
+			DefaultStatus:     http.StatusServiceUnavailable,
+			AllowRemoteUpdate: false,
+			OnlineWhenServing: true,
+		},
+		Pod: PodConfig{
+			InfoDir: podinfo.DefaultPodInfoDir,
+		},
+		Shutdown: ShutdownConfig{
+			PropagationDelay: 5 * time.Second,
+			Timeout:          20 * time.Second,
+		},
+	}
+}
+
+// Validate checks every field and reports all problems at once.
+func (c *Config) Validate() error {
+	var problems []string
+	invalid := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		invalid("server.port must be in [1, 65535], got %d", c.Server.Port)
+	}
+	if c.Admin.Port < 1 || c.Admin.Port > 65535 {
+		invalid("admin.port must be in [1, 65535], got %d", c.Admin.Port)
+	} else if c.Admin.Port == c.Server.Port {
+		invalid("admin.port must differ from server.port %d", c.Server.Port)
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"admin.read_header_timeout", c.Admin.ReadHeaderTimeout},
+		{"admin.idle_timeout", c.Admin.IdleTimeout},
+		{"shutdown.propagation_delay", c.Shutdown.PropagationDelay},
+	} {
+		if d.value < 0 {
+			invalid("%s must not be negative, got %s", d.name, d.value)
+		}
+	}
+	if c.Server.MaxHeaderBytes < 0 {
+		invalid("server.max_header_bytes must not be negative, got %d", c.Server.MaxHeaderBytes)
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		invalid("log.level %q is not a valid level", c.Log.Level)
+	}
+	if c.Log.Encoding != "json" && c.Log.Encoding != "console" {
+		invalid("log.encoding must be json or console, got %q", c.Log.Encoding)
+	}
+
+	if !tracing.ValidEventsLogLevel(c.Events.LogLevel) {
+		invalid("events.log_level must be debug, info, warn, error or off, got %q", c.Events.LogLevel)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid("tracing.sample_ratio must be in [0, 1], got %v", c.Tracing.SampleRatio)
+	}
+	if c.Tracing.Exporter != "none" && c.Tracing.Exporter != "stdout" {
+		invalid("tracing.exporter must be none or stdout, got %q", c.Tracing.Exporter)
+	}
+
+	if c.AccessLog.SampleRate < 0 || c.AccessLog.SampleRate > 1 {
+		invalid("access_log.sample_rate must be in [0, 1], got %v", c.AccessLog.SampleRate)
+	}
+	for route, rate := range c.AccessLog.RouteSampleRates {
+		if rate < 0 || rate > 1 {
+			invalid("access_log.route_sample_rates[%s] must be in [0, 1], got %v", route, rate)
+		}
+	}
+
+	if c.RateLimit.MaxKeys < 1 {
+		invalid("rate_limit.max_keys must be positive, got %d", c.RateLimit.MaxKeys)
+	}
+	c.RateLimit.Default.validate("rate_limit.default", invalid)
+	for route, policy := range c.RateLimit.Routes {
+		policy.validate(fmt.Sprintf("rate_limit.routes[%s]", route), invalid)
+	}
+
+	if c.Auth.APIKeys.Enabled && c.Auth.APIKeys.File == "" {
+		invalid("auth.api_keys.file is required when auth.api_keys.enabled")
+	}
+	if jwt := c.Auth.JWT; jwt.Enabled {
+		sources := 0
+		for _, source := range []string{jwt.KeyFile, jwt.JWKSURL, jwt.HMACSecret} {
+			if source != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			invalid("auth.jwt needs exactly one of key_file, jwks_url and hmac_secret, got %d", sources)
+		}
+		if jwt.ClockSkew < 0 {
+			invalid("auth.jwt.clock_skew must not be negative, got %s", jwt.ClockSkew)
+		}
+		if jwt.JWKSRefreshInterval <= 0 {
+			invalid("auth.jwt.jwks_refresh_interval must be positive, got %s", jwt.JWKSRefreshInterval)
+		}
+		for _, alg := range jwt.Algorithms {
+			if alg != "HS256" && alg != "RS256" && alg != "ES256" {
+				invalid("auth.jwt.algorithms supports HS256, RS256 and ES256, got %q", alg)
+			}
+		}
+	}
+
+	if c.Authz.Enabled && c.Authz.PolicyFile == "" {
+		invalid("authz.policy_file is required when authz.enabled")
+	}
+	if c.Authz.ReloadInterval <= 0 {
+		invalid("authz.reload_interval must be positive, got %s", c.Authz.ReloadInterval)
+	}
+
+	for group, budget := range c.Timeout.Groups {
+		c.validateBudget(fmt.Sprintf("timeout.groups[%s]", group), budget, invalid)
+	}
+	c.validateBudget("timeout.default", c.Timeout.Default, invalid)
+	c.validateBudget("timeout.max_inbound", c.Timeout.MaxInbound, invalid)
+
+	if c.Pagination.MaxLimit < 1 {
+		invalid("pagination.max_limit must be positive, got %d", c.Pagination.MaxLimit)
+	}
+	if c.Pagination.DefaultLimit < 1 || c.Pagination.DefaultLimit > c.Pagination.MaxLimit {
+		invalid("pagination.default_limit must be in [1, pagination.max_limit], got %d", c.Pagination.DefaultLimit)
+	}
+
+	if c.Idempotency.TTL <= 0 {
+		invalid("idempotency.ttl must be positive, got %s", c.Idempotency.TTL)
+	}
+	if c.Idempotency.LockTimeout <= 0 {
+		invalid("idempotency.lock_timeout must be positive, got %s", c.Idempotency.LockTimeout)
+	}
+	if c.Idempotency.MaxKeys < 1 {
+		invalid("idempotency.max_keys must be positive, got %d", c.Idempotency.MaxKeys)
+	}
+	if c.Idempotency.MaxRequestBytes < 1 {
+		invalid("idempotency.max_request_bytes must be positive, got %d", c.Idempotency.MaxRequestBytes)
+	}
+
+	if c.Chaos.MaxTTL <= 0 {
+		invalid("chaos.max_ttl must be positive, got %s", c.Chaos.MaxTTL)
+	}
+
+	if c.Health.DefaultStatus != http.StatusOK && c.Health.DefaultStatus != http.StatusServiceUnavailable {
+		invalid("health.default_status must be 200 or 503, got %d", c.Health.DefaultStatus)
+	}
+	if c.Health.DefaultStatus != http.StatusOK && !c.Health.OnlineWhenServing && !c.Health.AllowRemoteUpdate {
+		invalid("health.online_when_serving or health.allow_remote_update must be set with health.default_status 503, the pod would never be ready")
+	}
+
+	if c.Shutdown.Timeout <= 0 {
+		invalid("shutdown.timeout must be positive, got %s", c.Shutdown.Timeout)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (p RateLimitPolicy) validate(path string, invalid func(format string, args ...interface{})) {
+	switch p.Algorithm {
+	case "none":
+		return
+	case "token_bucket":
+		if p.Rate <= 0 {
+			invalid("%s.rate must be positive, got %v", path, p.Rate)
+		}
+		if p.Burst < 1 {
+			invalid("%s.burst must be positive, got %d", path, p.Burst)
+		}
+	case "sliding_window":
+		if p.Limit < 1 {
+			invalid("%s.limit must be positive, got %d", path, p.Limit)
+		}
+		if p.Window <= 0 {
+			invalid("%s.window must be positive, got %s", path, p.Window)
+		}
+	default:
+		invalid("%s.algorithm must be token_bucket, sliding_window or none, got %q", path, p.Algorithm)
+	}
+	if p.Key != "" && p.Key != "ip" && p.Key != "principal" {
+		invalid("%s.key must be ip or principal, got %q", path, p.Key)
+	}
+}
+
+// validateBudget keeps a request deadline under server.write_timeout,
+// past it the client gets a cut connection instead of the 504 envelope.
+func (c *Config) validateBudget(path string, budget time.Duration, invalid func(format string, args ...interface{})) {
+	if budget < 0 {
+		invalid("%s must not be negative, got %s", path, budget)
+	} else if c.Server.WriteTimeout > 0 && budget >= c.Server.WriteTimeout {
+		invalid("%s must be under server.write_timeout %s, got %s", path, c.Server.WriteTimeout, budget)
+	}
+}
+
+// Addr is the listen address of the public server.
+func (c ServerConfig) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// Addr is the listen address of the admin server.
+func (c AdminConfig) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// EnvPrefix is prepended to the upper-cased yaml path of a field to build its env key.
+	EnvPrefix = "WEB_"
+	// EnvConfigFile points to the YAML file, usually a mounted ConfigMap.
+	EnvConfigFile = EnvPrefix + "CONFIG"
+
+	configFileFlag = "config"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load builds the config from, in increasing precedence: defaults, the YAML file given by
+// -config or WEB_CONFIG, WEB_* env vars and flags in args. The result is validated.
+// flag.ErrHelp is returned as is when -h is given.
+func Load(name string, args []string) (*Config, error) {
+	return LoadWithFlagSet(flag.NewFlagSet(name, flag.ContinueOnError), args)
+}
+
+// LoadWithFlagSet is Load for subcommands that register their own flags on fs beforehand.
+func LoadWithFlagSet(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+	leaves := fieldsOf(reflect.ValueOf(cfg).Elem(), "")
+
+	configFile := fs.String(configFileFlag, os.Getenv(EnvConfigFile), "path of the YAML config file, env "+EnvConfigFile)
+	flagValues := make(map[string]*flagValue, len(leaves))
+	for _, leaf := range leaves {
+		fv := &flagValue{leaf: leaf, value: formatValue(leaf.value)}
+		flagValues[leaf.flagName()] = fv
+		fs.Var(fv, leaf.flagName(), fmt.Sprintf("%s, env %s", leaf.path, leaf.envKey()))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, leaf := range leaves {
+		raw, ok := os.LookupEnv(leaf.envKey())
+		if !ok {
+			continue
+		}
+		if err := setValue(leaf.value, raw); err != nil {
+			return nil, fmt.Errorf("env %s: %w", leaf.envKey(), err)
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		fv, ok := flagValues[f.Name]
+		if !ok || flagErr != nil {
+			return
+		}
+		if err := setValue(fv.leaf.value, fv.value); err != nil {
+			flagErr = fmt.Errorf("flag -%s: %w", f.Name, err)
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// flagValue only records the raw string, it is applied after the file and env.
+type flagValue struct {
+	leaf  leafField
+	value string
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.value
+}
+
+func (v *flagValue) Set(s string) error {
+	v.value = s
+	return nil
+}
+
+// IsBoolFlag allows bool fields to be set by a bare -flag.
+func (v *flagValue) IsBoolFlag() bool {
+	return v.leaf.value.Kind() == reflect.Bool
+}
+
+type leafField struct {
+	path   string
+	value  reflect.Value
+	secret bool
+}
+
+func (f leafField) envKey() string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(f.path))
+}
+
+func (f leafField) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(f.path)
+}
+
+// fieldsOf lists the settable leaves of a struct, named by their yaml path.
+// Fields that can not be expressed as a single string (maps, slices of structs) are file only.
+func fieldsOf(v reflect.Value, prefix string) []leafField {
+	var leaves []leafField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		fv := v.Field(i)
+		switch {
+		case fv.Kind() == reflect.Struct:
+			leaves = append(leaves, fieldsOf(fv, path)...)
+		case isScalar(fv.Type()):
+			leaves = append(leaves, leafField{path: path, value: fv, secret: sf.Tag.Get("secret") == "true"})
+		case fv.Kind() == reflect.Slice && isScalar(fv.Type().Elem()):
+			leaves = append(leaves, leafField{path: path, value: fv, secret: sf.Tag.Get("secret") == "true"})
+		}
+	}
+	return leaves
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// setValue parses s into v, slices are comma separated.
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var parts []string
+		if strings.TrimSpace(s) != "" {
+			parts = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setValue(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = formatValue(v.Index(i))
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
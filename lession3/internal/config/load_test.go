@@ -0,0 +1,154 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		env         map[string]string
+		args        []string
+		wantPort    int
+		wantTimeout time.Duration
+		wantClaims  []string
+		wantErr     string
+	}{
+		{
+			name:        "defaults",
+			wantPort:    8080,
+			wantTimeout: 15 * time.Second,
+		},
+		{
+			name:        "file over defaults",
+			file:        "server:\n  port: 9000\n  read_timeout: 20s\n",
+			wantPort:    9000,
+			wantTimeout: 20 * time.Second,
+		},
+		{
+			name:        "env over file",
+			file:        "server:\n  port: 9000\n  read_timeout: 20s\n",
+			env:         map[string]string{"WEB_SERVER_PORT": "9100"},
+			wantPort:    9100,
+			wantTimeout: 20 * time.Second,
+		},
+		{
+			name:        "flag over env",
+			file:        "server:\n  port: 9000\n  read_timeout: 20s\n",
+			env:         map[string]string{"WEB_SERVER_PORT": "9100", "WEB_SERVER_READ_TIMEOUT": "25s"},
+			args:        []string{"-server-port", "9200"},
+			wantPort:    9200,
+			wantTimeout: 25 * time.Second,
+		},
+		{
+			name:        "slice from env",
+			env:         map[string]string{"WEB_AUTH_JWT_REQUIRED_CLAIMS": "sub, exp"},
+			wantPort:    8080,
+			wantTimeout: 15 * time.Second,
+			wantClaims:  []string{"sub", "exp"},
+		},
+		{
+			name:    "invalid env",
+			env:     map[string]string{"WEB_SERVER_PORT": "http"},
+			wantErr: "env WEB_SERVER_PORT",
+		},
+		{
+			name:    "invalid flag",
+			args:    []string{"-server-read-timeout", "soon"},
+			wantErr: "flag -server-read-timeout",
+		},
+		{
+			name:    "unknown file key",
+			file:    "server:\n  prot: 9000\n",
+			wantErr: "parse config file",
+		},
+		{
+			name:    "validated",
+			args:    []string{"-admin-port", "8080"},
+			wantErr: "admin.port must differ from server.port 8080",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "config.yaml")
+				if err := ioutil.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				args = append([]string{"-config", path}, args...)
+			}
+
+			cfg, err := LoadWithFlagSet(flag.NewFlagSet("web", flag.ContinueOnError), args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Server.Port != tt.wantPort {
+				t.Errorf("server.port = %d, want %d", cfg.Server.Port, tt.wantPort)
+			}
+			if cfg.Server.ReadTimeout != tt.wantTimeout {
+				t.Errorf("server.read_timeout = %s, want %s", cfg.Server.ReadTimeout, tt.wantTimeout)
+			}
+			if tt.wantClaims != nil && !reflect.DeepEqual(cfg.Auth.JWT.RequiredClaims, tt.wantClaims) {
+				t.Errorf("auth.jwt.required_claims = %q, want %q", cfg.Auth.JWT.RequiredClaims, tt.wantClaims)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("server:\n  port: 9000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvConfigFile, path)
+
+	cfg, err := Load("web", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 {
+		t.Errorf("server.port = %d, want 9000 from %s", cfg.Server.Port, EnvConfigFile)
+	}
+}
+
+func TestValidateAggregates(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 0
+	cfg.Pagination.MaxLimit = 0
+	cfg.Shutdown.Timeout = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want every problem")
+	}
+	for _, want := range []string{
+		"server.port must be in [1, 65535], got 0",
+		"pagination.max_limit must be positive, got 0",
+		"shutdown.timeout must be positive, got 0s",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %q, want it to contain %q", err, want)
+		}
+	}
+
+	if err := Default().Validate(); err != nil {
+		t.Errorf("Default().Validate() = %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"reflect"
+
+	"gopkg.in/yaml.v2"
+)
+
+const redacted = "******"
+
+// Secret is a `secret:"true"` field set in the config, with the env var that sets it.
+type Secret struct {
+	Path   string
+	EnvKey string
+	Value  string
+}
+
+// Redact returns a deep copy of the config whose `secret:"true"` fields are masked,
+// safe to print or log.
+func (c *Config) Redact() *Config {
+	out := redactValue(reflect.ValueOf(*c), false, redacted)
+	cfg := out.Interface().(Config)
+	return &cfg
+}
+
+// YAML renders the redacted config.
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c.Redact())
+}
+
+// PublicYAML renders the config with its `secret:"true"` fields left empty, for a file
+// loaded back by the service, eg. a ConfigMap; the secrets then come from Secrets through env.
+func (c *Config) PublicYAML() ([]byte, error) {
+	out := redactValue(reflect.ValueOf(*c), false, "")
+	return yaml.Marshal(out.Interface())
+}
+
+// Secrets lists the `secret:"true"` fields that are set, in declaration order.
+func (c *Config) Secrets() []Secret {
+	var secrets []Secret
+	for _, leaf := range fieldsOf(reflect.ValueOf(c).Elem(), "") {
+		if leaf.secret && leaf.value.Kind() == reflect.String && leaf.value.Len() > 0 {
+			secrets = append(secrets, Secret{Path: leaf.path, EnvKey: leaf.envKey(), Value: leaf.value.String()})
+		}
+	}
+	return secrets
+}
+
+// redactValue copies v, replacing the non empty strings of secret fields with mask.
+func redactValue(v reflect.Value, secret bool, mask string) reflect.Value {
+	out := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Struct:
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if sf.PkgPath != "" {
+				continue
+			}
+			out.Field(i).Set(redactValue(v.Field(i), sf.Tag.Get("secret") == "true", mask))
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return out
+		}
+		out.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redactValue(v.Index(i), secret, mask))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return out
+		}
+		out.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), redactValue(iter.Value(), secret, mask))
+		}
+	case reflect.String:
+		if secret && v.Len() > 0 {
+			out.SetString(mask)
+		} else {
+			out.Set(v)
+		}
+	default:
+		out.Set(v)
+	}
+	return out
+}
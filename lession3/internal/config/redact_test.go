@@ -0,0 +1,54 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecrets(t *testing.T) {
+	const (
+		hmacSecret   = "hmac-secret-value"
+		cursorSecret = "cursor-secret-value"
+	)
+	cfg := Default()
+	cfg.Auth.JWT.HMACSecret = hmacSecret
+	cfg.Pagination.CursorSecret = cursorSecret
+
+	public, err := cfg.PublicYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactedYAML, err := cfg.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, out := range map[string][]byte{"PublicYAML": public, "YAML": redactedYAML} {
+		for _, secret := range []string{hmacSecret, cursorSecret} {
+			if strings.Contains(string(out), secret) {
+				t.Errorf("%s() leaks %q:\n%s", name, secret, out)
+			}
+		}
+	}
+	if !strings.Contains(string(redactedYAML), "hmac_secret: '******'") {
+		t.Errorf("YAML() does not mask hmac_secret:\n%s", redactedYAML)
+	}
+	if strings.Contains(string(public), redacted) {
+		t.Errorf("PublicYAML() masks instead of blanking:\n%s", public)
+	}
+
+	if cfg.Auth.JWT.HMACSecret != hmacSecret || cfg.Pagination.CursorSecret != cursorSecret {
+		t.Error("Redact() mutated the config")
+	}
+
+	want := []Secret{
+		{Path: "auth.jwt.hmac_secret", EnvKey: "WEB_AUTH_JWT_HMAC_SECRET", Value: hmacSecret},
+		{Path: "pagination.cursor_secret", EnvKey: "WEB_PAGINATION_CURSOR_SECRET", Value: cursorSecret},
+	}
+	if got := cfg.Secrets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Secrets() = %+v, want %+v", got, want)
+	}
+	if got := Default().Secrets(); len(got) != 0 {
+		t.Errorf("Default().Secrets() = %+v, want none", got)
+	}
+}
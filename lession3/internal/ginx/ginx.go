@@ -0,0 +1,55 @@
+// Package ginx complements github.com/AfterShip/golang-common/http/server/gins
+// with the helpers shared by the middlewares and handlers of this service.
+package ginx
+
+import (
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/model"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/AfterShip/golang-common/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+// UnmatchedRoute is the route label of requests that hit no route, it keeps label cardinality bounded.
+const UnmatchedRoute = "unmatched"
+
+func init() {
+	// golang-common has errors.ErrUnavailable but no description for its meta code
+	model.AddStatusCodeDescriptions(map[int]model.StatusCodeDescription{
+		50300: {
+			TypeName: "ServiceUnavailable",
+			Message:  "The service is temporarily unable to handle the request, retry later.",
+		},
+	})
+}
+
+// Route returns the route template of the request, eg. /v1/notes/:id.
+func Route(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return UnmatchedRoute
+}
+
+// MetaCode returns the meta.code of the response envelope once the handler has run.
+// gins.ResponseAPIError stores the APIError on the request context, otherwise it is built
+// from the http status the same way gins.ResponseSuccess does.
+func MetaCode(c *gin.Context) int {
+	if apiErr := tracing.GetTaskProcessErrorFromContext(c.Request.Context()); apiErr != nil {
+		return model.BuildMetaCode(apiErr.MainCode().Code(), apiErr.SubCode().Code())
+	}
+	return model.BuildMetaCode(c.Writer.Status(), 0)
+}
+
+// ValidationItem has the shape of the 422 errors items built by golang-common errors
+// from validator errors, for the checks done by hand, eg. on WrappedType fields.
+type ValidationItem struct {
+	Path string `json:"path,omitempty"`
+	Info string `json:"info"`
+}
+
+// ResponseValidationError answers errors.ErrUnprocessableEntity with items in meta.errors.
+func ResponseValidationError(c *gin.Context, items ...interface{}) {
+	gins.ResponseAPIErrorWithLogging(c, c.Request.Context(),
+		errors.APIErrorWithScene(errors.ErrUnprocessableEntity, errors.Items(items...), errors.Stack(errors.SmallerStacktrace(2, 1))))
+}
@@ -0,0 +1,54 @@
+package ginx
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/gin-gonic/gin"
+)
+
+// ListMeta is the pagination of a list response, see internal/pagination for the cursors.
+type ListMeta struct {
+	Limit int `json:"limit"`
+	// Total is left out when counting is too costly for the endpoint
+	Total      *int   `json:"total,omitempty"`
+	HasNext    bool   `json:"has_next"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListData is the data of every list response, model.ResponseBody having no room for the pagination.
+type ListData struct {
+	Items      interface{} `json:"items"`
+	Pagination ListMeta    `json:"pagination"`
+}
+
+// ResponseList answers 200 with items and their pagination, and the RFC 8288 Link header
+// with the next page and, past the first page, the first one.
+func ResponseList(c *gin.Context, items interface{}, meta ListMeta) {
+	var links []string
+	if meta.NextCursor != "" {
+		links = append(links, `<`+pageURL(c, meta.NextCursor, meta.Limit)+`>; rel="next"`)
+	}
+	if c.Query("cursor") != "" {
+		links = append(links, `<`+pageURL(c, "", meta.Limit)+`>; rel="first"`)
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+	gins.ResponseOK(c, ListData{Items: items, Pagination: meta})
+}
+
+// pageURL is the request URL, relative to the host, with the cursor and limit of another page.
+func pageURL(c *gin.Context, cursor string, limit int) string {
+	u := *c.Request.URL
+	query := u.Query()
+	query.Del("cursor")
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	query.Set("limit", strconv.Itoa(limit))
+	u.RawQuery = query.Encode()
+	u.Scheme, u.Host, u.User = "", "", nil
+	return u.RequestURI()
+}
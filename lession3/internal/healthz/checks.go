@@ -0,0 +1,61 @@
+package healthz
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/AfterShip/golang-common/http/server/health"
+)
+
+// StatusCheck keeps the manual Online/Offline override of /devops/status as a check,
+// it is also what the lifecycle manager flips while draining.
+func StatusCheck(status *health.Status) Checker {
+	return NamedCheck("status", func(ctx context.Context) error {
+		if code := StatusCode(status); code != http.StatusOK {
+			return fmt.Errorf("status is %d %s", code, http.StatusText(code))
+		}
+		return nil
+	})
+}
+
+// StatusCode reads the code of status atomically, the way Online and Offline store it.
+// health.Status.StatusCode has a value receiver, its copy of the Status races with them.
+func StatusCode(status *health.Status) int {
+	// the code is the first field of health.Status, TestStatusCode fails when that changes
+	return int(atomic.LoadInt32((*int32)(unsafe.Pointer(status))))
+}
+
+// TCPDialCheck succeeds when addr accepts a tcp connection.
+func TCPDialCheck(name, addr string) Checker {
+	return NamedCheck(name, func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// HTTPGetCheck succeeds when url answers a GET with a 2xx.
+func HTTPGetCheck(name, url string) Checker {
+	return NamedCheck(name, func(ctx context.Context) error {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+		}
+		return nil
+	})
+}
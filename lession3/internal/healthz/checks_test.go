@@ -0,0 +1,57 @@
+package healthz
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/AfterShip/golang-common/http/server/health"
+)
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  *health.Status
+		flip    func(s *health.Status)
+		want    int
+		wantErr bool
+	}{
+		{name: "default", status: health.NewStatus(), flip: func(s *health.Status) {}, want: http.StatusServiceUnavailable, wantErr: true},
+		{name: "default online", status: health.NewStatus(health.DefaultStatus(http.StatusOK)), flip: func(s *health.Status) {}, want: http.StatusOK},
+		{name: "online", status: health.NewStatus(), flip: (*health.Status).Online, want: http.StatusOK},
+		{name: "offline", status: health.NewStatus(health.DefaultStatus(http.StatusOK)), flip: (*health.Status).Offline, want: http.StatusServiceUnavailable, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.flip(tt.status)
+			if got := StatusCode(tt.status); got != tt.want || got != tt.status.StatusCode() {
+				t.Fatalf("StatusCode() = %d, want %d", got, tt.want)
+			}
+			if err := StatusCheck(tt.status).Check(context.Background()); (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStatusCheckConcurrentFlips(t *testing.T) {
+	status := health.NewStatus()
+	check := StatusCheck(status)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			status.Online()
+			status.Offline()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			check.Check(context.Background())
+		}
+	}()
+	wg.Wait()
+}
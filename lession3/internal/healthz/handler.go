@@ -0,0 +1,63 @@
+package healthz
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HttpHandlerFunc serves a probe the way kube-apiserver does:
+// "ok" with 200 when healthy, the per check listing with 503 otherwise.
+// ?verbose always lists the checks, ?exclude=name (repeatable) skips a check.
+func (r *Registry) HttpHandlerFunc(probe Probe) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		report := r.Run(req.Context(), probe, query["exclude"]...)
+		_, verbose := query["verbose"]
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Healthy && !verbose {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, "ok")
+			return
+		}
+
+		var buf bytes.Buffer
+		for _, result := range report.Results {
+			switch {
+			case result.Excluded:
+				fmt.Fprintf(&buf, "[+]%s excluded: ok\n", result.Name)
+			case result.Error == "":
+				fmt.Fprintf(&buf, "[+]%s ok\n", result.Name)
+			case !result.Critical:
+				fmt.Fprintf(&buf, "[-]%s failed (non-critical): %s\n", result.Name, result.Error)
+			default:
+				fmt.Fprintf(&buf, "[-]%s failed: %s\n", result.Name, result.Error)
+			}
+		}
+		if len(report.Unmatched) > 0 {
+			fmt.Fprintf(&buf, "warn: some health checks cannot be excluded: no matches for %q\n", report.Unmatched)
+		}
+		if report.Healthy {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(&buf, "%s check passed\n", probe)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(&buf, "%s check failed\n", probe)
+		}
+		w.Write(buf.Bytes())
+	}
+}
+
+// RegisterHandlers mounts /livez, /readyz and /startupz.
+func RegisterHandlers(engine *gin.Engine, r *Registry) {
+	for _, probe := range allProbes {
+		handler := gin.WrapF(r.HttpHandlerFunc(probe))
+		engine.GET("/"+string(probe), handler)
+		engine.HEAD("/"+string(probe), handler)
+	}
+}
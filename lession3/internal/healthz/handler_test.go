@@ -0,0 +1,62 @@
+package healthz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpHandlerFunc(t *testing.T) {
+	r := NewRegistry()
+	r.Register(NamedCheck("db", func(ctx context.Context) error { return nil }))
+	r.Register(NamedCheck("cache", func(ctx context.Context) error { return errDown }), NonCritical())
+	r.Register(NamedCheck("queue", func(ctx context.Context) error { return errDown }))
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "failing",
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody: "[-]cache failed (non-critical): down\n" +
+				"[+]db ok\n" +
+				"[-]queue failed: down\n" +
+				"readyz check failed\n",
+		},
+		{
+			name:       "excluded",
+			query:      "?exclude=queue",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:       "excluded verbose",
+			query:      "?exclude=queue&exclude=nope&verbose",
+			wantStatus: http.StatusOK,
+			wantBody: "[-]cache failed (non-critical): down\n" +
+				"[+]db ok\n" +
+				"[+]queue excluded: ok\n" +
+				"warn: some health checks cannot be excluded: no matches for [\"nope\"]\n" +
+				"readyz check passed\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.HttpHandlerFunc(Readyz)(w, httptest.NewRequest(http.MethodGet, "/readyz"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Fatalf("body = %q, want %q", w.Body, tt.wantBody)
+			}
+			if w.Header().Get("Cache-Control") != "no-store" {
+				t.Fatalf("Cache-Control = %q, want no-store", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
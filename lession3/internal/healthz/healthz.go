@@ -0,0 +1,292 @@
+package healthz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s_learning/internal/tracing"
+)
+
+// Probe is one of the kubelet probes, each probe aggregates its own subset of checks.
+type Probe string
+
+const (
+	Livez    Probe = "livez"
+	Readyz   Probe = "readyz"
+	Startupz Probe = "startupz"
+)
+
+var allProbes = []Probe{Livez, Readyz, Startupz}
+
+const defaultCheckTimeout = time.Second
+
+// Checker is a named dependency check, Check returns nil when healthy.
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type namedCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (c *namedCheck) Name() string {
+	return c.name
+}
+
+func (c *namedCheck) Check(ctx context.Context) error {
+	return c.check(ctx)
+}
+
+// NamedCheck adapts a function to a Checker.
+func NamedCheck(name string, check func(ctx context.Context) error) Checker {
+	return &namedCheck{name: name, check: check}
+}
+
+// PingCheck always succeeds, it tells the process is able to serve http.
+var PingCheck = NamedCheck("ping", func(ctx context.Context) error {
+	return nil
+})
+
+type CheckOption func(check *registeredCheck)
+
+// Timeout bounds a single run of the check, default 1s.
+func Timeout(d time.Duration) CheckOption {
+	return func(check *registeredCheck) {
+		check.timeout = d
+	}
+}
+
+// CacheTTL reuses the last result for d, so an expensive check is not run by every probe.
+func CacheTTL(d time.Duration) CheckOption {
+	return func(check *registeredCheck) {
+		check.cacheTTL = d
+	}
+}
+
+// NonCritical checks are reported but never fail the probe.
+func NonCritical() CheckOption {
+	return func(check *registeredCheck) {
+		check.critical = false
+	}
+}
+
+// Probes sets the probes the check belongs to, default readyz only.
+func Probes(probes ...Probe) CheckOption {
+	return func(check *registeredCheck) {
+		check.probes = probes
+	}
+}
+
+type registeredCheck struct {
+	checker  Checker
+	timeout  time.Duration
+	cacheTTL time.Duration
+	critical bool
+	probes   []Probe
+	// events records when the check starts or stops failing
+	events *tracing.Events
+
+	mu         sync.Mutex
+	lastErr    error
+	lastRunAt  time.Time
+	lastRunFor time.Duration
+	// inflight is the run the concurrent probes wait for, nil when none
+	inflight *checkRun
+}
+
+// checkRun is one run of a check, shared by the probes asking for it while it runs.
+type checkRun struct {
+	done     chan struct{}
+	err      error
+	duration time.Duration
+}
+
+func (c *registeredCheck) in(probe Probe) bool {
+	for _, p := range c.probes {
+		if p == probe {
+			return true
+		}
+	}
+	return false
+}
+
+// run returns the duration of the run, whether the result comes from the cache and the check error.
+// Concurrent probes share a single run, started outside the lock so that a slow check never
+// holds the others; a probe whose ctx ends first stops waiting for it.
+func (c *registeredCheck) run(ctx context.Context) (time.Duration, bool, error) {
+	c.mu.Lock()
+	if c.cacheTTL > 0 && !c.lastRunAt.IsZero() && time.Since(c.lastRunAt) < c.cacheTTL {
+		defer c.mu.Unlock()
+		return c.lastRunFor, true, c.lastErr
+	}
+	run := c.inflight
+	if run == nil {
+		run = &checkRun{done: make(chan struct{})}
+		c.inflight = run
+		go c.execute(run)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-run.done:
+		return run.duration, false, run.err
+	case <-ctx.Done():
+		return 0, false, fmt.Errorf("probe gave up waiting for the check: %w", ctx.Err())
+	}
+}
+
+// execute runs the check with a deadline of its own, the probe that started it may give up first.
+func (c *registeredCheck) execute(run *checkRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.checker.Check(ctx)
+	}()
+	select {
+	case run.err = <-errCh:
+	case <-ctx.Done():
+		run.err = fmt.Errorf("check timed out after %s", c.timeout)
+	}
+	run.duration = time.Since(start)
+
+	c.mu.Lock()
+	c.lastErr, c.lastRunAt, c.lastRunFor = run.err, start, run.duration
+	c.inflight = nil
+	c.mu.Unlock()
+	if run.err != nil {
+		c.events.Transition("failing", run.err)
+	} else {
+		c.events.Transition("passing", nil)
+	}
+	close(run.done)
+}
+
+// Registry holds the checks of the binary.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]*registeredCheck
+	// startupz only matters until it first passes, then it stays passed
+	started bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		checks: make(map[string]*registeredCheck),
+	}
+}
+
+// Register adds a check, a check with the same name is replaced.
+func (r *Registry) Register(checker Checker, opts ...CheckOption) {
+	check := &registeredCheck{
+		checker:  checker,
+		timeout:  defaultCheckTimeout,
+		critical: true,
+		probes:   []Probe{Readyz},
+		events:   tracing.EventsOf("healthz", checker.Name()),
+	}
+	for _, opt := range opts {
+		opt(check)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[checker.Name()] = check
+}
+
+// Result of one check in a probe run.
+type Result struct {
+	Name     string        `json:"name"`
+	Critical bool          `json:"critical"`
+	Excluded bool          `json:"excluded,omitempty"`
+	Cached   bool          `json:"cached,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+func (r Result) Healthy() bool {
+	return r.Excluded || r.Error == ""
+}
+
+// Report of a probe run, results are sorted by name.
+type Report struct {
+	Probe     Probe    `json:"probe"`
+	Healthy   bool     `json:"healthy"`
+	Results   []Result `json:"results"`
+	Unmatched []string `json:"unmatched_excludes,omitempty"`
+}
+
+// Run runs every check of the probe in parallel, checks named in exclude are skipped.
+func (r *Registry) Run(ctx context.Context, probe Probe, exclude ...string) Report {
+	excluded := make(map[string]bool, len(exclude))
+	for _, name := range exclude {
+		excluded[name] = false
+	}
+
+	r.mu.RLock()
+	started := r.started
+	var checks []*registeredCheck
+	for name, check := range r.checks {
+		if !check.in(probe) {
+			continue
+		}
+		if _, ok := excluded[name]; ok {
+			excluded[name] = true
+		}
+		checks = append(checks, check)
+	}
+	r.mu.RUnlock()
+
+	report := Report{Probe: probe, Healthy: true, Results: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		result := Result{Name: check.checker.Name(), Critical: check.critical}
+		if _, ok := excluded[result.Name]; ok {
+			result.Excluded = true
+			report.Results[i] = result
+			continue
+		}
+		wg.Add(1)
+		go func(i int, check *registeredCheck, result Result) {
+			defer wg.Done()
+			duration, cached, err := check.run(ctx)
+			result.Duration, result.Cached = duration, cached
+			if err != nil {
+				result.Error = err.Error()
+			}
+			report.Results[i] = result
+		}(i, check, result)
+	}
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if !result.Healthy() && result.Critical {
+			report.Healthy = false
+		}
+	}
+	for name, matched := range excluded {
+		if !matched {
+			report.Unmatched = append(report.Unmatched, name)
+		}
+	}
+	sort.Strings(report.Unmatched)
+	sort.Slice(report.Results, func(i, j int) bool {
+		return report.Results[i].Name < report.Results[j].Name
+	})
+
+	if probe == Startupz {
+		if started {
+			report.Healthy = true
+		} else if report.Healthy && len(exclude) == 0 {
+			r.mu.Lock()
+			r.started = true
+			r.mu.Unlock()
+		}
+	}
+	return report
+}
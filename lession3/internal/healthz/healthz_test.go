@@ -0,0 +1,219 @@
+package healthz
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("down")
+
+// countingCheck fails with err after sleeping for delay, and counts its runs.
+type countingCheck struct {
+	name  string
+	delay time.Duration
+	err   error
+	runs  int32
+}
+
+func (c *countingCheck) Name() string {
+	return c.name
+}
+
+func (c *countingCheck) Check(ctx context.Context) error {
+	atomic.AddInt32(&c.runs, 1)
+	select {
+	case <-time.After(c.delay):
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestRegistryRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		checks      []*countingCheck
+		opts        map[string][]CheckOption
+		probe       Probe
+		exclude     []string
+		wantHealthy bool
+		wantErrors  map[string]bool
+		wantExclude []string
+	}{
+		{
+			name:        "all passing",
+			checks:      []*countingCheck{{name: "db"}, {name: "cache"}},
+			probe:       Readyz,
+			wantHealthy: true,
+			wantErrors:  map[string]bool{"db": false, "cache": false},
+		},
+		{
+			name:        "critical failing",
+			checks:      []*countingCheck{{name: "db", err: errDown}, {name: "cache"}},
+			probe:       Readyz,
+			wantHealthy: false,
+			wantErrors:  map[string]bool{"db": true, "cache": false},
+		},
+		{
+			name:        "non-critical failing",
+			checks:      []*countingCheck{{name: "db"}, {name: "cache", err: errDown}},
+			opts:        map[string][]CheckOption{"cache": {NonCritical()}},
+			probe:       Readyz,
+			wantHealthy: true,
+			wantErrors:  map[string]bool{"db": false, "cache": true},
+		},
+		{
+			name:        "timed out",
+			checks:      []*countingCheck{{name: "db", delay: time.Second}},
+			opts:        map[string][]CheckOption{"db": {Timeout(10 * time.Millisecond)}},
+			probe:       Readyz,
+			wantHealthy: false,
+			wantErrors:  map[string]bool{"db": true},
+		},
+		{
+			name:        "excluded failing",
+			checks:      []*countingCheck{{name: "db", err: errDown}, {name: "cache"}},
+			probe:       Readyz,
+			exclude:     []string{"db", "queue"},
+			wantHealthy: true,
+			wantErrors:  map[string]bool{"db": false, "cache": false},
+			wantExclude: []string{"queue"},
+		},
+		{
+			name:        "other probe only",
+			checks:      []*countingCheck{{name: "db", err: errDown}, {name: "ping"}},
+			opts:        map[string][]CheckOption{"ping": {Probes(Livez)}},
+			probe:       Livez,
+			wantHealthy: true,
+			wantErrors:  map[string]bool{"ping": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			for _, check := range tt.checks {
+				r.Register(check, tt.opts[check.name]...)
+			}
+			report := r.Run(context.Background(), tt.probe, tt.exclude...)
+			if report.Healthy != tt.wantHealthy {
+				t.Fatalf("Healthy = %v, want %v (%+v)", report.Healthy, tt.wantHealthy, report.Results)
+			}
+			if len(report.Results) != len(tt.wantErrors) {
+				t.Fatalf("Results = %+v, want %d checks", report.Results, len(tt.wantErrors))
+			}
+			for _, result := range report.Results {
+				wantErr, ok := tt.wantErrors[result.Name]
+				if !ok {
+					t.Fatalf("unexpected result %+v", result)
+				}
+				if (result.Error != "") != wantErr {
+					t.Fatalf("%s: Error = %q, want error %v", result.Name, result.Error, wantErr)
+				}
+			}
+			if len(report.Unmatched) != len(tt.wantExclude) || (len(tt.wantExclude) > 0 && report.Unmatched[0] != tt.wantExclude[0]) {
+				t.Fatalf("Unmatched = %v, want %v", report.Unmatched, tt.wantExclude)
+			}
+		})
+	}
+}
+
+func TestRegistryCacheTTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		wait       time.Duration
+		wantRuns   int32
+		wantCached bool
+	}{
+		{name: "no cache", wantRuns: 2},
+		{name: "cached", ttl: time.Minute, wantRuns: 1, wantCached: true},
+		{name: "expired", ttl: 10 * time.Millisecond, wait: 20 * time.Millisecond, wantRuns: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &countingCheck{name: "db", err: errDown}
+			r := NewRegistry()
+			r.Register(check, CacheTTL(tt.ttl))
+			r.Run(context.Background(), Readyz)
+			time.Sleep(tt.wait)
+			report := r.Run(context.Background(), Readyz)
+			if got := atomic.LoadInt32(&check.runs); got != tt.wantRuns {
+				t.Fatalf("runs = %d, want %d", got, tt.wantRuns)
+			}
+			if result := report.Results[0]; result.Cached != tt.wantCached || result.Error == "" {
+				t.Fatalf("result = %+v, want cached %v with the error", result, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestRegistryConcurrentProbesShareRun(t *testing.T) {
+	check := &countingCheck{name: "db", delay: 100 * time.Millisecond}
+	r := NewRegistry()
+	r.Register(check)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if report := r.Run(context.Background(), Readyz); !report.Healthy {
+				t.Errorf("report = %+v, want healthy", report)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(&check.runs); got != 1 {
+		t.Fatalf("runs = %d, want 1", got)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("probes took %s, queued behind each other", elapsed)
+	}
+}
+
+func TestRegistryProbeGivesUp(t *testing.T) {
+	check := &countingCheck{name: "db", delay: time.Second}
+	r := NewRegistry()
+	r.Register(check, Timeout(2*time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if report := r.Run(ctx, Readyz); report.Healthy {
+		t.Fatal("Healthy = true, want the probe to fail when it gives up")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("probe waited %s for the check past its own deadline", elapsed)
+	}
+}
+
+func TestRegistryStartupzLatches(t *testing.T) {
+	check := &countingCheck{name: "warmup", err: errDown}
+	r := NewRegistry()
+	r.Register(check, Probes(Startupz))
+
+	steps := []struct {
+		err         error
+		exclude     []string
+		wantHealthy bool
+	}{
+		{err: errDown, wantHealthy: false},
+		// passing with an exclude does not latch
+		{err: errDown, exclude: []string{"warmup"}, wantHealthy: true},
+		{err: errDown, wantHealthy: false},
+		{err: nil, wantHealthy: true},
+		// once passed, it stays passed
+		{err: errDown, wantHealthy: true},
+	}
+	for i, step := range steps {
+		check.err = step.err
+		if report := r.Run(context.Background(), Startupz, step.exclude...); report.Healthy != step.wantHealthy {
+			t.Fatalf("step %d: Healthy = %v, want %v", i, report.Healthy, step.wantHealthy)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package client
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+
+	"k8s_learning/internal/metrics"
+	"k8s_learning/internal/tracing"
+)
+
+// ErrCircuitOpen is the cause of the errors.ErrUnavailable answered while the circuit of a host is open.
+var ErrCircuitOpen = stderrors.New("http client: circuit open")
+
+// CircuitState of a host.
+type CircuitState string
+
+const (
+	// CircuitClosed lets every request through, counting the consecutive failures.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails the requests at once, until OpenTimeout is over.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets HalfOpenRequests through, their outcome closes or opens the circuit again.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+var (
+	circuitState = metrics.NewGauge(
+		"http_client_circuit_state",
+		"State of the circuit of a host by breaker: 0 closed, 1 half open, 2 open.",
+		"breaker", "host",
+	)
+	circuitRejectedTotal = metrics.NewCounter(
+		"http_client_circuit_rejected_total",
+		"Number of outbound requests failed without being sent because the circuit was open, by breaker and host.",
+		"breaker", "host",
+	)
+)
+
+var stateValues = map[CircuitState]float64{CircuitClosed: 0, CircuitHalfOpen: 1, CircuitOpen: 2}
+
+// breakers are listed by the circuit handler of the admin listener.
+var breakers = struct {
+	sync.Mutex
+	byName map[string]*Breaker
+}{byName: make(map[string]*Breaker)}
+
+type BreakerOption func(b *Breaker)
+
+// FailureThreshold is the number of consecutive failures opening the circuit, default 5.
+func FailureThreshold(n int) BreakerOption {
+	return func(b *Breaker) {
+		b.threshold = n
+	}
+}
+
+// OpenTimeout is how long an open circuit fails the requests before trying again, default 30s.
+func OpenTimeout(d time.Duration) BreakerOption {
+	return func(b *Breaker) {
+		b.openTimeout = d
+	}
+}
+
+// HalfOpenRequests is the number of trial requests let through by a half open circuit, default 1.
+func HalfOpenRequests(n int) BreakerOption {
+	return func(b *Breaker) {
+		b.halfOpenRequests = n
+	}
+}
+
+// Breaker keeps one circuit per host, opened by FailureThreshold consecutive failures.
+type Breaker struct {
+	name             string
+	threshold        int
+	openTimeout      time.Duration
+	halfOpenRequests int
+
+	// events records the transitions of the circuits
+	events *tracing.Events
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// trials is the number of requests let through while half open
+	trials int
+	// generation changes with the state, the outcome of a request sent in another state is ignored
+	generation uint64
+}
+
+// Circuit is the state of the circuit of a host, as shown by the admin listener.
+type Circuit struct {
+	Host                string       `json:"host"`
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+	RetryAt             *time.Time   `json:"retry_at,omitempty"`
+}
+
+// NewBreaker creates a breaker and registers it under name for the admin listener,
+// it panics when the name is taken, like metrics.NewCounter.
+func NewBreaker(name string, opts ...BreakerOption) *Breaker {
+	b := &Breaker{
+		name:             name,
+		threshold:        5,
+		openTimeout:      30 * time.Second,
+		halfOpenRequests: 1,
+		events:           tracing.EventsOf("circuit_breaker", name),
+		circuits:         make(map[string]*circuit),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	breakers.Lock()
+	defer breakers.Unlock()
+	if _, ok := breakers.byName[name]; ok {
+		panic(fmt.Sprintf("http client: breaker %s already registered", name))
+	}
+	breakers.byName[name] = b
+	return b
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Policy fails the requests to a host whose circuit is open with errors.ErrUnavailable,
+// caused by ErrCircuitOpen.
+func (b *Breaker) Policy() Policy {
+	return func(next Doer) Doer {
+		return func(req *http.Request) (*http.Response, error) {
+			host := req.URL.Host
+			generation, retryAt, ok := b.allow(host)
+			if !ok {
+				circuitRejectedTotal.With(b.name, host).Inc()
+				tracing.LazyPrintf(req.Context(), "http_client circuit of %s open until %s", host, retryAt)
+				return nil, errors.APIErrorWithScene(errors.ErrUnavailable,
+					errors.Cause(ErrCircuitOpen),
+					errors.Field("upstream_host", host),
+					errors.Field("breaker", b.name),
+					errors.Field("circuit_retry_at", retryAt),
+					errors.Stack(errors.SmallerStacktrace(2, 1)),
+				)
+			}
+			resp, err := next(req)
+			// a request cancelled by the caller or refused by a Bulkhead says nothing of the host
+			if stderrors.Is(err, ErrBulkheadFull) || stderrors.Is(req.Context().Err(), context.Canceled) {
+				b.release(host, generation)
+			} else {
+				b.record(host, generation, failed(resp, err))
+			}
+			return resp, err
+		}
+	}
+}
+
+// Circuits returns the circuits by host.
+func (b *Breaker) Circuits() []Circuit {
+	b.mu.Lock()
+	list := make([]Circuit, 0, len(b.circuits))
+	for host, c := range b.circuits {
+		item := Circuit{Host: host, State: c.state, ConsecutiveFailures: c.failures}
+		if c.state != CircuitClosed {
+			openedAt, retryAt := c.openedAt, c.openedAt.Add(b.openTimeout)
+			item.OpenedAt, item.RetryAt = &openedAt, &retryAt
+		}
+		list = append(list, item)
+	}
+	b.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Host < list[j].Host
+	})
+	return list
+}
+
+// allow tells whether a request to host may be sent, and the generation of the circuit it is sent in.
+func (b *Breaker) allow(host string) (generation uint64, retryAt time.Time, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, found := b.circuits[host]
+	if !found {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[host] = c
+		circuitState.With(b.name, host).Set(stateValues[CircuitClosed])
+	}
+	switch c.state {
+	case CircuitOpen:
+		retryAt = c.openedAt.Add(b.openTimeout)
+		if time.Now().Before(retryAt) {
+			return 0, retryAt, false
+		}
+		b.transition(host, c, CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if c.trials >= b.halfOpenRequests {
+			return 0, c.openedAt.Add(b.openTimeout), false
+		}
+		c.trials++
+	}
+	return c.generation, time.Time{}, true
+}
+
+// record counts the outcome of a request let through by allow.
+func (b *Breaker) record(host string, generation uint64, failure bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[host]
+	if c.generation != generation {
+		return
+	}
+	switch {
+	case failure && c.state == CircuitHalfOpen:
+		c.openedAt = time.Now()
+		b.transition(host, c, CircuitOpen)
+	case failure:
+		c.failures++
+		if c.failures >= b.threshold {
+			c.openedAt = time.Now()
+			b.transition(host, c, CircuitOpen)
+		}
+	case c.state == CircuitHalfOpen:
+		c.failures = 0
+		b.transition(host, c, CircuitClosed)
+	default:
+		c.failures = 0
+	}
+}
+
+// release gives back the trial of a request without outcome.
+func (b *Breaker) release(host string, generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuits[host]; c.generation == generation && c.state == CircuitHalfOpen {
+		c.trials--
+	}
+}
+
+func (b *Breaker) transition(host string, c *circuit, state CircuitState) {
+	from := c.state
+	c.state = state
+	c.trials = 0
+	c.generation++
+	circuitState.With(b.name, host).Set(stateValues[state])
+	if state == CircuitOpen {
+		b.events.Errorf("circuit of %s %s -> %s after %d consecutive failures", host, from, state, c.failures)
+	} else {
+		b.events.Printf("circuit of %s %s -> %s", host, from, state)
+	}
+}
+
+// failed tells whether an outcome counts against the circuit: a transport error or a 5xx.
+func failed(resp *http.Response, err error) bool {
+	if err == nil {
+		return false
+	}
+	if resp == nil {
+		return true
+	}
+	return resp.StatusCode >= 500
+}
+
+// Breakers returns the registered breakers by name.
+func Breakers() []*Breaker {
+	breakers.Lock()
+	list := make([]*Breaker, 0, len(breakers.byName))
+	for _, b := range breakers.byName {
+		list = append(list, b)
+	}
+	breakers.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testOpenTimeout = 20 * time.Millisecond
+
+// newTestBreaker registers a breaker under the name of the test, until its end.
+func newTestBreaker(t *testing.T, opts ...BreakerOption) *Breaker {
+	b := NewBreaker(t.Name(), opts...)
+	t.Cleanup(func() {
+		breakers.Lock()
+		delete(breakers.byName, b.name)
+		breakers.Unlock()
+	})
+	return b
+}
+
+// attempt is a request through the breaker and what is expected of it.
+type attempt struct {
+	// wait passes before the request, eg. testOpenTimeout for the circuit to half open
+	wait time.Duration
+	// status is answered by the host
+	status int
+	// wantRejected is true when the circuit must fail the request without sending it
+	wantRejected bool
+	// wantState is the state after the request
+	wantState CircuitState
+}
+
+func TestBreaker(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts []attempt
+	}{
+		{
+			name: "opens after consecutive failures",
+			attempts: []attempt{
+				{status: 503, wantState: CircuitClosed},
+				{status: 502, wantState: CircuitClosed},
+				{status: 500, wantState: CircuitOpen},
+				{status: 200, wantRejected: true, wantState: CircuitOpen},
+			},
+		},
+		{
+			name: "success resets the failures",
+			attempts: []attempt{
+				{status: 503, wantState: CircuitClosed},
+				{status: 503, wantState: CircuitClosed},
+				{status: 200, wantState: CircuitClosed},
+				{status: 503, wantState: CircuitClosed},
+				{status: 503, wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "4xx is not a failure",
+			attempts: []attempt{
+				{status: 404, wantState: CircuitClosed},
+				{status: 409, wantState: CircuitClosed},
+				{status: 429, wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "half open trial closes",
+			attempts: []attempt{
+				{status: 503, wantState: CircuitClosed},
+				{status: 503, wantState: CircuitClosed},
+				{status: 503, wantState: CircuitOpen},
+				{wait: testOpenTimeout, status: 200, wantState: CircuitClosed},
+				{status: 503, wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "half open trial failure opens again",
+			attempts: []attempt{
+				{status: 503, wantState: CircuitClosed},
+				{status: 503, wantState: CircuitClosed},
+				{status: 503, wantState: CircuitOpen},
+				{wait: testOpenTimeout, status: 503, wantState: CircuitOpen},
+				{status: 200, wantRejected: true, wantState: CircuitOpen},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var status, sent int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent++
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+			breaker := newTestBreaker(t, FailureThreshold(3), OpenTimeout(testOpenTimeout))
+			c := New(Policies(breaker.Policy()))
+
+			for i, a := range tt.attempts {
+				time.Sleep(a.wait)
+				status = a.status
+				before := sent
+				err := c.Get(context.Background(), server.URL, nil)
+
+				if rejected := stderrors.Is(err, ErrCircuitOpen); rejected != a.wantRejected {
+					t.Fatalf("attempt %d: rejected = %v (%v), want %v", i, rejected, err, a.wantRejected)
+				}
+				if got := sent > before; got == a.wantRejected {
+					t.Fatalf("attempt %d: sent = %v, want %v", i, got, !a.wantRejected)
+				}
+				if got := breaker.Circuits()[0].State; got != a.wantState {
+					t.Fatalf("attempt %d: state = %s, want %s", i, got, a.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpenTrials(t *testing.T) {
+	const host = "notes.internal"
+	tests := []struct {
+		name string
+		// done ends the trial of the first request
+		done         func(b *Breaker, generation uint64)
+		wantAllowed  bool
+		wantState    CircuitState
+		wantFailures int
+	}{
+		{
+			name:        "trial in flight",
+			done:        func(b *Breaker, generation uint64) {},
+			wantAllowed: false,
+			wantState:   CircuitHalfOpen,
+		},
+		{
+			name:        "trial without outcome released",
+			done:        func(b *Breaker, generation uint64) { b.release(host, generation) },
+			wantAllowed: true,
+			wantState:   CircuitHalfOpen,
+		},
+		{
+			name:        "trial succeeded",
+			done:        func(b *Breaker, generation uint64) { b.record(host, generation, false) },
+			wantAllowed: true,
+			wantState:   CircuitClosed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := newTestBreaker(t, FailureThreshold(1), OpenTimeout(testOpenTimeout))
+			generation, _, _ := breaker.allow(host)
+			breaker.record(host, generation, true)
+			time.Sleep(testOpenTimeout)
+
+			generation, _, ok := breaker.allow(host)
+			if !ok {
+				t.Fatal("trial not allowed after the open timeout")
+			}
+			tt.done(breaker, generation)
+			if _, _, ok := breaker.allow(host); ok != tt.wantAllowed {
+				t.Fatalf("second request allowed = %v, want %v", ok, tt.wantAllowed)
+			}
+			if got := breaker.Circuits()[0].State; got != tt.wantState {
+				t.Fatalf("state = %s, want %s", got, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestBreakerStaleOutcome(t *testing.T) {
+	const host = "notes.internal"
+	breaker := newTestBreaker(t, FailureThreshold(1), OpenTimeout(time.Hour))
+	// sent while closed, answered after another request opened the circuit
+	slow, _, _ := breaker.allow(host)
+	generation, _, _ := breaker.allow(host)
+	breaker.record(host, generation, true)
+	breaker.record(host, slow, false)
+	if got := breaker.Circuits()[0].State; got != CircuitOpen {
+		t.Fatalf("state = %s, want %s", got, CircuitOpen)
+	}
+}
+
+func TestBreakerCallerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the caller gives up while the host is answering
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	breaker := newTestBreaker(t, FailureThreshold(1))
+	c := New(Policies(breaker.Policy()))
+
+	if err := c.Get(ctx, server.URL, nil); err == nil {
+		t.Fatal("error = nil, want the transport error")
+	}
+	if got := breaker.Circuits()[0]; got.State != CircuitClosed || got.ConsecutiveFailures != 0 {
+		t.Fatalf("circuit = %+v, want closed without failure", got)
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	stderrors "errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+
+	"k8s_learning/internal/metrics"
+	"k8s_learning/internal/tracing"
+)
+
+// ErrBulkheadFull is the cause of the errors.ErrUnavailable answered when a host has
+// too many requests in flight.
+var ErrBulkheadFull = stderrors.New("http client: too many requests in flight")
+
+var bulkheadRejectedTotal = metrics.NewCounter(
+	"http_client_bulkhead_rejected_total",
+	"Number of outbound requests failed without being sent because the bulkhead of the host was full, by host.",
+	"host",
+)
+
+type BulkheadOption func(b *Bulkhead)
+
+// MaxWait is how long a request waits for a slot before failing, default 0: it fails at once.
+func MaxWait(d time.Duration) BulkheadOption {
+	return func(b *Bulkhead) {
+		b.maxWait = d
+	}
+}
+
+// Bulkhead bounds the requests in flight per host, so that a slow host cannot take
+// every connection and goroutine of the service.
+type Bulkhead struct {
+	maxConcurrent int
+	maxWait       time.Duration
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func NewBulkhead(maxConcurrent int, opts ...BulkheadOption) *Bulkhead {
+	b := &Bulkhead{
+		maxConcurrent: maxConcurrent,
+		slots:         make(map[string]chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Policy fails the requests to a host with maxConcurrent requests in flight with
+// errors.ErrUnavailable, caused by ErrBulkheadFull.
+func (b *Bulkhead) Policy() Policy {
+	return func(next Doer) Doer {
+		return func(req *http.Request) (*http.Response, error) {
+			host := req.URL.Host
+			slots := b.hostSlots(host)
+			if !b.acquire(req, slots) {
+				bulkheadRejectedTotal.With(host).Inc()
+				tracing.LazyPrintf(req.Context(), "http_client bulkhead of %s full", host)
+				return nil, errors.APIErrorWithScene(errors.ErrUnavailable,
+					errors.Cause(ErrBulkheadFull),
+					errors.Field("upstream_host", host),
+					errors.Field("max_concurrent", b.maxConcurrent),
+					errors.Stack(errors.SmallerStacktrace(2, 1)),
+				)
+			}
+			defer func() { <-slots }()
+			return next(req)
+		}
+	}
+}
+
+func (b *Bulkhead) hostSlots(host string) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	slots, ok := b.slots[host]
+	if !ok {
+		slots = make(chan struct{}, b.maxConcurrent)
+		b.slots[host] = slots
+	}
+	return slots
+}
+
+func (b *Bulkhead) acquire(req *http.Request, slots chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if b.maxWait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(b.maxWait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-req.Context().Done():
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+// Package client is the outbound counterpart of github.com/AfterShip/golang-common/http/server/gins:
+// it calls the other services with the trace ID and the deadline of the context, decodes their
+// model.ResponseBody envelope and turns an error envelope back into an errors.APIError.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+	commontracing "github.com/AfterShip/golang-common/tracing"
+
+	"k8s_learning/internal/tracing"
+)
+
+type Option func(c *Client)
+
+// HTTPClient sets the http.Client sending the requests, default one with a Timeout of 30s.
+// The deadline of the context, when earlier, always wins.
+func HTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// DeadlineMargin is kept out of the X-Request-Timeout budget sent to the callee,
+// default tracing.DefaultDeadlineMargin.
+func DeadlineMargin(margin time.Duration) Option {
+	return func(c *Client) {
+		c.margin = margin
+	}
+}
+
+// MaxResponseBytes is the largest envelope decoded, default 10MiB.
+func MaxResponseBytes(n int64) Option {
+	return func(c *Client) {
+		c.maxResponseBytes = n
+	}
+}
+
+// UserAgent is sent with every request.
+func UserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// Policies wrap every call, the first one outermost, eg. Retry, then a Breaker, then a Bulkhead,
+// so that each attempt goes through the circuit and the concurrency limit.
+func Policies(policies ...Policy) Option {
+	return func(c *Client) {
+		c.policies = append(c.policies, policies...)
+	}
+}
+
+// Client calls services answering the model.ResponseBody envelope.
+type Client struct {
+	httpClient       *http.Client
+	margin           time.Duration
+	maxResponseBytes int64
+	userAgent        string
+	policies         []Policy
+	// do is send wrapped by the policies
+	do Doer
+}
+
+func New(opts ...Option) *Client {
+	c := &Client{
+		httpClient:       &http.Client{Timeout: 30 * time.Second},
+		margin:           tracing.DefaultDeadlineMargin,
+		maxResponseBytes: 10 << 20,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.do = c.send
+	for i := len(c.policies) - 1; i >= 0; i-- {
+		c.do = c.policies[i](c.do)
+	}
+	return c
+}
+
+// Get calls url and decodes meta.data into data, see Do.
+func (c *Client) Get(ctx context.Context, url string, data interface{}) error {
+	return c.Call(ctx, http.MethodGet, url, nil, data)
+}
+
+// Call sends body as JSON, nil for none, and decodes meta.data into data, see Do.
+func (c *Client) Call(ctx context.Context, method, url string, body, data interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return errors.APIErrorWithScene(errors.ErrInternalError, errors.Cause(err), errors.Stack(errors.SmallerStacktrace(2, 1)))
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return errors.APIErrorWithScene(errors.ErrInternalError, errors.Cause(err), errors.Stack(errors.SmallerStacktrace(2, 1)))
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	_, err = c.Do(req, data)
+	return err
+}
+
+// Do sends req with the am-trace-id and X-Request-Timeout of its context, through the Policies,
+// and decodes the meta.data of a 2xx envelope into data, nil to skip it. The body of the returned
+// response is already read and closed, the response is there for its status and headers.
+//
+// The error is always an *errors.APIError:
+//   - a non-2xx envelope keeps the main and sub code of meta.code and the items of meta.errors,
+//     so the standard errors.Is(err, errors.ErrNotFound) works as on the callee side;
+//   - a non-2xx answer without envelope, eg. from a proxy, has its http status as main code;
+//   - the deadline of the context maps to errors.ErrDeadlineExceeded, other transport errors,
+//     an open circuit and a full bulkhead to errors.ErrUnavailable.
+//
+// Failures are logged through logger and every attempt is measured by host in
+// http_client_request_duration_seconds.
+func (c *Client) Do(req *http.Request, data interface{}) (*http.Response, error) {
+	ctx := req.Context()
+	if c.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	start := time.Now()
+	resp, err := c.do(req)
+	if err != nil {
+		apiErr := errors.ConvertToAPIError(err)
+		logFailure(ctx, req, resp, time.Since(start), apiErr)
+		return resp, apiErr
+	}
+	if data != nil {
+		if err := decodeData(resp, data); err != nil {
+			apiErr := errors.APIErrorWithScene(errors.ErrInternalError,
+				errors.Cause(err),
+				errors.Field("upstream_host", req.URL.Host),
+				errors.Field("upstream_status", resp.StatusCode),
+				errors.Stack(errors.SmallerStacktrace(2, 1)),
+			)
+			logFailure(ctx, req, resp, time.Since(start), apiErr)
+			return resp, apiErr
+		}
+	}
+	return resp, nil
+}
+
+// send is the innermost Doer, one attempt of req. The trace headers are set on every attempt,
+// so that a retry sends the budget left at that time and its own client span.
+func (c *Client) send(req *http.Request) (resp *http.Response, err error) {
+	ctx := req.Context()
+	if traceID := commontracing.GetTraceIDFromContext(ctx); traceID != "" {
+		req.Header.Set(commontracing.HeaderTraceID, traceID)
+	}
+	tracing.SetRequestTimeoutHeader(ctx, req.Header, c.margin)
+	spanCtx, span := tracing.StartSpan(ctx, "HTTP "+req.Method+" "+req.URL.Host,
+		tracing.Kind(tracing.SpanKindClient),
+		tracing.Attribute("http.method", req.Method),
+		tracing.Attribute("http.host", req.URL.Host),
+		tracing.Attribute("http.path", req.URL.Path),
+	)
+	tracing.Inject(spanCtx, req.Header)
+	defer func() {
+		if resp != nil {
+			span.SetAttribute("http.status_code", resp.StatusCode)
+		}
+		span.RecordError(err)
+		span.End()
+	}()
+
+	start := time.Now()
+	resp, err = c.httpClient.Do(req)
+	if err != nil {
+		observe(req, 0, start)
+		tracing.LazyPrintf(ctx, "http_client %s %s%s failed in %s: %v", req.Method, req.URL.Host, req.URL.Path, time.Since(start), err)
+		return nil, transportError(req, err)
+	}
+	body, err := readBody(resp, c.maxResponseBytes)
+	observe(req, resp.StatusCode, start)
+	tracing.LazyPrintf(ctx, "http_client %s %s%s %d in %s", req.Method, req.URL.Host, req.URL.Path, resp.StatusCode, time.Since(start))
+	if err != nil {
+		return resp, transportError(req, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, responseError(req, resp, parseEnvelope(body))
+	}
+	return resp, nil
+}
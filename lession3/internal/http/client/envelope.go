@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/model"
+)
+
+// envelope is model.ResponseBody with data kept raw until the caller's type is known.
+type envelope struct {
+	Meta model.ResponseMeta `json:"meta"`
+	Data json.RawMessage    `json:"data"`
+}
+
+// mainCodes are the codes of golang-common errors, so that the rebuilt errors keep their message keys.
+var mainCodes = map[int]*errors.Code{}
+
+func init() {
+	for _, code := range []*errors.Code{
+		errors.CodeBadRequest, errors.CodeUnauthorized, errors.CodePaymentRequired, errors.CodeForbidden,
+		errors.CodeNotFound, errors.CodeMethodNotAllowed, errors.CodeConflict, errors.CodePreconditionFailed,
+		errors.CodeUnprocessableEntity, errors.CodeTooManyRequests, errors.CodeInternalError,
+		errors.CodeUnavailable, errors.CodeDeadlineExceeded,
+	} {
+		mainCodes[code.Code()] = code
+	}
+}
+
+// readBody reads and closes the body of resp, which is then replaced by the bytes read.
+func readBody(resp *http.Response, maxBytes int64) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("http client: response larger than %d bytes", maxBytes)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// parseEnvelope decodes body, a body that is not an envelope leaves meta.code at 0.
+func parseEnvelope(body []byte) *envelope {
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return &envelope{}
+	}
+	return &env
+}
+
+// decodeData decodes the meta.data of the 2xx envelope read by readBody into data,
+// an empty body, eg. 204, leaves data untouched.
+func decodeData(resp *http.Response, data interface{}) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || len(body) == 0 {
+		return err
+	}
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return fmt.Errorf("http client: response is not an envelope: %w", err)
+	}
+	if len(env.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(env.Data, data)
+}
+
+// responseError rebuilds the APIError of a non-2xx answer from meta.code, NNNSS with NNN the
+// main code and SS the sub code, or from the http status without envelope.
+func responseError(req *http.Request, resp *http.Response, env *envelope) *errors.APIError {
+	mainCode, subCode := resp.StatusCode, 0
+	if env.Meta.Code >= 10000 {
+		mainCode, subCode = env.Meta.Code/100, env.Meta.Code%100
+	}
+	main, ok := mainCodes[mainCode]
+	if !ok {
+		main = errors.NewCode(mainCode, "")
+	}
+	var sub *errors.Code
+	if subCode != 0 {
+		sub = errors.NewCode(subCode, "")
+	}
+
+	fields := []errors.SceneField{
+		errors.Cause(fmt.Errorf("%s %s answered %d", req.Method, req.URL.Host, resp.StatusCode)),
+		errors.Field("upstream_host", req.URL.Host),
+		errors.Field("upstream_status", resp.StatusCode),
+		errors.Stack(errors.SmallerStacktrace(3, 1)),
+	}
+	if env.Meta.Type != "" {
+		fields = append(fields, errors.Field("upstream_type", env.Meta.Type))
+	}
+	if env.Meta.Message != "" {
+		fields = append(fields, errors.Field("upstream_message", env.Meta.Message))
+	}
+	if len(env.Meta.Errors) > 0 {
+		fields = append(fields, errors.Items(env.Meta.Errors...))
+	}
+	return errors.APIErrorWithScene(errors.NewAPIError(main, sub), fields...)
+}
+
+// transportError maps an error of the round trip, the deadline of the context
+// to errors.ErrDeadlineExceeded and the others to errors.ErrUnavailable.
+func transportError(req *http.Request, err error) *errors.APIError {
+	basic := errors.ErrUnavailable
+	if stderrors.Is(err, context.DeadlineExceeded) || stderrors.Is(req.Context().Err(), context.DeadlineExceeded) {
+		basic = errors.ErrDeadlineExceeded
+	}
+	return errors.APIErrorWithScene(basic,
+		errors.Cause(err),
+		errors.Field("upstream_host", req.URL.Host),
+		errors.Stack(errors.SmallerStacktrace(3, 1)),
+	)
+}
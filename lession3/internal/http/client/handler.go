@@ -0,0 +1,29 @@
+package client
+
+import (
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/gin-gonic/gin"
+)
+
+const circuitsPath = "/devops/circuits"
+
+// RegisterCircuitHandler mounts GET /devops/circuits on the admin engine,
+// the circuits by host of every breaker created by NewBreaker.
+func RegisterCircuitHandler(engine *gin.Engine) {
+	engine.GET(circuitsPath, func(c *gin.Context) {
+		list := make([]breakerResponse, 0)
+		for _, b := range Breakers() {
+			list = append(list, breakerResponse{Name: b.Name(), Circuits: b.Circuits()})
+		}
+		gins.ResponseOK(c, circuitsResponse{Breakers: list})
+	})
+}
+
+type circuitsResponse struct {
+	Breakers []breakerResponse `json:"breakers"`
+}
+
+type breakerResponse struct {
+	Name     string    `json:"name"`
+	Circuits []Circuit `json:"circuits"`
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/model"
+	"github.com/AfterShip/golang-common/logger"
+	"github.com/AfterShip/golang-common/security"
+	"go.uber.org/zap"
+
+	"k8s_learning/internal/metrics"
+)
+
+var requestDuration = metrics.NewHistogram(
+	"http_client_request_duration_seconds",
+	"Latency of outbound http requests by host, method and http status, 0 when no response was received.",
+	metrics.DefBuckets,
+	"host", "method", "status",
+)
+
+func observe(req *http.Request, status int, start time.Time) {
+	requestDuration.With(req.URL.Host, req.Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+}
+
+// logFailure logs a failed call, 5xx and transport errors as warnings and 4xx as info,
+// the request headers are logged without the sensitive ones of security.
+func logFailure(ctx context.Context, req *http.Request, resp *http.Response, latency time.Duration, apiErr *errors.APIError) {
+	status, metaCode := 0, 0
+	if resp != nil {
+		status, metaCode = resp.StatusCode, model.BuildMetaCode(apiErr.MainCode().Code(), apiErr.SubCode().Code())
+	}
+	headerMap := make(map[string]string, len(req.Header))
+	for key, values := range req.Header {
+		if !security.IsSensitiveHeaderKey(key) {
+			headerMap[key] = strings.Join(values, ",")
+		}
+	}
+	fields := []zap.Field{
+		zap.String("category", "http_client"),
+		zap.String("method", req.Method),
+		zap.String("host", req.URL.Host),
+		zap.String("path", req.URL.EscapedPath()),
+		zap.Int("status", status),
+		zap.Int("meta_code", metaCode),
+		zap.Duration("latency", latency),
+		zap.Any("request_header", headerMap),
+		logger.ErrorField(apiErr),
+	}
+	msg := fmt.Sprintf("[http_client] %s %s%s %d %d", req.Method, req.URL.Host, req.URL.EscapedPath(), status, metaCode)
+	if status >= 400 && status < 500 {
+		logger.Info(ctx, msg, fields...)
+		return
+	}
+	logger.Warn(ctx, msg, fields...)
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	stderrors "errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+
+	"k8s_learning/internal/idempotency"
+	"k8s_learning/internal/metrics"
+	"k8s_learning/internal/tracing"
+)
+
+// Doer sends a request and returns its response, with the body already read, and the
+// *errors.APIError of a failure. The response may come with the error, eg. for a 503.
+type Doer func(req *http.Request) (*http.Response, error)
+
+// Policy wraps a Doer, see Retry, Breaker.Policy and Bulkhead.Policy.
+type Policy func(next Doer) Doer
+
+var retriesTotal = metrics.NewCounter(
+	"http_client_retries_total",
+	"Number of outbound requests sent again by the Retry policy, by host.",
+	"host",
+)
+
+type RetryOption func(conf *retryConf)
+
+type retryConf struct {
+	maxAttempts   int
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	maxRetryAfter time.Duration
+	codes         map[int]bool
+}
+
+// MaxAttempts bounds the attempts of a request, the first one included, default 3.
+func MaxAttempts(n int) RetryOption {
+	return func(conf *retryConf) {
+		conf.maxAttempts = n
+	}
+}
+
+// Backoff waits base, doubled on every retry up to max, with full jitter, default 100ms and 2s.
+func Backoff(base, max time.Duration) RetryOption {
+	return func(conf *retryConf) {
+		conf.baseDelay = base
+		conf.maxDelay = max
+	}
+}
+
+// MaxRetryAfter is the longest Retry-After waited for, a longer one ends the retries, default 10s.
+func MaxRetryAfter(d time.Duration) RetryOption {
+	return func(conf *retryConf) {
+		conf.maxRetryAfter = d
+	}
+}
+
+// RetryableCodes are the main codes telling that the callee did not process the request,
+// retried whatever the method, default 429 and 503.
+func RetryableCodes(codes ...int) RetryOption {
+	return func(conf *retryConf) {
+		conf.codes = make(map[int]bool, len(codes))
+		for _, code := range codes {
+			conf.codes[code] = true
+		}
+	}
+}
+
+// Retry sends a failed request again, after an exponential backoff or the Retry-After of the
+// answer when longer. Every request is retried on RetryableCodes, idempotent ones, that is
+// GET, HEAD, OPTIONS, PUT, DELETE and the requests with an Idempotency-Key, also on 500, 502,
+// 504 and transport errors. An open circuit, a full bulkhead and the end of the context are
+// never retried, nor is a retry started when its wait outlasts the deadline.
+// The body is sent again through req.GetBody, set by http.NewRequest for in-memory bodies,
+// a request without it is not retried.
+func Retry(opts ...RetryOption) Policy {
+	conf := &retryConf{
+		maxAttempts:   3,
+		baseDelay:     100 * time.Millisecond,
+		maxDelay:      2 * time.Second,
+		maxRetryAfter: 10 * time.Second,
+		codes:         map[int]bool{http.StatusTooManyRequests: true, http.StatusServiceUnavailable: true},
+	}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return func(next Doer) Doer {
+		return func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			for attempt := 1; ; attempt++ {
+				resp, err := next(req)
+				if err == nil || attempt >= conf.maxAttempts || !conf.retryable(req, resp, err) {
+					return resp, err
+				}
+				wait := conf.backoff(attempt)
+				if retryAfter, ok := parseRetryAfter(resp); ok {
+					if retryAfter > conf.maxRetryAfter {
+						return resp, err
+					}
+					if retryAfter > wait {
+						wait = retryAfter
+					}
+				}
+				if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+					return resp, err
+				}
+				retry, ok := rewind(req)
+				if !ok {
+					return resp, err
+				}
+
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return resp, err
+				}
+				retriesTotal.With(req.URL.Host).Inc()
+				tracing.LazyPrintf(ctx, "http_client retry %d of %s %s%s after %s", attempt, req.Method, req.URL.Host, req.URL.Path, wait)
+				req = retry
+			}
+		}
+	}
+}
+
+func (conf *retryConf) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil || stderrors.Is(err, ErrCircuitOpen) || stderrors.Is(err, ErrBulkheadFull) {
+		return false
+	}
+	if resp == nil {
+		return idempotent(req)
+	}
+	code := errors.ConvertToAPIError(err).MainCode().Code()
+	if conf.codes[code] {
+		return true
+	}
+	switch code {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent(req)
+	}
+	return false
+}
+
+// backoff is the wait before retry number attempt: a random duration up to base*2^(attempt-1),
+// capped at max, so the retries of many callers do not come back in step.
+func (conf *retryConf) backoff(attempt int) time.Duration {
+	d := conf.baseDelay
+	for i := 1; i < attempt && d < conf.maxDelay; i++ {
+		d *= 2
+	}
+	if d > conf.maxDelay {
+		d = conf.maxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(idempotency.HeaderKey) != ""
+}
+
+// rewind copies req for another attempt, with a fresh body.
+func rewind(req *http.Request) (*http.Request, bool) {
+	retry := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retry, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	retry.Body = body
+	return retry, true
+}
+
+// parseRetryAfter reads the Retry-After header of resp, in seconds or as an http date.
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+
+	"k8s_learning/internal/idempotency"
+)
+
+// outcome is what the fake Doer answers to an attempt: a transport error for status 0,
+// otherwise a response, with the *errors.APIError of its status when not 2xx.
+type outcome struct {
+	status     int
+	retryAfter string
+	cause      error
+}
+
+// fakeDoer answers the outcomes in order, the last one repeated, and records the bodies received.
+type fakeDoer struct {
+	outcomes []outcome
+	bodies   []string
+}
+
+func (d *fakeDoer) do(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		data, _ := ioutil.ReadAll(req.Body)
+		body = string(data)
+	}
+	d.bodies = append(d.bodies, body)
+	o := d.outcomes[len(d.outcomes)-1]
+	if len(d.bodies) <= len(d.outcomes) {
+		o = d.outcomes[len(d.bodies)-1]
+	}
+
+	if o.cause != nil {
+		return nil, errors.APIErrorWithScene(errors.ErrUnavailable, errors.Cause(o.cause))
+	}
+	if o.status == 0 {
+		return nil, errors.APIErrorWithScene(errors.ErrUnavailable, errors.Cause(io.ErrUnexpectedEOF))
+	}
+	resp := &http.Response{StatusCode: o.status, Header: make(http.Header), Body: ioutil.NopCloser(strings.NewReader(""))}
+	if o.retryAfter != "" {
+		resp.Header.Set("Retry-After", o.retryAfter)
+	}
+	if o.status < 300 {
+		return resp, nil
+	}
+	return resp, errors.NewAPIError(errors.NewCode(o.status, ""), errors.SubCodeZero)
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		key      string
+		outcomes []outcome
+		timeout  time.Duration
+		// noGetBody sends a body that cannot be read again
+		noGetBody    bool
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "success", method: http.MethodPost, outcomes: []outcome{{status: 201}}, wantAttempts: 1},
+		{name: "503 retried for any method", method: http.MethodPost, outcomes: []outcome{{status: 503}, {status: 201}}, wantAttempts: 2},
+		{name: "429 retried", method: http.MethodPost, outcomes: []outcome{{status: 429, retryAfter: "0"}, {status: 201}}, wantAttempts: 2},
+		{name: "500 retried when idempotent", method: http.MethodGet, outcomes: []outcome{{status: 500}, {status: 502}, {status: 200}}, wantAttempts: 3},
+		{name: "500 not retried for post", method: http.MethodPost, outcomes: []outcome{{status: 500}, {status: 201}}, wantAttempts: 1, wantErr: true},
+		{name: "500 retried for post with idempotency key", method: http.MethodPost, key: "k1", outcomes: []outcome{{status: 500}, {status: 201}}, wantAttempts: 2},
+		{name: "transport error retried when idempotent", method: http.MethodPut, outcomes: []outcome{{}, {status: 200}}, wantAttempts: 2},
+		{name: "transport error not retried for post", method: http.MethodPost, outcomes: []outcome{{}, {status: 201}}, wantAttempts: 1, wantErr: true},
+		{name: "4xx not retried", method: http.MethodGet, outcomes: []outcome{{status: 404}, {status: 200}}, wantAttempts: 1, wantErr: true},
+		{name: "max attempts", method: http.MethodGet, outcomes: []outcome{{status: 503}}, wantAttempts: 3, wantErr: true},
+		{name: "circuit open not retried", method: http.MethodGet, outcomes: []outcome{{cause: ErrCircuitOpen}, {status: 200}}, wantAttempts: 1, wantErr: true},
+		{name: "bulkhead full not retried", method: http.MethodGet, outcomes: []outcome{{cause: ErrBulkheadFull}, {status: 200}}, wantAttempts: 1, wantErr: true},
+		{name: "retry after over max", method: http.MethodGet, outcomes: []outcome{{status: 503, retryAfter: "60"}, {status: 200}}, wantAttempts: 1, wantErr: true},
+		{name: "retry after past the deadline", method: http.MethodGet, timeout: 500 * time.Millisecond, outcomes: []outcome{{status: 503, retryAfter: "1"}, {status: 200}}, wantAttempts: 1, wantErr: true},
+		{name: "body not rewindable", method: http.MethodPost, noGetBody: true, outcomes: []outcome{{status: 503}, {status: 201}}, wantAttempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			req, err := http.NewRequestWithContext(ctx, tt.method, "http://notes.internal/v1/notes", strings.NewReader("body"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.noGetBody {
+				req.GetBody = nil
+			}
+			if tt.key != "" {
+				req.Header.Set(idempotency.HeaderKey, tt.key)
+			}
+
+			doer := &fakeDoer{outcomes: tt.outcomes}
+			_, err = Retry(Backoff(0, 0), MaxRetryAfter(10*time.Second))(doer.do)(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(doer.bodies) != tt.wantAttempts {
+				t.Fatalf("attempts = %d, want %d", len(doer.bodies), tt.wantAttempts)
+			}
+			for i, body := range doer.bodies {
+				if body != "body" {
+					t.Fatalf("attempt %d: body = %q, want the request body again", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	conf := &retryConf{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		wantMax time.Duration
+	}{
+		{attempt: 1, wantMax: 100 * time.Millisecond},
+		{attempt: 2, wantMax: 200 * time.Millisecond},
+		{attempt: 4, wantMax: 800 * time.Millisecond},
+		{attempt: 5, wantMax: time.Second},
+		{attempt: 50, wantMax: time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := conf.backoff(tt.attempt); got < 0 || got > tt.wantMax {
+				t.Fatalf("backoff(%d) = %s, want within [0, %s]", tt.attempt, got, tt.wantMax)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "absent"},
+		{name: "seconds", value: "3", want: 3 * time.Second, wantOK: true},
+		{name: "negative", value: "-1"},
+		{name: "garbage", value: "soon"},
+		{name: "date in the past", value: "Fri, 15 May 2020 00:00:00 GMT", wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: make(http.Header)}
+			if tt.value != "" {
+				resp.Header.Set("Retry-After", tt.value)
+			}
+			got, ok := parseRetryAfter(resp)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("parseRetryAfter(%q) = %s, %v, want %s, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// a date ahead is waited for until then
+	resp := &http.Response{Header: http.Header{"Retry-After": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}}}
+	if got, ok := parseRetryAfter(resp); !ok || got <= 58*time.Second || got > time.Minute {
+		t.Fatalf("parseRetryAfter(date ahead) = %s, %v, want about 1m", got, ok)
+	}
+}
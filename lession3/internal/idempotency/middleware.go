@@ -0,0 +1,269 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/model"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/AfterShip/golang-common/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"k8s_learning/internal/auth"
+	"k8s_learning/internal/ginx"
+	"k8s_learning/internal/metrics"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+// ErrRequestTooLarge is the 41300 answered when the body of a request with an Idempotency-Key
+// is over MaxRequestBytes, it is read in memory to be hashed.
+var ErrRequestTooLarge = errors.NewAPIError(errors.NewCode(http.StatusRequestEntityTooLarge, "errors.request_entity_too_large"), errors.SubCodeZero)
+
+func init() {
+	model.AddStatusCodeDescriptions(map[int]model.StatusCodeDescription{
+		41300: {
+			TypeName: "RequestEntityTooLarge",
+			Message:  "The body of a request with an Idempotency-Key is larger than the server accepts.",
+		},
+	})
+}
+
+// replayedHeaders are the response headers stored with the body, the others
+// (rate limit, trace) belong to the retry and are set again by the middlewares.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location", "Link", "Last-Modified"}
+
+var requestsTotal = metrics.NewCounter(
+	"idempotency_requests_total",
+	"Number of requests carrying an Idempotency-Key by result: stored, released, replayed, in_flight, mismatch.",
+	"result",
+)
+
+type Option func(conf *conf)
+
+type conf struct {
+	methods          map[string]bool
+	ttl              time.Duration
+	lockTimeout      time.Duration
+	maxRequestBytes  int64
+	maxResponseBytes int
+}
+
+// Methods are the methods honoring the header, default POST and PATCH.
+func Methods(methods ...string) Option {
+	return func(conf *conf) {
+		conf.methods = make(map[string]bool, len(methods))
+		for _, method := range methods {
+			conf.methods[method] = true
+		}
+	}
+}
+
+// TTL is how long a response is replayed, default 24h.
+func TTL(ttl time.Duration) Option {
+	return func(conf *conf) {
+		conf.ttl = ttl
+	}
+}
+
+// LockTimeout bounds how long a request in flight holds its key, in case its replica dies, default 1m.
+func LockTimeout(timeout time.Duration) Option {
+	return func(conf *conf) {
+		conf.lockTimeout = timeout
+	}
+}
+
+// MaxRequestBytes is the largest body read to be hashed, a larger request is answered
+// ErrRequestTooLarge, default 1MiB.
+func MaxRequestBytes(n int64) Option {
+	return func(conf *conf) {
+		conf.maxRequestBytes = n
+	}
+}
+
+// MaxResponseBytes is the largest body stored, a larger response releases its key, default 1MiB.
+func MaxResponseBytes(n int) Option {
+	return func(conf *conf) {
+		conf.maxResponseBytes = n
+	}
+}
+
+// Middleware stores the response of the requests with an Idempotency-Key and replays it,
+// with Idempotent-Replayed: true, to the retries with the same key and the same request.
+// Keys are scoped by principal, so two clients never share one.
+// It answers errors.ErrConflict when the key is in flight or was used for another request.
+// 5xx responses and panics release the key, the retry then runs again.
+func Middleware(store Store, opts ...Option) gin.HandlerFunc {
+	conf := &conf{
+		methods:          map[string]bool{http.MethodPost: true, http.MethodPatch: true},
+		ttl:              24 * time.Hour,
+		lockTimeout:      time.Minute,
+		maxRequestBytes:  1 << 20,
+		maxResponseBytes: 1 << 20,
+	}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(HeaderKey)
+		if key == "" || !conf.methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		if len(key) > maxKeyLength {
+			ginx.ResponseValidationError(c, ginx.ValidationItem{
+				Path: HeaderKey,
+				Info: fmt.Sprintf("%s must be at most %d characters", HeaderKey, maxKeyLength),
+			})
+			return
+		}
+		if c.Request.ContentLength > conf.maxRequestBytes {
+			respondTooLarge(c, key, conf.maxRequestBytes)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, conf.maxRequestBytes))
+		if err != nil {
+			// MaxBytesReader hands out the limit before failing, a body of unknown length ends up here
+			if int64(len(body)) >= conf.maxRequestBytes {
+				respondTooLarge(c, key, conf.maxRequestBytes)
+				return
+			}
+			gins.ResponseAPIErrorWithLogging(c, ctx, errors.APIErrorWithScene(errors.ErrBadRequest, errors.Cause(err)))
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		storeKey := scope(c) + "|" + key
+		fingerprint := fingerprintOf(c.Request, body)
+		record, err := store.Begin(ctx, storeKey, fingerprint, conf.lockTimeout)
+		if err != nil {
+			gins.ResponseAPIErrorWithLogging(c, ctx, errors.APIErrorWithScene(errors.ErrUnavailable,
+				errors.Cause(err), errors.Field("idempotency_key", key)))
+			return
+		}
+		if record != nil {
+			respondExisting(c, key, fingerprint, record)
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			// a panic unwinds through here before Recovery answers, the retry must run again
+			if !completed {
+				release(c, store, storeKey)
+			}
+		}()
+		c.Next()
+
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError || writer.body.Len() > conf.maxResponseBytes {
+			return
+		}
+		record = &Record{Fingerprint: fingerprint, Done: true, Status: status, Header: make(http.Header), Body: writer.body.Bytes()}
+		for _, name := range replayedHeaders {
+			for _, value := range c.Writer.Header().Values(name) {
+				record.Header.Add(name, value)
+			}
+		}
+		if err := store.Complete(ctx, storeKey, record, conf.ttl); err != nil {
+			logger.Warn(ctx, "[WARNING] idempotency store failed, response not stored",
+				zap.String("category", "idempotency"), zap.String("idempotency_key", key), zap.Error(err))
+			return
+		}
+		completed = true
+		requestsTotal.With("stored").Inc()
+	}
+}
+
+// respondExisting replays a done record of the same request, or answers errors.ErrConflict.
+func respondExisting(c *gin.Context, key, fingerprint string, record *Record) {
+	var info, result string
+	switch {
+	case record.Fingerprint != fingerprint:
+		info, result = HeaderKey+" was already used for another request", "mismatch"
+	case !record.Done:
+		info, result = "the first request with this "+HeaderKey+" is still in flight, retry later", "in_flight"
+		c.Header("Retry-After", "1")
+	default:
+		requestsTotal.With("replayed").Inc()
+		header := c.Writer.Header()
+		for name, values := range record.Header {
+			header[name] = values
+		}
+		header.Set(HeaderReplayed, "true")
+		c.Status(record.Status)
+		c.Writer.Write(record.Body)
+		c.Abort()
+		return
+	}
+	requestsTotal.With(result).Inc()
+	gins.ResponseAPIErrorWithLogging(c, c.Request.Context(), errors.APIErrorWithScene(errors.ErrConflict,
+		errors.Items(ginx.ValidationItem{Path: HeaderKey, Info: info}),
+		errors.Field("idempotency_key", key),
+		errors.Stack(errors.SmallerStacktrace(2, 1)),
+	))
+}
+
+func respondTooLarge(c *gin.Context, key string, limit int64) {
+	gins.ResponseAPIErrorWithLogging(c, c.Request.Context(), errors.APIErrorWithScene(ErrRequestTooLarge,
+		errors.Field("idempotency_key", key),
+		errors.Field("max_request_bytes", limit),
+		errors.Stack(errors.SmallerStacktrace(2, 1)),
+	))
+}
+
+func release(c *gin.Context, store Store, storeKey string) {
+	requestsTotal.With("released").Inc()
+	if err := store.Release(c.Request.Context(), storeKey); err != nil {
+		logger.Warn(c.Request.Context(), "[WARNING] idempotency store failed, key held until its lock timeout",
+			zap.String("category", "idempotency"), zap.Error(err))
+	}
+}
+
+// scope is the principal subject, anonymous requests share one scope.
+func scope(c *gin.Context) string {
+	if principal, ok := auth.PrincipalFromContext(c.Request.Context()); ok {
+		return principal.Method + ":" + principal.Subject
+	}
+	return "anonymous"
+}
+
+// fingerprintOf hashes what makes two requests the same: method, path, query and body.
+func fingerprintOf(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.RequestURI())
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the body written by the handler.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
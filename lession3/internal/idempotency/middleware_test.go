@@ -0,0 +1,178 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// call is a request to POST /v1/notes and what is expected of it.
+type call struct {
+	key  string
+	body string
+	// handlerStatus is answered by the handler, it panics on 0
+	handlerStatus int
+	wantStatus    int
+	wantReplayed  bool
+	// wantCalls is the number of times the handler ran so far
+	wantCalls int
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "retry replayed",
+			calls: []call{
+				{key: "k1", body: `{"a":1}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantCalls: 1},
+				{key: "k1", body: `{"a":1}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantReplayed: true, wantCalls: 1},
+			},
+		},
+		{
+			name: "4xx replayed",
+			calls: []call{
+				{key: "k1", body: `{}`, handlerStatus: http.StatusUnprocessableEntity, wantStatus: http.StatusUnprocessableEntity, wantCalls: 1},
+				{key: "k1", body: `{}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusUnprocessableEntity, wantReplayed: true, wantCalls: 1},
+			},
+		},
+		{
+			name: "key reused for another request",
+			calls: []call{
+				{key: "k1", body: `{"a":1}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantCalls: 1},
+				{key: "k1", body: `{"a":2}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusConflict, wantCalls: 1},
+			},
+		},
+		{
+			name: "different keys run",
+			calls: []call{
+				{key: "k1", body: `{}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantCalls: 1},
+				{key: "k2", body: `{}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantCalls: 2},
+			},
+		},
+		{
+			name: "no key",
+			calls: []call{
+				{body: `{}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantCalls: 1},
+				{body: `{}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantCalls: 2},
+			},
+		},
+		{
+			name: "5xx releases the key",
+			calls: []call{
+				{key: "k1", body: `{}`, handlerStatus: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable, wantCalls: 1},
+				{key: "k1", body: `{}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantCalls: 2},
+			},
+		},
+		{
+			name: "panic releases the key",
+			calls: []call{
+				{key: "k1", body: `{}`, wantStatus: http.StatusInternalServerError, wantCalls: 1},
+				{key: "k1", body: `{}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantCalls: 2},
+			},
+		},
+		{
+			name: "key too long",
+			calls: []call{
+				{key: strings.Repeat("k", maxKeyLength+1), body: `{}`, handlerStatus: http.StatusCreated, wantStatus: http.StatusUnprocessableEntity},
+			},
+		},
+		{
+			name: "body too large",
+			calls: []call{
+				{key: "k1", body: strings.Repeat("a", 65), handlerStatus: http.StatusCreated, wantStatus: http.StatusRequestEntityTooLarge},
+				{key: "k1", body: strings.Repeat("a", 64), handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantCalls: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			var status int
+			engine := gin.New()
+			engine.Use(func(c *gin.Context) {
+				defer func() {
+					if recover() != nil {
+						c.AbortWithStatus(http.StatusInternalServerError)
+					}
+				}()
+				c.Next()
+			})
+			engine.Use(Middleware(NewMemoryStore(), MaxRequestBytes(64)))
+			engine.POST("/v1/notes", func(c *gin.Context) {
+				calls++
+				if status == 0 {
+					panic("handler failed")
+				}
+				c.Header("Location", "/v1/notes/"+strconv.Itoa(calls))
+				c.JSON(status, gin.H{"call": calls})
+			})
+
+			var first *httptest.ResponseRecorder
+			for i, call := range tt.calls {
+				status = call.handlerStatus
+				req := httptest.NewRequest(http.MethodPost, "/v1/notes", strings.NewReader(call.body))
+				if call.key != "" {
+					req.Header.Set(HeaderKey, call.key)
+				}
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, req)
+				if w.Code != call.wantStatus {
+					t.Fatalf("request %d: status = %d, want %d (body %s)", i, w.Code, call.wantStatus, w.Body)
+				}
+				if calls != call.wantCalls {
+					t.Fatalf("request %d: handler ran %d times, want %d", i, calls, call.wantCalls)
+				}
+				if got := w.Header().Get(HeaderReplayed) == "true"; got != call.wantReplayed {
+					t.Fatalf("request %d: replayed = %v, want %v", i, got, call.wantReplayed)
+				}
+				if call.wantReplayed {
+					if w.Body.String() != first.Body.String() || w.Header().Get("Location") != first.Header().Get("Location") {
+						t.Fatalf("request %d: replayed %q %q, want %q %q", i,
+							w.Header().Get("Location"), w.Body, first.Header().Get("Location"), first.Body)
+					}
+				}
+				if i == 0 {
+					first = w
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareInFlight(t *testing.T) {
+	store := NewMemoryStore()
+	req := httptest.NewRequest(http.MethodPost, "/v1/notes", strings.NewReader(`{}`))
+	req.Header.Set(HeaderKey, "k1")
+	// the first request with the key is still running
+	if _, err := store.Begin(context.Background(), "anonymous|k1", fingerprintOf(req, []byte(`{}`)), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	engine := gin.New()
+	engine.Use(Middleware(store))
+	engine.POST("/v1/notes", func(c *gin.Context) { calls++ })
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("Retry-After missing")
+	}
+	if calls != 0 {
+		t.Fatalf("handler ran %d times, want 0", calls)
+	}
+}
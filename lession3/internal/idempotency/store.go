@@ -0,0 +1,188 @@
+// Package idempotency makes unsafe requests safe to retry: the first response to an
+// Idempotency-Key is stored and replayed to the retries of the same request.
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	stderrors "errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Record is what a Store keeps per key.
+type Record struct {
+	// Fingerprint identifies the request that took the key, see Middleware
+	Fingerprint string
+	// Done is false while the first request is in flight
+	Done   bool
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store keeps the records, eg. in memory or in redis for keys shared by the replicas.
+type Store interface {
+	// Begin takes key for the request of fingerprint until ttl, atomically.
+	// It returns nil when key was free, otherwise the record holding it.
+	Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Record, error)
+	// Complete stores the response of the request holding key, it is replayed until ttl.
+	Complete(ctx context.Context, key string, record *Record, ttl time.Duration) error
+	// Release frees key, the next request with it runs as a first one.
+	Release(ctx context.Context, key string) error
+}
+
+// ErrStoreFull is returned by the MemoryStore when every key it holds is in flight.
+var ErrStoreFull = stderrors.New("idempotency: store full of requests in flight")
+
+type MemoryStoreOption func(s *MemoryStore)
+
+// MaxKeys bounds the number of keys, the least recently used done key is evicted to make room,
+// keys in flight never are, default 100000.
+func MaxKeys(n int) MemoryStoreOption {
+	return func(s *MemoryStore) {
+		s.maxKeys = n
+	}
+}
+
+// SweepInterval is how often expired keys are dropped, default 1m.
+func SweepInterval(interval time.Duration) MemoryStoreOption {
+	return func(s *MemoryStore) {
+		s.sweepInterval = interval
+	}
+}
+
+// MemoryStore is a Store local to the process, a retry landing on another replica runs again.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// inFlight holds the *memoryEntry values not done yet, most recently begun first
+	inFlight *list.List
+	// done holds the *memoryEntry values done, most recently used first
+	done          *list.List
+	maxKeys       int
+	sweepInterval time.Duration
+	lastSweep     time.Time
+}
+
+type memoryEntry struct {
+	key     string
+	record  Record
+	expires time.Time
+}
+
+func NewMemoryStore(opts ...MemoryStoreOption) *MemoryStore {
+	s := &MemoryStore{
+		entries:       make(map[string]*list.Element),
+		inFlight:      list.New(),
+		done:          list.New(),
+		maxKeys:       100000,
+		sweepInterval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *MemoryStore) Begin(_ context.Context, key, fingerprint string, ttl time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// sweeping on the request path avoids a goroutine to stop
+	if now.Sub(s.lastSweep) >= s.sweepInterval {
+		s.sweep(now)
+	}
+	if elem, ok := s.entries[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		if now.Before(entry.expires) {
+			if entry.record.Done {
+				s.done.MoveToFront(elem)
+			}
+			record := entry.record
+			return &record, nil
+		}
+		s.remove(elem)
+	}
+	if err := s.makeRoom(now); err != nil {
+		return nil, err
+	}
+	entry := &memoryEntry{key: key, record: Record{Fingerprint: fingerprint}, expires: now.Add(ttl)}
+	s.entries[key] = s.inFlight.PushFront(entry)
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(_ context.Context, key string, record *Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+	if err := s.makeRoom(now); err != nil {
+		return err
+	}
+	entry := &memoryEntry{key: key, record: *record, expires: now.Add(ttl)}
+	if record.Done {
+		s.entries[key] = s.done.PushFront(entry)
+	} else {
+		s.entries[key] = s.inFlight.PushFront(entry)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+	return nil
+}
+
+// Len is the number of keys held, expired ones included until the next sweep.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// makeRoom frees a key when the store is full, evicting the least recently used done key.
+func (s *MemoryStore) makeRoom(now time.Time) error {
+	if len(s.entries) < s.maxKeys {
+		return nil
+	}
+	s.sweep(now)
+	for len(s.entries) >= s.maxKeys && s.done.Len() > 0 {
+		s.remove(s.done.Back())
+	}
+	if len(s.entries) >= s.maxKeys {
+		return ErrStoreFull
+	}
+	return nil
+}
+
+// sweep drops the expired keys from the least recently used end of both lists, up to the
+// first live one. Keys in flight share the lock timeout so they expire in order; a done key
+// replayed lately may keep expired ones behind it until it expires or is evicted.
+func (s *MemoryStore) sweep(now time.Time) {
+	for _, l := range []*list.List{s.inFlight, s.done} {
+		for elem := l.Back(); elem != nil && !now.Before(elem.Value.(*memoryEntry).expires); elem = l.Back() {
+			s.remove(elem)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (s *MemoryStore) remove(elem *list.Element) {
+	entry := elem.Value.(*memoryEntry)
+	if entry.record.Done {
+		s.done.Remove(elem)
+	} else {
+		s.inFlight.Remove(elem)
+	}
+	delete(s.entries, entry.key)
+}
@@ -0,0 +1,198 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		// run acts on a fresh store, the record then returned by Begin on key is checked
+		run             func(s *MemoryStore) error
+		wantNil         bool
+		wantDone        bool
+		wantBody        string
+		wantFingerprint string
+	}{
+		{
+			name:    "free key",
+			run:     func(s *MemoryStore) error { return nil },
+			wantNil: true,
+		},
+		{
+			name: "held by a request in flight",
+			run: func(s *MemoryStore) error {
+				_, err := s.Begin(ctx, "key", "first", time.Minute)
+				return err
+			},
+			wantFingerprint: "first",
+		},
+		{
+			name: "completed",
+			run: func(s *MemoryStore) error {
+				if _, err := s.Begin(ctx, "key", "first", time.Minute); err != nil {
+					return err
+				}
+				return s.Complete(ctx, "key", &Record{Fingerprint: "first", Done: true, Status: 201, Body: []byte("created")}, time.Hour)
+			},
+			wantFingerprint: "first",
+			wantDone:        true,
+			wantBody:        "created",
+		},
+		{
+			name: "released",
+			run: func(s *MemoryStore) error {
+				if _, err := s.Begin(ctx, "key", "first", time.Minute); err != nil {
+					return err
+				}
+				return s.Release(ctx, "key")
+			},
+			wantNil: true,
+		},
+		{
+			name: "lock expired",
+			run: func(s *MemoryStore) error {
+				_, err := s.Begin(ctx, "key", "first", -time.Second)
+				return err
+			},
+			wantNil: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			if err := tt.run(store); err != nil {
+				t.Fatal(err)
+			}
+			record, err := store.Begin(ctx, "key", "second", time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantNil {
+				if record != nil {
+					t.Fatalf("Begin() = %+v, want nil", record)
+				}
+				return
+			}
+			if record == nil {
+				t.Fatal("Begin() = nil, want the record holding the key")
+			}
+			if record.Fingerprint != tt.wantFingerprint || record.Done != tt.wantDone || string(record.Body) != tt.wantBody {
+				t.Fatalf("Begin() = %+v, want fingerprint %q, done %v, body %q", record, tt.wantFingerprint, tt.wantDone, tt.wantBody)
+			}
+		})
+	}
+}
+
+// held lists which of keys the store holds, in the order given.
+func held(s *MemoryStore, keys ...string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var got []string
+	for _, key := range keys {
+		if _, ok := s.entries[key]; ok {
+			got = append(got, key)
+		}
+	}
+	return got
+}
+
+func done(fingerprint string) *Record {
+	return &Record{Fingerprint: fingerprint, Done: true, Status: 201}
+}
+
+func TestMemoryStoreBounded(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(MaxKeys(100))
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if _, err := store.Begin(ctx, key, "fingerprint", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Complete(ctx, key, done("fingerprint"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := store.Len(); got != 100 {
+		t.Fatalf("Len() = %d, want 100", got)
+	}
+	if got := held(store, "key-0", "key-899", "key-900", "key-999"); !reflect.DeepEqual(got, []string{"key-900", "key-999"}) {
+		t.Fatalf("held %v, want the 100 latest keys", got)
+	}
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(MaxKeys(3))
+	for _, key := range []string{"a", "b", "c"} {
+		if err := store.Complete(ctx, key, done(key), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a replay makes "a" recently used, "b" is now the least recently used
+	if record, err := store.Begin(ctx, "a", "a", time.Minute); err != nil || record == nil {
+		t.Fatalf("Begin(a) = %v, %v, want the done record", record, err)
+	}
+	if _, err := store.Begin(ctx, "d", "d", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := held(store, "a", "b", "c", "d"); !reflect.DeepEqual(got, []string{"a", "c", "d"}) {
+		t.Fatalf("held %v, want b evicted", got)
+	}
+}
+
+func TestMemoryStoreKeepsInFlight(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(MaxKeys(2))
+	for _, key := range []string{"x", "y"} {
+		if _, err := store.Begin(ctx, key, key, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Begin(ctx, "z", "z", time.Minute); err != ErrStoreFull {
+		t.Fatalf("Begin() with every key in flight error = %v, want ErrStoreFull", err)
+	}
+	if err := store.Complete(ctx, "z", done("z"), time.Hour); err != ErrStoreFull {
+		t.Fatalf("Complete() of a new key with every key in flight error = %v, want ErrStoreFull", err)
+	}
+	if got := held(store, "x", "y", "z"); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Fatalf("held %v, want the keys in flight", got)
+	}
+
+	// completing a key in flight takes its own slot
+	if err := store.Complete(ctx, "x", done("x"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// the done key goes, never the one in flight
+	if _, err := store.Begin(ctx, "z", "z", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := held(store, "x", "y", "z"); !reflect.DeepEqual(got, []string{"y", "z"}) {
+		t.Fatalf("held %v, want x evicted", got)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(MaxKeys(2), SweepInterval(time.Hour))
+	if _, err := store.Begin(ctx, "stale", "stale", -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Complete(ctx, "expired", done("expired"), -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// full of expired keys, both make room before anything live is evicted
+	for _, key := range []string{"a", "b"} {
+		if _, err := store.Begin(ctx, key, key, time.Minute); err != nil {
+			t.Fatalf("Begin(%s) error = %v", key, err)
+		}
+	}
+	if got := held(store, "stale", "expired", "a", "b"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("held %v, want the expired keys swept", got)
+	}
+}
@@ -0,0 +1,265 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AfterShip/golang-common/http/server/health"
+	"github.com/AfterShip/golang-common/logger"
+	"go.uber.org/zap"
+
+	"k8s_learning/internal/tracing"
+)
+
+const (
+	defaultPropagationDelay = 5 * time.Second
+	defaultShutdownTimeout  = 20 * time.Second
+)
+
+// Component is a long-lived background part of the binary, eg. a worker or a scheduler.
+// Start must not block; components are started in registration order and stopped in reverse.
+// Their transitions and errors are recorded in tracing.ComponentEvents(Name()), where the
+// component can add its own events.
+type Component interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+type Option func(m *Manager)
+
+// HealthStatus is flipped to Offline on shutdown, so that the readiness probe fails before the
+// listeners stop accepting connections, and to Online once every listener is bound when
+// OnlineWhenServing is set. Until then it keeps its default status.
+func HealthStatus(status *health.Status) Option {
+	return func(m *Manager) {
+		m.status = status
+	}
+}
+
+// OnlineWhenServing flips the HealthStatus to Online once the components are started and every
+// listener is bound. Without it the status stays at its default until set through /devops/status.
+func OnlineWhenServing(online bool) Option {
+	return func(m *Manager) {
+		m.onlineWhenServing = online
+	}
+}
+
+// PropagationDelay is how long to keep serving after going Offline,
+// giving kube-proxy and the load balancer time to remove the pod from the endpoints.
+func PropagationDelay(d time.Duration) Option {
+	return func(m *Manager) {
+		m.propagationDelay = d
+	}
+}
+
+// ShutdownTimeout bounds http.Server.Shutdown plus the stop of all components.
+func ShutdownTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.shutdownTimeout = d
+	}
+}
+
+// Signals overrides the signals that trigger a graceful shutdown, default SIGTERM and SIGINT.
+func Signals(signals ...os.Signal) Option {
+	return func(m *Manager) {
+		m.signals = signals
+	}
+}
+
+type namedServer struct {
+	name   string
+	server *http.Server
+}
+
+// Manager owns the http servers and background components of the binary
+// and drives them through start, drain and stop.
+type Manager struct {
+	status            *health.Status
+	onlineWhenServing bool
+	propagationDelay  time.Duration
+	shutdownTimeout   time.Duration
+	signals           []os.Signal
+
+	servers    []namedServer
+	components []Component
+}
+
+// New creates a Manager with options.
+func New(opts ...Option) *Manager {
+	m := &Manager{
+		propagationDelay: defaultPropagationDelay,
+		shutdownTimeout:  defaultShutdownTimeout,
+		signals:          []os.Signal{syscall.SIGTERM, syscall.SIGINT},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *Manager) AddServer(name string, server *http.Server) {
+	m.servers = append(m.servers, namedServer{name: name, server: server})
+}
+
+func (m *Manager) Register(component Component) {
+	m.components = append(m.components, component)
+}
+
+// Run starts components and servers, blocks until a signal arrives, ctx is done
+// or a server fails, then drains and stops everything.
+// The returned error is the server failure or the first error met while shutting down.
+func (m *Manager) Run(ctx context.Context) error {
+	started, err := m.startComponents(ctx)
+	if err != nil {
+		m.stopComponents(ctx, started)
+		return err
+	}
+
+	listeners, err := m.listen()
+	if err != nil {
+		m.stopComponents(ctx, started)
+		return err
+	}
+	serverErrs := make(chan error, len(m.servers))
+	for i, s := range m.servers {
+		go func(s namedServer, ln net.Listener) {
+			logger.Info(ctx, "[lifecycle] http server listening", zap.String("server", s.name), zap.String("addr", ln.Addr().String()))
+			if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+				serverErrs <- fmt.Errorf("http server %s: %w", s.name, err)
+			}
+		}(s, listeners[i])
+	}
+	if m.status != nil && m.onlineWhenServing {
+		m.status.Online()
+		logger.Info(ctx, "[lifecycle] health status online")
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, m.signals...)
+	defer signal.Stop(sigCh)
+
+	var runErr error
+	select {
+	case sig := <-sigCh:
+		logger.Info(ctx, "[lifecycle] received signal, shutting down", zap.String("signal", sig.String()))
+	case <-ctx.Done():
+		logger.Info(ctx, "[lifecycle] context done, shutting down", zap.Error(ctx.Err()))
+	case runErr = <-serverErrs:
+		logger.Error(ctx, "[lifecycle] http server failed, shutting down", zap.Error(runErr))
+	}
+
+	// 1. fail readiness first, and keep serving while the endpoints are removed
+	if m.status != nil {
+		m.status.Offline()
+		logger.Info(ctx, "[lifecycle] health status offline")
+	}
+	if runErr == nil && m.propagationDelay > 0 {
+		logger.Info(ctx, "[lifecycle] waiting for endpoints propagation", zap.Duration("delay", m.propagationDelay))
+		select {
+		case <-time.After(m.propagationDelay):
+		case sig := <-sigCh:
+			logger.Warn(ctx, "[lifecycle] received second signal, skip propagation delay", zap.String("signal", sig.String()))
+		}
+	}
+
+	// 2. drain in-flight requests, then stop components, all within one deadline
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+
+	if err := m.shutdownServers(shutdownCtx); err != nil && runErr == nil {
+		runErr = err
+	}
+	if err := m.stopComponents(shutdownCtx, m.components); err != nil && runErr == nil {
+		runErr = err
+	}
+	logger.Info(ctx, "[lifecycle] shutdown completed")
+	return runErr
+}
+
+// shutdownServers drains every server at once, so that a slow drain does not use up the deadline
+// of the others, which would keep accepting connections meanwhile. It returns the first error
+// in registration order.
+func (m *Manager) shutdownServers(ctx context.Context) error {
+	errs := make([]error, len(m.servers))
+	var wg sync.WaitGroup
+	for i, s := range m.servers {
+		wg.Add(1)
+		go func(i int, s namedServer) {
+			defer wg.Done()
+			logger.Info(ctx, "[lifecycle] shutting down http server", zap.String("server", s.name))
+			if err := s.server.Shutdown(ctx); err != nil {
+				logger.Error(ctx, "[lifecycle] shutdown http server failed", zap.String("server", s.name), zap.Error(err))
+				errs[i] = fmt.Errorf("shutdown http server %s: %w", s.name, err)
+			}
+		}(i, s)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listen binds every server, so that a port already in use fails Run before going online.
+func (m *Manager) listen() ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(m.servers))
+	for _, s := range m.servers {
+		addr := s.server.Addr
+		if addr == "" {
+			addr = ":http"
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("http server %s: %w", s.name, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+func (m *Manager) startComponents(ctx context.Context) ([]Component, error) {
+	started := make([]Component, 0, len(m.components))
+	for _, c := range m.components {
+		events := tracing.ComponentEvents(c.Name())
+		events.Transition("starting", nil)
+		if err := c.Start(ctx); err != nil {
+			events.Transition("failed", err)
+			return started, fmt.Errorf("start component %s: %w", c.Name(), err)
+		}
+		events.Transition("running", nil)
+		started = append(started, c)
+	}
+	return started, nil
+}
+
+// stopComponents stops components in reverse start order and returns the first error.
+func (m *Manager) stopComponents(ctx context.Context, components []Component) error {
+	var firstErr error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		events := tracing.ComponentEvents(c.Name())
+		events.Transition("stopping", nil)
+		if err := c.Stop(ctx); err != nil {
+			events.Transition("failed", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("stop component %s: %w", c.Name(), err)
+			}
+			continue
+		}
+		events.Transition("stopped", nil)
+	}
+	return firstErr
+}
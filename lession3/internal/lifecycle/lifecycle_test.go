@@ -0,0 +1,123 @@
+package lifecycle
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AfterShip/golang-common/http/server/health"
+
+	"k8s_learning/internal/healthz"
+)
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+// waitServing polls addr until it accepts connections.
+func waitServing(t *testing.T, addr string) {
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s not serving", addr)
+}
+
+func TestRunOnlineWhenServing(t *testing.T) {
+	tests := []struct {
+		name       string
+		online     bool
+		wantStatus int
+	}{
+		{name: "online once bound", online: true, wantStatus: http.StatusOK},
+		{name: "default status kept", online: false, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := health.NewStatus()
+			m := New(HealthStatus(status), OnlineWhenServing(tt.online), PropagationDelay(0))
+			addr := freeAddr(t)
+			m.AddServer("api", &http.Server{Addr: addr, Handler: http.NotFoundHandler()})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- m.Run(ctx) }()
+			waitServing(t, addr)
+			// Online is called right after the listeners are bound
+			time.Sleep(10 * time.Millisecond)
+			got := healthz.StatusCode(status)
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got != tt.wantStatus {
+				t.Fatalf("status while serving = %d, want %d", got, tt.wantStatus)
+			}
+			if got := healthz.StatusCode(status); got != http.StatusServiceUnavailable {
+				t.Fatalf("status after shutdown = %d, want %d", got, http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+func TestRunPortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	status := health.NewStatus()
+	m := New(HealthStatus(status), OnlineWhenServing(true), PropagationDelay(0))
+	m.AddServer("api", &http.Server{Addr: freeAddr(t)})
+	m.AddServer("admin", &http.Server{Addr: ln.Addr().String()})
+	if err := m.Run(context.Background()); err == nil {
+		t.Fatal("Run() error = nil, want the bind error")
+	}
+	if got := healthz.StatusCode(status); got != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+}
+
+func TestShutdownServersConcurrently(t *testing.T) {
+	slowAddr, otherAddr := freeAddr(t), freeAddr(t)
+	started := make(chan struct{})
+	slow := &http.Server{Addr: slowAddr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(500 * time.Millisecond)
+	})}
+	m := New(PropagationDelay(0), ShutdownTimeout(5*time.Second))
+	m.AddServer("slow", slow)
+	m.AddServer("other", &http.Server{Addr: otherAddr, Handler: http.NotFoundHandler()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	waitServing(t, slowAddr)
+	waitServing(t, otherAddr)
+	go http.Get("http://" + slowAddr)
+	<-started
+	cancel()
+
+	// the other server stops accepting while the slow one is still draining
+	time.Sleep(100 * time.Millisecond)
+	if conn, err := net.Dial("tcp", otherAddr); err == nil {
+		conn.Close()
+		t.Fatal("other server still accepting while the slow one drains")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
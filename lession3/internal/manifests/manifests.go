@@ -0,0 +1,303 @@
+// Package manifests renders the Kubernetes objects of the web service from its config,
+// so ports, probes and the shutdown budget always match the binary.
+package manifests
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"k8s_learning/internal/config"
+)
+
+const (
+	configMountDir  = "/etc/web"
+	configFileName  = "config.yaml"
+	gracePeriodSlop = 5
+)
+
+// Options are the deployment knobs that are not part of the service config.
+type Options struct {
+	Name      string
+	Namespace string
+	Image     string
+	Tag       string
+	Replicas  int
+
+	CPURequest    string
+	CPULimit      string
+	MemoryRequest string
+	MemoryLimit   string
+
+	ServiceType string
+	ServicePort int
+
+	// MaxReplicas 0 renders no HorizontalPodAutoscaler, the Deployment then runs Replicas
+	MinReplicas          int
+	MaxReplicas          int
+	TargetCPUUtilization int
+	PDBMinAvailable      int
+}
+
+// Validate reports the first invalid option.
+func (o Options) Validate() error {
+	switch {
+	case o.Name == "":
+		return fmt.Errorf("name is required")
+	case o.Image == "" || o.Tag == "":
+		return fmt.Errorf("image and tag are required")
+	case o.Replicas < 0:
+		return fmt.Errorf("replicas must not be negative, got %d", o.Replicas)
+	case o.MaxReplicas > 0 && (o.MinReplicas < 1 || o.MaxReplicas < o.MinReplicas):
+		return fmt.Errorf("hpa replicas must satisfy 1 <= min <= max, got min %d max %d", o.MinReplicas, o.MaxReplicas)
+	case o.MaxReplicas > 0 && (o.TargetCPUUtilization < 1 || o.TargetCPUUtilization > 100):
+		return fmt.Errorf("target cpu utilization must be in [1, 100], got %d", o.TargetCPUUtilization)
+	case o.PDBMinAvailable < 0:
+		return fmt.Errorf("pdb min available must not be negative, got %d", o.PDBMinAvailable)
+	}
+	return nil
+}
+
+type templateData struct {
+	Options
+	Config *config.Config
+	// ConfigYAML is the config without its secrets, which come from the Secret through WEB_* env
+	ConfigYAML                    string
+	Secrets                       []config.Secret
+	ConfigPath                    string
+	ConfigMountDir                string
+	TerminationGracePeriodSeconds int
+}
+
+// Render writes the ConfigMap, the Secret when the config holds secrets, Deployment, Service,
+// HorizontalPodAutoscaler and PodDisruptionBudget as one multi-document YAML stream.
+// The Deployment sets no replicas when the HorizontalPodAutoscaler is rendered, so that
+// applying the manifests again does not reset the scale.
+func Render(w io.Writer, opts Options, cfg *config.Config) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	configYAML, err := cfg.PublicYAML()
+	if err != nil {
+		return err
+	}
+	// the pod must outlive the propagation delay plus the drain, or kubelet SIGKILLs it mid-drain
+	grace := int(math.Ceil((cfg.Shutdown.PropagationDelay + cfg.Shutdown.Timeout).Seconds())) + gracePeriodSlop
+
+	return manifestsTemplate.Execute(w, templateData{
+		Options:                       opts,
+		Config:                        cfg,
+		ConfigYAML:                    string(configYAML),
+		Secrets:                       cfg.Secrets(),
+		ConfigPath:                    configMountDir + "/" + configFileName,
+		ConfigMountDir:                configMountDir,
+		TerminationGracePeriodSeconds: grace,
+	})
+}
+
+var manifestsTemplate = template.Must(template.New("manifests").Funcs(template.FuncMap{
+	"indent": func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.Replace(strings.TrimRight(s, "\n"), "\n", "\n"+pad, -1)
+	},
+	"quote": strconv.Quote,
+}).Parse(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}-config
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .Name }}
+data:
+  config.yaml: |
+{{ indent 4 .ConfigYAML }}
+---
+{{- if .Secrets }}
+apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ .Name }}-secrets
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .Name }}
+type: Opaque
+stringData:
+{{- range .Secrets }}
+  {{ .EnvKey }}: {{ quote .Value }}
+{{- end }}
+---
+{{- end }}
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .Name }}
+spec:
+{{- if eq .MaxReplicas 0 }}
+  replicas: {{ .Replicas }}
+{{- end }}
+  selector:
+    matchLabels:
+      app: {{ .Name }}
+  strategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 1
+      maxUnavailable: 0
+  template:
+    metadata:
+      labels:
+        app: {{ .Name }}
+        version: "{{ .Tag }}"
+      annotations:
+        prometheus.io/scrape: "true"
+        prometheus.io/port: "{{ .Config.Admin.Port }}"
+        prometheus.io/path: /metrics
+    spec:
+      terminationGracePeriodSeconds: {{ .TerminationGracePeriodSeconds }}
+      containers:
+        - name: {{ .Name }}
+          image: "{{ .Image }}:{{ .Tag }}"
+          imagePullPolicy: IfNotPresent
+          env:
+            - name: WEB_CONFIG
+              value: {{ .ConfigPath }}
+{{- range .Secrets }}
+            - name: {{ .EnvKey }}
+              valueFrom:
+                secretKeyRef:
+                  name: {{ $.Name }}-secrets
+                  key: {{ .EnvKey }}
+{{- end }}
+            - name: POD_NAME
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.name
+            - name: POD_NAMESPACE
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.namespace
+            - name: POD_IP
+              valueFrom:
+                fieldRef:
+                  fieldPath: status.podIP
+            - name: NODE_NAME
+              valueFrom:
+                fieldRef:
+                  fieldPath: spec.nodeName
+            - name: POD_SERVICE_ACCOUNT
+              valueFrom:
+                fieldRef:
+                  fieldPath: spec.serviceAccountName
+          ports:
+            - name: http
+              containerPort: {{ .Config.Server.Port }}
+              protocol: TCP
+            - name: admin
+              containerPort: {{ .Config.Admin.Port }}
+              protocol: TCP
+          startupProbe:
+            httpGet:
+              path: /startupz
+              port: admin
+            periodSeconds: 2
+            failureThreshold: 30
+          readinessProbe:
+            httpGet:
+              path: /readyz
+              port: admin
+            periodSeconds: 5
+            failureThreshold: 2
+          livenessProbe:
+            httpGet:
+              path: /livez
+              port: admin
+            periodSeconds: 10
+            failureThreshold: 3
+          resources:
+            requests:
+              cpu: {{ .CPURequest }}
+              memory: {{ .MemoryRequest }}
+            limits:
+              cpu: {{ .CPULimit }}
+              memory: {{ .MemoryLimit }}
+          volumeMounts:
+            - name: config
+              mountPath: {{ .ConfigMountDir }}
+              readOnly: true
+            - name: podinfo
+              mountPath: {{ .Config.Pod.InfoDir }}
+              readOnly: true
+      volumes:
+        - name: config
+          configMap:
+            name: {{ .Name }}-config
+        - name: podinfo
+          downwardAPI:
+            items:
+              - path: labels
+                fieldRef:
+                  fieldPath: metadata.labels
+              - path: annotations
+                fieldRef:
+                  fieldPath: metadata.annotations
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Name }}
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .Name }}
+spec:
+  type: {{ .ServiceType }}
+  selector:
+    app: {{ .Name }}
+  ports:
+    - name: http
+      port: {{ .ServicePort }}
+      targetPort: http
+      protocol: TCP
+{{- if gt .MaxReplicas 0 }}
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: {{ .Name }}
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .Name }}
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: {{ .Name }}
+  minReplicas: {{ .MinReplicas }}
+  maxReplicas: {{ .MaxReplicas }}
+  metrics:
+    - type: Resource
+      resource:
+        name: cpu
+        target:
+          type: Utilization
+          averageUtilization: {{ .TargetCPUUtilization }}
+{{- end }}
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: {{ .Name }}
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .Name }}
+spec:
+  minAvailable: {{ .PDBMinAvailable }}
+  selector:
+    matchLabels:
+      app: {{ .Name }}
+`))
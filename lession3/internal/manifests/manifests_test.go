@@ -0,0 +1,194 @@
+package manifests
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"k8s_learning/internal/config"
+)
+
+// object holds the fields of the rendered objects the tests look at.
+type object struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	StringData map[string]string `yaml:"stringData"`
+	Spec       struct {
+		Replicas *int `yaml:"replicas"`
+		Template struct {
+			Spec struct {
+				TerminationGracePeriodSeconds int `yaml:"terminationGracePeriodSeconds"`
+				Containers                    []struct {
+					Env []struct {
+						Name      string `yaml:"name"`
+						Value     string `yaml:"value"`
+						ValueFrom struct {
+							SecretKeyRef struct {
+								Name string `yaml:"name"`
+								Key  string `yaml:"key"`
+							} `yaml:"secretKeyRef"`
+						} `yaml:"valueFrom"`
+					} `yaml:"env"`
+				} `yaml:"containers"`
+			} `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+func testOptions() Options {
+	return Options{
+		Name:          "web",
+		Namespace:     "default",
+		Image:         "web",
+		Tag:           "v1",
+		Replicas:      3,
+		CPURequest:    "100m",
+		CPULimit:      "500m",
+		MemoryRequest: "64Mi",
+		MemoryLimit:   "256Mi",
+		ServiceType:   "ClusterIP",
+		ServicePort:   80,
+	}
+}
+
+// render returns the decoded objects by kind, and the raw documents by kind.
+func render(t *testing.T, opts Options, cfg *config.Config) (map[string]string, map[string]object) {
+	var buf bytes.Buffer
+	if err := Render(&buf, opts, cfg); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	docs := strings.Split(buf.String(), "\n---\n")
+	raw := make(map[string]string, len(docs))
+	objects := make(map[string]object, len(docs))
+	for _, doc := range docs {
+		var obj object
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			t.Fatalf("document is not YAML: %v\n%s", err, doc)
+		}
+		if _, ok := objects[obj.Kind]; ok || obj.Kind == "" {
+			t.Fatalf("kind %q rendered twice or empty:\n%s", obj.Kind, buf.String())
+		}
+		raw[obj.Kind] = doc
+		objects[obj.Kind] = obj
+	}
+	return raw, objects
+}
+
+func kinds(objects map[string]object) []string {
+	var kinds []string
+	for _, kind := range []string{"ConfigMap", "Secret", "Deployment", "Service", "HorizontalPodAutoscaler", "PodDisruptionBudget"} {
+		if _, ok := objects[kind]; ok {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+func TestRenderSecrets(t *testing.T) {
+	const (
+		hmacSecret   = "hmac-secret-value"
+		cursorSecret = "cursor-secret-value"
+	)
+	cfg := config.Default()
+	cfg.Auth.JWT.HMACSecret = hmacSecret
+	cfg.Pagination.CursorSecret = cursorSecret
+
+	docs, objects := render(t, testOptions(), cfg)
+	for kind, doc := range docs {
+		for _, secret := range []string{hmacSecret, cursorSecret} {
+			if strings.Contains(doc, secret) && kind != "Secret" {
+				t.Errorf("%s holds the secret %q", kind, secret)
+			}
+		}
+	}
+
+	wantData := map[string]string{
+		"WEB_AUTH_JWT_HMAC_SECRET":     hmacSecret,
+		"WEB_PAGINATION_CURSOR_SECRET": cursorSecret,
+	}
+	if got := objects["Secret"].StringData; !reflect.DeepEqual(got, wantData) {
+		t.Errorf("Secret stringData = %v, want %v", got, wantData)
+	}
+	refs := make(map[string]string)
+	for _, env := range objects["Deployment"].Spec.Template.Spec.Containers[0].Env {
+		if ref := env.ValueFrom.SecretKeyRef; ref.Name != "" {
+			if ref.Name != "web-secrets" || ref.Key != env.Name {
+				t.Errorf("env %s refers to %s/%s, want web-secrets/%s", env.Name, ref.Name, ref.Key, env.Name)
+			}
+			refs[env.Name] = ref.Key
+		}
+	}
+	if len(refs) != len(wantData) {
+		t.Errorf("Deployment env from the Secret = %v, want every key of %v", refs, wantData)
+	}
+
+	_, objects = render(t, testOptions(), config.Default())
+	if _, ok := objects["Secret"]; ok {
+		t.Error("Secret rendered without secrets in the config")
+	}
+}
+
+func TestRenderReplicas(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxReplicas  int
+		wantReplicas *int
+		wantKinds    []string
+	}{
+		{
+			name:         "fixed scale",
+			wantReplicas: func() *int { n := 3; return &n }(),
+			wantKinds:    []string{"ConfigMap", "Deployment", "Service", "PodDisruptionBudget"},
+		},
+		{
+			name:        "autoscaled",
+			maxReplicas: 5,
+			wantKinds:   []string{"ConfigMap", "Deployment", "Service", "HorizontalPodAutoscaler", "PodDisruptionBudget"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			if tt.maxReplicas > 0 {
+				opts.MinReplicas, opts.MaxReplicas, opts.TargetCPUUtilization = 2, tt.maxReplicas, 70
+			}
+			_, objects := render(t, opts, config.Default())
+			if got := kinds(objects); !reflect.DeepEqual(got, tt.wantKinds) {
+				t.Fatalf("kinds = %v, want %v", got, tt.wantKinds)
+			}
+			if got := objects["Deployment"].Spec.Replicas; !reflect.DeepEqual(got, tt.wantReplicas) {
+				t.Errorf("Deployment replicas = %v, want %v", got, tt.wantReplicas)
+			}
+		})
+	}
+}
+
+func TestRenderTerminationGracePeriod(t *testing.T) {
+	tests := []struct {
+		name             string
+		propagationDelay time.Duration
+		timeout          time.Duration
+		want             int
+	}{
+		{name: "whole seconds", propagationDelay: 5 * time.Second, timeout: 20 * time.Second, want: 30},
+		{name: "rounded up", propagationDelay: 1500 * time.Millisecond, timeout: 2 * time.Second, want: 9},
+		{name: "no propagation delay", timeout: 10 * time.Second, want: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Shutdown.PropagationDelay = tt.propagationDelay
+			cfg.Shutdown.Timeout = tt.timeout
+			_, objects := render(t, testOptions(), cfg)
+			if got := objects["Deployment"].Spec.Template.Spec.TerminationGracePeriodSeconds; got != tt.want {
+				t.Errorf("terminationGracePeriodSeconds = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+)
+
+// Counter is a monotonically increasing metric family.
+type Counter struct {
+	*vec
+}
+
+// CounterSeries is the counter of one set of label values.
+type CounterSeries struct {
+	value atomicFloat
+}
+
+// NewCounter creates a counter and registers it in DefaultRegistry.
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	c := NewUnregisteredCounter(name, help, labelNames...)
+	DefaultRegistry.MustRegister(c)
+	return c
+}
+
+func NewUnregisteredCounter(name, help string, labelNames ...string) *Counter {
+	return &Counter{vec: newVec(name, help, labelNames, func() interface{} {
+		return &CounterSeries{}
+	})}
+}
+
+// With returns the series of the label values, in the order of the label names.
+func (c *Counter) With(labelValues ...string) *CounterSeries {
+	return c.with(labelValues).(*CounterSeries)
+}
+
+func (s *CounterSeries) Inc() {
+	s.value.Add(1)
+}
+
+// Add panics when delta is negative, use a Gauge for values that go down.
+func (s *CounterSeries) Add(delta float64) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter can not decrease, delta %v", delta))
+	}
+	s.value.Add(delta)
+}
+
+func (s *CounterSeries) Value() float64 {
+	return s.value.Load()
+}
+
+func (c *Counter) Write(w io.Writer) error {
+	if err := c.writeHeader(w, "counter"); err != nil {
+		return err
+	}
+	return c.each(func(values []string, series interface{}) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(values, ""), formatFloat(series.(*CounterSeries).Value()))
+		return err
+	})
+}
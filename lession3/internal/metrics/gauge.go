@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+)
+
+// Gauge is a metric family whose values go up and down.
+type Gauge struct {
+	*vec
+}
+
+// GaugeSeries is the gauge of one set of label values.
+type GaugeSeries struct {
+	value atomicFloat
+}
+
+// NewGauge creates a gauge and registers it in DefaultRegistry.
+func NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := NewUnregisteredGauge(name, help, labelNames...)
+	DefaultRegistry.MustRegister(g)
+	return g
+}
+
+func NewUnregisteredGauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{vec: newVec(name, help, labelNames, func() interface{} {
+		return &GaugeSeries{}
+	})}
+}
+
+// With returns the series of the label values, in the order of the label names.
+func (g *Gauge) With(labelValues ...string) *GaugeSeries {
+	return g.with(labelValues).(*GaugeSeries)
+}
+
+func (s *GaugeSeries) Set(v float64) {
+	s.value.Set(v)
+}
+
+func (s *GaugeSeries) Add(delta float64) {
+	s.value.Add(delta)
+}
+
+func (s *GaugeSeries) Inc() {
+	s.value.Add(1)
+}
+
+func (s *GaugeSeries) Dec() {
+	s.value.Add(-1)
+}
+
+func (s *GaugeSeries) Value() float64 {
+	return s.value.Load()
+}
+
+func (g *Gauge) Write(w io.Writer) error {
+	if err := g.writeHeader(w, "gauge"); err != nil {
+		return err
+	}
+	return g.each(func(values []string, series interface{}) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", g.name, g.labels(values, ""), formatFloat(series.(*GaugeSeries).Value()))
+		return err
+	})
+}
+
+// GaugeFunc is a label-less gauge whose value is read at scrape time.
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc creates a gauge func and registers it in DefaultRegistry.
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help}, fn: fn}
+	DefaultRegistry.MustRegister(g)
+	return g
+}
+
+func (g *GaugeFunc) Write(w io.Writer) error {
+	if err := g.writeHeader(w, "gauge"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+	return err
+}
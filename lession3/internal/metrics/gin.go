@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/ginx"
+)
+
+var (
+	httpRequestsTotal = NewCounter(
+		"http_requests_total",
+		"Number of http requests by route template, method and response meta.code.",
+		"route", "method", "code",
+	)
+	httpRequestDuration = NewHistogram(
+		"http_request_duration_seconds",
+		"Latency of http requests by route template and method.",
+		DefBuckets,
+		"route", "method",
+	)
+	httpRequestsInFlight = NewGauge(
+		"http_requests_in_flight",
+		"Number of http requests being served.",
+	)
+	apiErrorsTotal = NewCounter(
+		"api_errors_total",
+		"Number of API errors logged by gins.APIErrorLogging, by main and sub code.",
+		"main_code", "sub_code",
+	)
+)
+
+func init() {
+	DefaultRegistry.MustRegister(NewRuntimeCollector())
+}
+
+// Middleware records the request count and latency of every request by route template,
+// requests that hit no route are grouped under ginx.UnmatchedRoute.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		inFlight := httpRequestsInFlight.With()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		c.Next()
+
+		route, method := ginx.Route(c), c.Request.Method
+		httpRequestsTotal.With(route, method, strconv.Itoa(ginx.MetaCode(c))).Inc()
+		httpRequestDuration.With(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// CountAPIErrors wraps an APIErrorLoggerFunc, usually gins.GlobalAPIErrorLoggerFunc,
+// to count the logged errors:
+//
+//	gins.GlobalAPIErrorLoggerFunc = metrics.CountAPIErrors(gins.GlobalAPIErrorLoggerFunc)
+func CountAPIErrors(next gins.APIErrorLoggerFunc) gins.APIErrorLoggerFunc {
+	return func(ginCtx *gin.Context, ctx context.Context, apiError *errors.APIError) {
+		apiErrorsTotal.With(
+			strconv.Itoa(apiError.MainCode().Code()),
+			strconv.Itoa(apiError.SubCode().Code()),
+		).Inc()
+		if next != nil {
+			next(ginCtx, ctx, apiError)
+		}
+	}
+}
+
+// RegisterHandler mounts DefaultRegistry on /metrics.
+func RegisterHandler(engine *gin.Engine) {
+	engine.GET("/metrics", gin.WrapF(DefaultRegistry.HttpHandlerFunc()))
+}
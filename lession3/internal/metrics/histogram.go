@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// DefBuckets are the default latency buckets in seconds, the same as client_golang's.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into buckets.
+type Histogram struct {
+	*vec
+	buckets []float64
+}
+
+// HistogramSeries is the histogram of one set of label values.
+type HistogramSeries struct {
+	// counts[i] is the number of observations in (buckets[i-1], buckets[i]], the last one is +Inf
+	counts []uint64
+	sum    atomicFloat
+	upper  []float64
+}
+
+// NewHistogram creates a histogram and registers it in DefaultRegistry, nil buckets means DefBuckets.
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := NewUnregisteredHistogram(name, help, buckets, labelNames...)
+	DefaultRegistry.MustRegister(h)
+	return h
+}
+
+func NewUnregisteredHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	upper := append([]float64(nil), buckets...)
+	sort.Float64s(upper)
+	h := &Histogram{buckets: upper}
+	h.vec = newVec(name, help, labelNames, func() interface{} {
+		return &HistogramSeries{
+			counts: make([]uint64, len(upper)+1),
+			upper:  upper,
+		}
+	})
+	return h
+}
+
+// With returns the series of the label values, in the order of the label names.
+func (h *Histogram) With(labelValues ...string) *HistogramSeries {
+	return h.with(labelValues).(*HistogramSeries)
+}
+
+func (s *HistogramSeries) Observe(v float64) {
+	i := sort.SearchFloat64s(s.upper, v)
+	atomic.AddUint64(&s.counts[i], 1)
+	s.sum.Add(v)
+}
+
+func (h *Histogram) Write(w io.Writer) error {
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+	return h.each(func(values []string, series interface{}) error {
+		s := series.(*HistogramSeries)
+		var cumulative uint64
+		for i := range s.counts {
+			upper := math.Inf(1)
+			if i < len(s.upper) {
+				upper = s.upper[i]
+			}
+			cumulative += atomic.LoadUint64(&s.counts[i])
+			le := fmt.Sprintf(`le="%s"`, formatFloat(upper))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(values, le), cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(values, ""), formatFloat(s.sum.Load())); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(values, ""), cumulative)
+		return err
+	})
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestRegistryWriteGolden(t *testing.T) {
+	registry := NewRegistry()
+
+	requests := NewUnregisteredCounter("http_requests_total", "Requests served,\nby \\ route.", "route", "code")
+	requests.With(`/v1/notes/"id"`, "200").Add(3)
+	requests.With("/v1/a\\b\nc", "500").Inc()
+	registry.MustRegister(requests)
+
+	latency := NewUnregisteredHistogram("http_request_duration_seconds", "Request latency.", []float64{0.1, 0.5}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+		latency.With("/v1/notes").Observe(v)
+	}
+	registry.MustRegister(latency)
+
+	inflight := NewUnregisteredGauge("http_requests_in_flight", "Requests being served.")
+	inflight.With().Set(math.Inf(1))
+	registry.MustRegister(inflight)
+
+	var buf bytes.Buffer
+	if err := registry.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `# HELP http_request_duration_seconds Request latency.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{route="/v1/notes",le="0.1"} 2
+http_request_duration_seconds_bucket{route="/v1/notes",le="0.5"} 3
+http_request_duration_seconds_bucket{route="/v1/notes",le="+Inf"} 4
+http_request_duration_seconds_sum{route="/v1/notes"} 2.45
+http_request_duration_seconds_count{route="/v1/notes"} 4
+# HELP http_requests_in_flight Requests being served.
+# TYPE http_requests_in_flight gauge
+http_requests_in_flight +Inf
+# HELP http_requests_total Requests served,\nby \\ route.
+# TYPE http_requests_total counter
+http_requests_total{route="/v1/a\\b\nc",code="500"} 1
+http_requests_total{route="/v1/notes/\"id\"",code="200"} 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", got, want)
+	}
+}
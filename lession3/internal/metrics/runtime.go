@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// runtimeCollector exposes the usual go_* and process_start_time_seconds families,
+// read from runtime.MemStats at scrape time.
+type runtimeCollector struct {
+	startTime time.Time
+}
+
+// NewRuntimeCollector returns the Go runtime collector, register it once per registry.
+func NewRuntimeCollector() Collector {
+	return &runtimeCollector{startTime: time.Now()}
+}
+
+func (c *runtimeCollector) Name() string {
+	return "go_runtime"
+}
+
+func (c *runtimeCollector) Write(w io.Writer) error {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	families := []struct {
+		name, help, typ string
+		value           float64
+	}{
+		{"go_goroutines", "Number of goroutines that currently exist.", "gauge", float64(runtime.NumGoroutine())},
+		{"go_threads", "Number of OS threads created.", "gauge", float64(threads)},
+		{"go_gomaxprocs", "Value of GOMAXPROCS.", "gauge", float64(runtime.GOMAXPROCS(0))},
+		{"go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "gauge", float64(ms.Alloc)},
+		{"go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", "counter", float64(ms.TotalAlloc)},
+		{"go_memstats_sys_bytes", "Number of bytes obtained from system.", "gauge", float64(ms.Sys)},
+		{"go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", "gauge", float64(ms.HeapInuse)},
+		{"go_memstats_heap_objects", "Number of allocated objects.", "gauge", float64(ms.HeapObjects)},
+		{"go_memstats_next_gc_bytes", "Number of heap bytes when next garbage collection will take place.", "gauge", float64(ms.NextGC)},
+		{"go_gc_cycles_total", "Number of completed GC cycles.", "counter", float64(ms.NumGC)},
+		{"go_gc_pause_seconds_total", "Total GC stop-the-world pause time.", "counter", float64(ms.PauseTotalNs) / 1e9},
+		{"process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "gauge", float64(c.startTime.UnixNano()) / 1e9},
+	}
+	for _, f := range families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", f.name, f.help, f.name, f.typ, f.name, formatFloat(f.value)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "# HELP go_info Information about the Go environment.\n# TYPE go_info gauge\ngo_info{version=\"%s\"} 1\n", escapeLabelValue(runtime.Version()))
+	return err
+}
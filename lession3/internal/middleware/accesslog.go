@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/AfterShip/golang-common/logger"
+	"github.com/AfterShip/golang-common/security"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"k8s_learning/internal/ginx"
+)
+
+type AccessLogOption func(conf *accessLogConf)
+
+type accessLogConf struct {
+	sampleRate       float64
+	routeSampleRates map[string]float64
+	skipRoutes       map[string]bool
+	headers          bool
+}
+
+// SampleRate is the share of successful requests logged, in [0, 1], default 1.
+// Requests answered with a 5xx are always logged.
+func SampleRate(rate float64) AccessLogOption {
+	return func(conf *accessLogConf) {
+		conf.sampleRate = rate
+	}
+}
+
+// RouteSampleRates overrides SampleRate by route template, eg. {"/v1/notes/:id": 0.1}.
+func RouteSampleRates(rates map[string]float64) AccessLogOption {
+	return func(conf *accessLogConf) {
+		for route, rate := range rates {
+			conf.routeSampleRates[route] = rate
+		}
+	}
+}
+
+// SkipRoutes never logs the given route templates, eg. probes and /metrics.
+func SkipRoutes(routes ...string) AccessLogOption {
+	return func(conf *accessLogConf) {
+		for _, route := range routes {
+			conf.skipRoutes[route] = true
+		}
+	}
+}
+
+// LogHeaders adds the request headers, without the sensitive ones of security.
+func LogHeaders(enabled bool) AccessLogOption {
+	return func(conf *accessLogConf) {
+		conf.headers = enabled
+	}
+}
+
+// AccessLog emits one structured line per request through logger,
+// the trace ID is added by the logger hook from the request context.
+func AccessLog(opts ...AccessLogOption) gin.HandlerFunc {
+	conf := &accessLogConf{
+		sampleRate:       1,
+		routeSampleRates: make(map[string]float64),
+		skipRoutes:       make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := ginx.Route(c)
+		if conf.skipRoutes[route] {
+			return
+		}
+		status := c.Writer.Status()
+		if status < 500 {
+			rate, ok := conf.routeSampleRates[route]
+			if !ok {
+				rate = conf.sampleRate
+			}
+			if rate < 1 && rand.Float64() >= rate {
+				return
+			}
+		}
+
+		metaCode := ginx.MetaCode(c)
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		fields := []zapcore.Field{
+			zap.String("category", "http_access"),
+			zap.String("route", route),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.EscapedPath()),
+			zap.String("request_query_string", c.Request.URL.RawQuery),
+			zap.Int("status", status),
+			zap.Int("meta_code", metaCode),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("bytes", size),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+		}
+		if conf.headers {
+			headerMap := make(map[string]string, len(c.Request.Header))
+			for key, values := range c.Request.Header {
+				if !security.IsSensitiveHeaderKey(key) {
+					headerMap[key] = strings.Join(values, ",")
+				}
+			}
+			fields = append(fields, zap.Any("request_header", headerMap))
+		}
+
+		logger.Info(
+			c.Request.Context(),
+			fmt.Sprintf("%s %s %d %d", c.Request.Method, c.Request.URL.EscapedPath(), status, metaCode),
+			fields...,
+		)
+	}
+}
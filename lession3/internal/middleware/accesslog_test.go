@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/AfterShip/golang-common/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// logSink collects the JSON lines written through logger.
+type logSink struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *logSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+// lines returns the decoded lines whose category is category.
+func (s *logSink) lines(t *testing.T, category string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var lines []map[string]interface{}
+	for _, raw := range bytes.Split(bytes.TrimSpace(s.buf.Bytes()), []byte("\n")) {
+		if len(raw) == 0 {
+			continue
+		}
+		var line map[string]interface{}
+		if err := json.Unmarshal(raw, &line); err != nil {
+			t.Fatalf("log line %q: %v", raw, err)
+		}
+		if line["category"] == category {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// captureLogs routes logger to a sink for the duration of the test.
+func captureLogs(t *testing.T) *logSink {
+	sink := &logSink{}
+	previous := logger.GetZapLogger()
+	encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	logger.SetZapLogger(zap.New(zapcore.NewCore(encoder, zapcore.AddSync(sink), zapcore.DebugLevel)))
+	t.Cleanup(func() { logger.SetZapLogger(previous) })
+	return sink
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []AccessLogOption
+		status  int
+		wantLog bool
+	}{
+		{name: "logged by default", status: http.StatusOK, wantLog: true},
+		{name: "success sampled out", opts: []AccessLogOption{SampleRate(0)}, status: http.StatusOK},
+		{name: "client error sampled out", opts: []AccessLogOption{SampleRate(0)}, status: http.StatusNotFound},
+		{name: "server error always logged", opts: []AccessLogOption{SampleRate(0)}, status: http.StatusServiceUnavailable, wantLog: true},
+		{
+			name:    "route rate overrides",
+			opts:    []AccessLogOption{SampleRate(0), RouteSampleRates(map[string]float64{"/v1/notes/:id": 1})},
+			status:  http.StatusOK,
+			wantLog: true,
+		},
+		{
+			name:   "route rate sampled out",
+			opts:   []AccessLogOption{RouteSampleRates(map[string]float64{"/v1/notes/:id": 0})},
+			status: http.StatusOK,
+		},
+		{
+			name:   "skipped route",
+			opts:   []AccessLogOption{SkipRoutes("/v1/notes/:id")},
+			status: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := captureLogs(t)
+			engine := gin.New()
+			engine.Use(AccessLog(tt.opts...))
+			engine.GET("/v1/notes/:id", func(c *gin.Context) { c.Status(tt.status) })
+			engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/notes/1?full=1", nil))
+
+			lines := sink.lines(t, "http_access")
+			if got := len(lines) == 1; got != tt.wantLog {
+				t.Fatalf("logged %d lines, want logged %v", len(lines), tt.wantLog)
+			}
+			if !tt.wantLog {
+				return
+			}
+			line := lines[0]
+			for key, want := range map[string]interface{}{
+				"route":                "/v1/notes/:id",
+				"path":                 "/v1/notes/1",
+				"request_query_string": "full=1",
+				"status":               float64(tt.status),
+			} {
+				if line[key] != want {
+					t.Errorf("%s = %v, want %v", key, line[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestAccessLogHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		want    map[string]interface{}
+	}{
+		{name: "off"},
+		{name: "sensitive headers dropped", enabled: true, want: map[string]interface{}{"X-Custom": "a,b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := captureLogs(t)
+			engine := gin.New()
+			engine.Use(AccessLog(LogHeaders(tt.enabled)))
+			engine.GET("/v1", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+			req := httptest.NewRequest(http.MethodGet, "/v1", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			req.Header.Set("am-api-key", "key")
+			req.Header.Set("aftership-api-key", "key")
+			req.Header.Add("X-Custom", "a")
+			req.Header.Add("X-Custom", "b")
+			engine.ServeHTTP(httptest.NewRecorder(), req)
+
+			lines := sink.lines(t, "http_access")
+			if len(lines) != 1 {
+				t.Fatalf("logged %d lines, want 1", len(lines))
+			}
+			got, ok := lines[0]["request_header"]
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("request_header = %v, want none", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("request_header = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/ginx"
+	"k8s_learning/internal/tracing"
+)
+
+// InboundDeadline sets the deadline of the request context from the X-Request-Timeout budget
+// of the caller, clamped to max so a caller cannot hold the service longer than it allows.
+// A spent budget is answered errors.ErrDeadlineExceeded without running the handler, the
+// caller has given up already. Requests without the header keep the deadlines of Timeout.
+// Like Timeout, it hands the original request back to the middlewares before it.
+func InboundDeadline(max time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.GetHeader(tracing.HeaderRequestTimeout)
+		if value == "" {
+			c.Next()
+			return
+		}
+		budget, err := tracing.ParseRequestTimeout(value)
+		if err != nil {
+			ginx.ResponseValidationError(c, ginx.ValidationItem{
+				Path: tracing.HeaderRequestTimeout,
+				Info: tracing.HeaderRequestTimeout + " must be a non-negative integer of milliseconds",
+			})
+			return
+		}
+		if budget == 0 {
+			gins.ResponseAPIErrorWithLogging(c, c.Request.Context(), errors.APIErrorWithScene(errors.ErrDeadlineExceeded,
+				errors.Cause(context.DeadlineExceeded),
+				errors.Field("request_timeout", value),
+				errors.Stack(errors.SmallerStacktrace(2, 1)),
+			))
+			return
+		}
+		if max > 0 && budget > max {
+			budget = max
+		}
+
+		original := c.Request
+		ctx, cancel := context.WithTimeout(c.Request.Context(), budget)
+		defer cancel()
+		defer func() { c.Request = restoreRequest(original, c.Request) }()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/tracing"
+)
+
+func TestInboundDeadline(t *testing.T) {
+	const max = time.Minute
+	tests := []struct {
+		name       string
+		value      string
+		wantStatus int
+		wantCode   int
+		// wantBudget is the time left to the deadline seen by the handler, 0 for no deadline
+		wantBudget time.Duration
+	}{
+		{name: "no header", wantStatus: http.StatusOK, wantCode: 20000},
+		{name: "budget", value: "1500", wantStatus: http.StatusOK, wantCode: 20000, wantBudget: 1500 * time.Millisecond},
+		{name: "clamped", value: "3600000", wantStatus: http.StatusOK, wantCode: 20000, wantBudget: max},
+		{name: "overflowing clamped", value: "9223372036854775807", wantStatus: http.StatusOK, wantCode: 20000, wantBudget: max},
+		{name: "spent", value: "0", wantStatus: http.StatusGatewayTimeout, wantCode: 50400},
+		{name: "not a number", value: "1s", wantStatus: http.StatusUnprocessableEntity, wantCode: 42200},
+		{name: "negative", value: "-1", wantStatus: http.StatusUnprocessableEntity, wantCode: 42200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				ran    bool
+				budget time.Duration
+			)
+			engine := gin.New()
+			engine.Use(func(c *gin.Context) {
+				original := c.Request
+				c.Next()
+				// error answers carry the error on a new request, with the same context otherwise
+				if c.Request != original && tt.wantStatus == http.StatusOK {
+					t.Error("request not restored")
+				}
+				if err := c.Request.Context().Err(); err != nil {
+					t.Errorf("context of the restored request: %v", err)
+				}
+			}, InboundDeadline(max))
+			engine.GET("/v1", func(c *gin.Context) {
+				ran = true
+				if deadline, ok := c.Request.Context().Deadline(); ok {
+					budget = time.Until(deadline)
+				}
+				c.JSON(http.StatusOK, gin.H{"meta": gin.H{"code": 20000}})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1", nil)
+			if tt.value != "" {
+				req.Header.Set(tracing.HeaderRequestTimeout, tt.value)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var body struct {
+				Meta struct {
+					Code int `json:"code"`
+				} `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q: %v", w.Body, err)
+			}
+			if body.Meta.Code != tt.wantCode {
+				t.Fatalf("meta code = %d, want %d", body.Meta.Code, tt.wantCode)
+			}
+			if ran != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("handler ran = %v with status %d", ran, w.Code)
+			}
+			if budget > tt.wantBudget || budget < tt.wantBudget-time.Second {
+				t.Errorf("budget = %s, want about %s", budget, tt.wantBudget)
+			}
+		})
+	}
+}
@@ -0,0 +1,2 @@
+// Package middleware holds the gin middlewares of the public API engine.
+package middleware
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/AfterShip/golang-common/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const panicStackDepth = 32
+
+// PanicReporter is called for every recovered panic, eg. to forward it to an error tracker.
+// stack is the same multi-line stack as the one in the APIError scene.
+type PanicReporter func(c *gin.Context, recovered interface{}, stack string)
+
+type RecoveryOption func(conf *recoveryConf)
+
+type recoveryConf struct {
+	reporters []PanicReporter
+}
+
+// OnPanic adds a reporter, reporters run before the response is written.
+func OnPanic(reporter PanicReporter) RecoveryOption {
+	return func(conf *recoveryConf) {
+		conf.reporters = append(conf.reporters, reporter)
+	}
+}
+
+// Recovery replaces gin.Recovery: a panic becomes an errors.ErrInternalError with the
+// panic stack in its scene, answered with the model.ResponseBody envelope and logged
+// through gins.ResponseAPIErrorWithLogging.
+// http.ErrAbortHandler is re-panicked for net/http to abort the connection, and a
+// broken pipe only logs a warning as nobody is left to read the response.
+func Recovery(opts ...RecoveryOption) gin.HandlerFunc {
+	conf := &recoveryConf{}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			ctx := c.Request.Context()
+			err, ok := recovered.(error)
+			if !ok {
+				err = fmt.Errorf("panic: %v", recovered)
+			}
+			if isBrokenPipe(err) {
+				logger.Warn(ctx, "[WARNING] client connection lost", zap.String("category", "http_panic"), zap.Error(err))
+				c.Abort()
+				return
+			}
+
+			stack := panicStack(3, panicStackDepth)
+			for _, reporter := range conf.reporters {
+				reporter(c, recovered, stack)
+			}
+
+			apiErr := errors.APIErrorWithScene(errors.ErrInternalError,
+				errors.Cause(err),
+				errors.Stack(stack),
+				errors.Field("panic", fmt.Sprint(recovered)),
+			)
+			if c.Writer.Written() {
+				// too late for the envelope, the status line and part of the body are gone
+				c.Abort()
+				if gins.GlobalAPIErrorLoggerFunc != nil {
+					gins.GlobalAPIErrorLoggerFunc(c, ctx, apiErr)
+				}
+				return
+			}
+			gins.ResponseAPIErrorWithLogging(c, ctx, apiErr)
+		}()
+		c.Next()
+	}
+}
+
+// isBrokenPipe tells whether the client went away while the response was being written.
+func isBrokenPipe(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	syscallErr, ok := opErr.Err.(*os.SyscallError)
+	if !ok {
+		return false
+	}
+	msg := strings.ToLower(syscallErr.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
+
+// panicStack formats frames the way errors.SmallerStacktrace does, one "file func line" per line,
+// skipping the runtime frames of the panic itself.
+func panicStack(skip, depth int) string {
+	callers := make([]uintptr, depth)
+	n := runtime.Callers(skip, callers)
+	frames := runtime.CallersFrames(callers[:n])
+	var lines []string
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			fn := frame.Function[strings.LastIndex(frame.Function, "/")+1:]
+			lines = append(lines, fmt.Sprintf("%s %s %d", frame.File, fn, frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
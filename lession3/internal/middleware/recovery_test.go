@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func brokenPipe(errno syscall.Errno) error {
+	return &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", errno)}
+}
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		// wantStatus and wantBody of the response, wantBody empty for the envelope of wantCode
+		wantStatus int
+		wantCode   int
+		wantBody   string
+		// wantReported is whether OnPanic reporters run, wantLog the category logged
+		wantReported bool
+		wantLog      string
+	}{
+		{
+			name:         "panic answered 500",
+			handler:      func(c *gin.Context) { panic("boom") },
+			wantStatus:   http.StatusInternalServerError,
+			wantCode:     50000,
+			wantReported: true,
+			wantLog:      "http_response_error",
+		},
+		{
+			name:         "error panic answered 500",
+			handler:      func(c *gin.Context) { panic(errors.New("boom")) },
+			wantStatus:   http.StatusInternalServerError,
+			wantCode:     50000,
+			wantReported: true,
+			wantLog:      "http_response_error",
+		},
+		{
+			name: "response already started",
+			handler: func(c *gin.Context) {
+				c.String(http.StatusOK, "partial")
+				panic("boom")
+			},
+			wantStatus:   http.StatusOK,
+			wantBody:     "partial",
+			wantReported: true,
+			wantLog:      "http_response_error",
+		},
+		{
+			name:       "broken pipe",
+			handler:    func(c *gin.Context) { panic(brokenPipe(syscall.EPIPE)) },
+			wantStatus: http.StatusOK,
+			wantLog:    "http_panic",
+		},
+		{
+			name:       "connection reset",
+			handler:    func(c *gin.Context) { panic(brokenPipe(syscall.ECONNRESET)) },
+			wantStatus: http.StatusOK,
+			wantLog:    "http_panic",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := captureLogs(t)
+			var reportedStack string
+			reported := false
+			engine := gin.New()
+			engine.Use(Recovery(OnPanic(func(c *gin.Context, recovered interface{}, stack string) {
+				reported = true
+				reportedStack = stack
+			})))
+			engine.GET("/v1", tt.handler)
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantCode != 0 {
+				var body struct {
+					Meta struct {
+						Code int `json:"code"`
+					} `json:"meta"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("body %q: %v", w.Body, err)
+				}
+				if body.Meta.Code != tt.wantCode {
+					t.Fatalf("meta code = %d, want %d", body.Meta.Code, tt.wantCode)
+				}
+			} else if got := w.Body.String(); got != tt.wantBody {
+				t.Fatalf("body = %q, want %q", got, tt.wantBody)
+			}
+			if reported != tt.wantReported {
+				t.Fatalf("reported = %v, want %v", reported, tt.wantReported)
+			}
+			if reported && !strings.Contains(reportedStack, "recovery_test.go") {
+				t.Errorf("stack does not start at the panicking handler:\n%s", reportedStack)
+			}
+			if lines := sink.lines(t, tt.wantLog); len(lines) != 1 {
+				t.Errorf("logged %d %s lines, want 1", len(lines), tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	engine := gin.New()
+	engine.Use(Recovery(OnPanic(func(c *gin.Context, recovered interface{}, stack string) {
+		t.Error("reporter called for http.ErrAbortHandler")
+	})))
+	engine.GET("/v1", func(c *gin.Context) { panic(http.ErrAbortHandler) })
+
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Fatalf("recovered %v, want http.ErrAbortHandler re-panicked for net/http", recovered)
+		}
+	}()
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1", nil))
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	commontracing "github.com/AfterShip/golang-common/tracing"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/ginx"
+	"k8s_learning/internal/tracing"
+)
+
+// RequestTrace opens a golang.org/x/net/trace trace per request, the family being the route
+// template and the title the method and path, so /debug/requests of the admin listener shows
+// the live and recent traffic. It runs after TraceContext to annotate the trace ID; the status,
+// meta.code and APIError JSON are added once the handler returned, 4xx and 5xx being filed as errors.
+// Handlers add events with tracing.LazyPrintf(ctx, ...).
+func RequestTrace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, tr := tracing.NewRequestTrace(c.Request.Context(), ginx.Route(c), c.Request.Method+" "+c.Request.URL.Path)
+		defer tr.Finish()
+		if traceID := commontracing.GetTraceIDFromContext(ctx); traceID != "" {
+			tr.LazyPrintf("trace_id %s", traceID)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		tr.LazyPrintf("status %d, meta_code %d", status, ginx.MetaCode(c))
+		if apiErr := commontracing.GetTaskProcessErrorFromContext(c.Request.Context()); apiErr != nil {
+			tr.LazyPrintf("error %s", apiErr)
+		}
+		if status >= 400 {
+			tr.SetError()
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/model"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/AfterShip/golang-common/tracing"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/ginx"
+	"k8s_learning/internal/metrics"
+)
+
+var (
+	requestTimeoutsTotal = metrics.NewCounter(
+		"http_request_timeouts_total",
+		"Number of requests answered 504 by the Timeout middleware, by route template.",
+		"route",
+	)
+	requestDeadlineOverrun = metrics.NewHistogram(
+		"http_request_deadline_overrun_seconds",
+		"How long handlers kept running past their deadline, by route template.",
+		metrics.DefBuckets,
+		"route",
+	)
+)
+
+func init() {
+	// golang-common maps context.DeadlineExceeded to 504 but has no description for its meta code
+	model.AddStatusCodeDescriptions(map[int]model.StatusCodeDescription{
+		50400: {
+			TypeName: "DeadlineExceeded",
+			Message:  "The request did not complete within its deadline, it may still have taken effect.",
+		},
+	})
+}
+
+// Timeout gives the requests of a route group a deadline of budget on their context, an earlier
+// deadline of the caller is kept. Handlers watch ctx.Done() to stop, and pass the context on
+// so that every call they make is cut short too, ctx.Err() then maps to 504 through
+// errors.ConvertToAPIError.
+// When the deadline passes before the handler started its response, errors.ErrDeadlineExceeded
+// is answered right away and whatever the handler writes later is dropped. The deadline shows
+// in the logs written within the budget as context_deadline, the middlewares before Timeout get
+// their request back once it returns. A budget of 0 disables the middleware.
+func Timeout(budget time.Duration) gin.HandlerFunc {
+	if budget <= 0 {
+		return func(c *gin.Context) {}
+	}
+
+	return func(c *gin.Context) {
+		route := ginx.Route(c)
+		original := c.Request
+		ctx, cancel := context.WithTimeout(c.Request.Context(), budget)
+		defer cancel()
+		// before cancel, so the outer middlewares never see the canceled context
+		defer func() { c.Request = restoreRequest(original, c.Request) }()
+		c.Request = c.Request.WithContext(ctx)
+
+		apiErr := errors.APIErrorWithScene(errors.ErrDeadlineExceeded,
+			errors.Cause(context.DeadlineExceeded),
+			errors.Field("route", route),
+			errors.Field("budget", budget.String()),
+		)
+		writer := newTimeoutWriter(c.Writer)
+		c.Writer = writer
+
+		stop := writer.watch(ctx, apiErr)
+		// also on panic, the watcher must not outlive the request
+		defer stop()
+		c.Next()
+		stop()
+
+		if deadline, ok := ctx.Deadline(); ok && ctx.Err() == context.DeadlineExceeded {
+			requestDeadlineOverrun.With(route).Observe(time.Since(deadline).Seconds())
+		}
+		if !writer.finish() {
+			return
+		}
+		requestTimeoutsTotal.With(route).Inc()
+		// what gins.ResponseAPIError does on the request goroutine, for the access log and metrics,
+		// the error answered by a handler honoring the deadline was logged already
+		logged := tracing.GetTaskProcessErrorFromContext(c.Request.Context()) != nil
+		c.Request = c.Request.WithContext(tracing.ContextWithTaskProcessError(c.Request.Context(), apiErr))
+		c.Abort()
+		if !logged && gins.GlobalAPIErrorLoggerFunc != nil {
+			gins.GlobalAPIErrorLoggerFunc(c, c.Request.Context(), apiErr)
+		}
+	}
+}
+
+// restoreRequest is the request a middleware was given, its context outlives the one the
+// middleware canceled. The error answered downstream is carried over for the access log and span.
+func restoreRequest(original, current *http.Request) *http.Request {
+	apiErr := tracing.GetTaskProcessErrorFromContext(current.Context())
+	if apiErr == nil || tracing.GetTaskProcessErrorFromContext(original.Context()) == apiErr {
+		return original
+	}
+	return original.WithContext(tracing.ContextWithTaskProcessError(original.Context(), apiErr))
+}
+
+// timeoutWriter lets the watcher goroutine answer 504 while the handler may still be writing.
+// The handler sets headers on its own map, copied on its first write, so the two never share one.
+// Late writes are dropped without error, gin panics when rendering fails.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu       sync.Mutex
+	header   http.Header
+	timedOut bool
+}
+
+func newTimeoutWriter(w gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{ResponseWriter: w, header: w.Header().Clone()}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.commitHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return len(data), nil
+	}
+	w.commitHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return len(s), nil
+	}
+	w.commitHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.commitHeader()
+	w.ResponseWriter.Flush()
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Status()
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Written()
+}
+
+// commitHeader replaces the headers about to be sent by the ones of the handler.
+func (w *timeoutWriter) commitHeader() {
+	if w.ResponseWriter.Written() {
+		return
+	}
+	header := w.ResponseWriter.Header()
+	for key := range header {
+		delete(header, key)
+	}
+	for key, values := range w.header {
+		header[key] = values
+	}
+}
+
+// watch answers apiErr once ctx reaches its deadline, until stop is called.
+// stop waits for the watcher, so no write happens after it returns.
+func (w *timeoutWriter) watch(ctx context.Context, apiErr *errors.APIError) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				w.timeout(ctx, apiErr)
+			}
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
+
+// timeout answers apiErr unless the handler already started its response,
+// which is then left to complete.
+func (w *timeoutWriter) timeout(ctx context.Context, apiErr *errors.APIError) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ResponseWriter.Written() {
+		return
+	}
+	w.timedOut = true
+
+	meta := model.BuildResponseMeta(model.BuildMetaCode(apiErr.MainCode().Code(), apiErr.SubCode().Code()), apiErr)
+	meta.Errors = apiErr.Scene().Items()
+	body, _ := json.Marshal(model.ResponseBody{Meta: meta, Data: struct{}{}})
+	if traceID := tracing.GetTraceIDFromContext(ctx); traceID != "" {
+		// spliced here rather than by TraceContext, so the length is known
+		body = withTraceID(body, traceID)
+	}
+	// the headers of the outer middlewares, eg. am-trace-id, are still the ones to be sent
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(apiErr.MainCode().Code())
+	w.ResponseWriter.Write(body)
+	// with its length known, the client has the whole response without waiting for the handler
+	w.ResponseWriter.Flush()
+}
+
+// finish sends the headers of a handler that wrote no body, and reports whether 504 was answered.
+func (w *timeoutWriter) finish() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.commitHeader()
+	}
+	return w.timedOut
+}
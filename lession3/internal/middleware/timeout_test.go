@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AfterShip/golang-common/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+const testBudget = 20 * time.Millisecond
+
+// pastDeadline blocks until the budget of the request is over and the watcher had its turn.
+func pastDeadline(c *gin.Context) {
+	<-c.Request.Context().Done()
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    gin.HandlerFunc
+		wantStatus int
+		// wantCode is the meta code of the body, 0 for the body of the handler
+		wantCode   int
+		wantHeader string
+	}{
+		{
+			name: "answered in time",
+			handler: func(c *gin.Context) {
+				c.Header("X-Handler", "1")
+				c.JSON(http.StatusOK, gin.H{"meta": gin.H{"code": 20000}})
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: "1",
+		},
+		{
+			name: "late response dropped",
+			handler: func(c *gin.Context) {
+				pastDeadline(c)
+				c.Header("X-Handler", "1")
+				c.JSON(http.StatusCreated, gin.H{"meta": gin.H{"code": 20100}})
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   50400,
+		},
+		{
+			name: "late status and headers dropped",
+			handler: func(c *gin.Context) {
+				pastDeadline(c)
+				c.Header("X-Handler", "1")
+				c.Status(http.StatusNoContent)
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   50400,
+		},
+		{
+			name: "headers set before the deadline not sent",
+			handler: func(c *gin.Context) {
+				c.Header("X-Handler", "1")
+				pastDeadline(c)
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   50400,
+		},
+		{
+			name: "started response completed",
+			handler: func(c *gin.Context) {
+				c.Header("X-Handler", "1")
+				c.Status(http.StatusOK)
+				c.Writer.WriteHeaderNow()
+				pastDeadline(c)
+				c.Writer.WriteString(`{"meta":{"code":20000}}`)
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: "1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.Use(func(c *gin.Context) {
+				c.Header("X-Outer", "1")
+			}, Timeout(testBudget))
+			engine.GET("/v1", tt.handler)
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			// a second write would append to the body and fail to decode
+			var body struct {
+				Meta struct {
+					Code int `json:"code"`
+				} `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not one response: %v", w.Body, err)
+			}
+			wantCode := tt.wantCode
+			if wantCode == 0 {
+				wantCode = tt.wantStatus * 100
+			}
+			if body.Meta.Code != wantCode {
+				t.Fatalf("meta code = %d, want %d", body.Meta.Code, wantCode)
+			}
+			if got := w.Header().Get("X-Handler"); got != tt.wantHeader {
+				t.Fatalf("X-Handler = %q, want %q", got, tt.wantHeader)
+			}
+			if got := w.Header().Get("X-Outer"); got != "1" {
+				t.Fatalf("X-Outer = %q, want the header of the outer middleware", got)
+			}
+		})
+	}
+}
+
+func TestTimeoutRacingHandler(t *testing.T) {
+	engine := gin.New()
+	engine.Use(Timeout(time.Millisecond))
+	engine.GET("/v1", func(c *gin.Context) {
+		// keeps writing across the deadline
+		for i := 0; i < 100; i++ {
+			c.Header("X-Handler", "1")
+			c.Writer.Flush()
+		}
+		c.JSON(http.StatusOK, gin.H{"meta": gin.H{"code": 20000}})
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1", nil))
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Errorf("status %d, body %q is not one response: %v", w.Code, w.Body, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTimeoutDisabled(t *testing.T) {
+	engine := gin.New()
+	engine.Use(Timeout(0))
+	engine.GET("/v1", func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			t.Error("deadline set with a budget of 0")
+		}
+		c.Status(http.StatusNoContent)
+	})
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestTimeoutRestoresRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    gin.HandlerFunc
+		wantStatus int
+		wantError  bool
+	}{
+		{
+			name:       "answered in time",
+			handler:    func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"meta": gin.H{"code": 20000}}) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "timed out",
+			handler:    pastDeadline,
+			wantStatus: http.StatusGatewayTimeout,
+			wantError:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := captureLogs(t)
+			engine := gin.New()
+			engine.Use(AccessLog(), func(c *gin.Context) {
+				original := c.Request
+				c.Next()
+				if c.Request != original && !tt.wantError {
+					t.Error("request not restored")
+				}
+				if err := c.Request.Context().Err(); err != nil {
+					t.Errorf("context of the restored request: %v", err)
+				}
+				if got := tracing.GetTaskProcessErrorFromContext(c.Request.Context()) != nil; got != tt.wantError {
+					t.Errorf("error carried over = %v, want %v", got, tt.wantError)
+				}
+			}, Timeout(testBudget))
+			engine.GET("/v1", tt.handler)
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			lines := sink.lines(t, "http_access")
+			if len(lines) != 1 {
+				t.Fatalf("logged %d access lines, want 1", len(lines))
+			}
+			for _, field := range []string{"context_error", "context_deadline"} {
+				if value, ok := lines[0][field]; ok {
+					t.Errorf("access log has %s %v", field, value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	commontracing "github.com/AfterShip/golang-common/tracing"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/ginx"
+	"k8s_learning/internal/tracing"
+)
+
+const maxTraceIDLength = 128
+
+// traceIDHeaders are read in priority order, the first valid one wins.
+var traceIDHeaders = []string{
+	commontracing.HeaderTraceID,
+	commontracing.HeaderXRequestID,
+	commontracing.HeaderRequestID,
+	commontracing.HeaderXCloudTraceContext,
+}
+
+var (
+	envelopeMetaPrefix    = []byte(`{"meta":{`)
+	envelopeTraceIDPrefix = []byte(`{"meta":{"trace_id":`)
+)
+
+// TraceContext extracts the trace ID from the inbound headers, or generates one with
+// tracing.GenerateTracingID, and stores it together with CF-Ray, method and path on the
+// request context, where logger.DefaultBeforeLogHookImpl picks them up.
+// It also starts the server span of the request, child of the span sent in traceparent or
+// x-cloud-trace-context, the trace ID being recorded on the span as am_trace_id.
+// The trace ID is echoed in the am-trace-id response header and added to meta.trace_id
+// of error envelopes, so customers can quote it.
+func TraceContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if parent := tracing.Extract(c.Request.Header); parent.IsValid() {
+			ctx = tracing.ContextWithRemoteSpanContext(ctx, parent)
+		}
+		route := ginx.Route(c)
+		ctx, span := tracing.StartSpan(ctx, c.Request.Method+" "+route,
+			tracing.Kind(tracing.SpanKindServer),
+			tracing.Attribute("http.method", c.Request.Method),
+			tracing.Attribute("http.route", route),
+			tracing.Attribute("http.path", c.Request.URL.Path),
+		)
+		defer span.End()
+
+		traceID := TraceIDFromHeaders(c.Request.Header.Get)
+		if traceID == "" {
+			traceID = commontracing.GenerateTracingID()
+		}
+		span.SetAttribute("am_trace_id", traceID)
+		ctx = commontracing.ContextWithTraceID(ctx, traceID)
+		if ray := c.GetHeader(commontracing.HeaderCloudflareRay); ray != "" && validTraceID(ray) {
+			ctx = commontracing.ContextWithCloudflareRay(ctx, ray)
+			c.Set(commontracing.ContextKeyCloudflareRay, ray)
+		}
+		ctx = commontracing.ContextWithRequestMethod(ctx, c.Request.Method)
+		ctx = commontracing.ContextWithRequestPath(ctx, c.Request.URL.Path)
+		c.Request = c.Request.WithContext(ctx)
+		// gin.Context.Value reads string keys from c.Keys, so handlers passing the
+		// *gin.Context itself as context.Context see the trace ID as well
+		c.Set(commontracing.ContextKeyTraceID, traceID)
+
+		c.Header(commontracing.HeaderTraceID, traceID)
+		c.Writer = &traceIDWriter{ResponseWriter: c.Writer, traceID: traceID}
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.status_code", status)
+		span.SetAttribute("meta_code", ginx.MetaCode(c))
+		if status >= 500 {
+			if apiErr := commontracing.GetTaskProcessErrorFromContext(c.Request.Context()); apiErr != nil {
+				span.RecordError(apiErr)
+			} else {
+				span.SetStatus(tracing.StatusError, "")
+			}
+		}
+	}
+}
+
+// TraceIDFromHeaders returns the first valid trace ID of traceIDHeaders,
+// for x-cloud-trace-context the ";o=" options are dropped.
+func TraceIDFromHeaders(get func(key string) string) string {
+	for _, key := range traceIDHeaders {
+		value := strings.TrimSpace(get(key))
+		if key == commontracing.HeaderXCloudTraceContext {
+			value = strings.SplitN(value, ";", 2)[0]
+		}
+		if value != "" && validTraceID(value) {
+			return value
+		}
+	}
+	return ""
+}
+
+// validTraceID keeps arbitrary header values out of logs and response headers.
+func validTraceID(s string) bool {
+	if len(s) > maxTraceIDLength {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '!' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// traceIDWriter injects "trace_id" into the meta of error envelopes.
+// gins.ResponseAPIError renders model.ResponseBody with a single Write, meta being the first field.
+type traceIDWriter struct {
+	gin.ResponseWriter
+	traceID  string
+	injected bool
+}
+
+func (w *traceIDWriter) Write(data []byte) (int, error) {
+	if w.injected || w.Status() < 400 || w.Written() || !bytes.HasPrefix(data, envelopeMetaPrefix) ||
+		bytes.HasPrefix(data, envelopeTraceIDPrefix) {
+		return w.ResponseWriter.Write(data)
+	}
+	w.injected = true
+	if _, err := w.ResponseWriter.Write(withTraceID(data, w.traceID)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// withTraceID splices "trace_id" as the first field of the meta of envelope.
+func withTraceID(envelope []byte, traceID string) []byte {
+	field := `"trace_id":` + strconv.Quote(traceID) + `,`
+	spliced := make([]byte, 0, len(envelope)+len(field))
+	spliced = append(spliced, envelopeMetaPrefix...)
+	spliced = append(spliced, field...)
+	return append(spliced, envelope[len(envelopeMetaPrefix):]...)
+}
+
+func (w *traceIDWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	commontracing "github.com/AfterShip/golang-common/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTraceIDFromHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "none"},
+		{
+			name: "am-trace-id first",
+			headers: map[string]string{
+				"am-trace-id": "am", "X-Request-ID": "x-request", "Request-ID": "request", "x-cloud-trace-context": "cloud/1",
+			},
+			want: "am",
+		},
+		{
+			name:    "X-Request-ID before Request-ID",
+			headers: map[string]string{"X-Request-ID": "x-request", "Request-ID": "request"},
+			want:    "x-request",
+		},
+		{
+			name:    "Request-ID before x-cloud-trace-context",
+			headers: map[string]string{"Request-ID": "request", "x-cloud-trace-context": "cloud/1"},
+			want:    "request",
+		},
+		{
+			name:    "x-cloud-trace-context options dropped",
+			headers: map[string]string{"x-cloud-trace-context": "105445aa7843bc8bf206b12000100000/1;o=1"},
+			want:    "105445aa7843bc8bf206b12000100000/1",
+		},
+		{
+			name:    "invalid skipped",
+			headers: map[string]string{"am-trace-id": "has space", "X-Request-ID": strings.Repeat("a", maxTraceIDLength+1), "Request-ID": "request"},
+			want:    "request",
+		},
+		{
+			name:    "blank skipped",
+			headers: map[string]string{"am-trace-id": "  ", "X-Request-ID": "x-request"},
+			want:    "x-request",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.headers {
+				header.Set(key, value)
+			}
+			if got := TraceIDFromHeaders(header.Get); got != tt.want {
+				t.Errorf("TraceIDFromHeaders() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+var generatedTraceID = regexp.MustCompile(`^[0-9a-f]{32}/0$`)
+
+func TestTraceContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceID     string
+		status      int
+		body        string
+		wantBody    string
+		wantTraceID *regexp.Regexp
+	}{
+		{
+			name:        "generated",
+			status:      http.StatusOK,
+			body:        `{"meta":{"code":20000}}`,
+			wantBody:    `{"meta":{"code":20000}}`,
+			wantTraceID: generatedTraceID,
+		},
+		{
+			name:     "error envelope",
+			traceID:  "trace-1",
+			status:   http.StatusNotFound,
+			body:     `{"meta":{"code":40400,"type":"NotFound"}}`,
+			wantBody: `{"meta":{"trace_id":"trace-1","code":40400,"type":"NotFound"}}`,
+		},
+		{
+			name:     "success envelope untouched",
+			traceID:  "trace-1",
+			status:   http.StatusCreated,
+			body:     `{"meta":{"code":20100}}`,
+			wantBody: `{"meta":{"code":20100}}`,
+		},
+		{
+			name:     "trace_id already set",
+			traceID:  "trace-1",
+			status:   http.StatusBadRequest,
+			body:     `{"meta":{"trace_id":"other","code":40000}}`,
+			wantBody: `{"meta":{"trace_id":"other","code":40000}}`,
+		},
+		{
+			name:     "not an envelope",
+			traceID:  "trace-1",
+			status:   http.StatusBadGateway,
+			body:     `upstream failed`,
+			wantBody: `upstream failed`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contextTraceID string
+			engine := gin.New()
+			engine.Use(TraceContext())
+			engine.GET("/v1", func(c *gin.Context) {
+				contextTraceID = commontracing.GetTraceIDFromContext(c.Request.Context())
+				c.Data(tt.status, "application/json", []byte(tt.body))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1", nil)
+			if tt.traceID != "" {
+				req.Header.Set(commontracing.HeaderTraceID, tt.traceID)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			traceID := w.Header().Get(commontracing.HeaderTraceID)
+			if tt.wantTraceID != nil {
+				if !tt.wantTraceID.MatchString(traceID) {
+					t.Fatalf("am-trace-id = %q, want a generated ID", traceID)
+				}
+			} else if traceID != tt.traceID {
+				t.Fatalf("am-trace-id = %q, want %q", traceID, tt.traceID)
+			}
+			if contextTraceID != traceID {
+				t.Errorf("trace ID of the request context = %q, want %q", contextTraceID, traceID)
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package notes
+
+import (
+	stderrors "errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/model"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/AfterShip/golang-common/lang/types"
+	"github.com/AfterShip/golang-common/uuid"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/auth"
+	"k8s_learning/internal/ginx"
+	"k8s_learning/internal/pagination"
+)
+
+const (
+	maxTitleLength   = 200
+	maxContentLength = 10000
+)
+
+func init() {
+	// golang-common has the 412 APIError but no description for its meta code
+	model.AddStatusCodeDescriptions(map[int]model.StatusCodeDescription{
+		41200: {
+			TypeName: "PreconditionFailed",
+			Message:  "The If-Match header does not match the current version of the resource, fetch it again and retry.",
+		},
+	})
+}
+
+// noteRequest is the body of POST, PUT and PATCH. With WrappedTypes a PATCH tells
+// an absent field (left as is) from null (cleared) and from a value (set).
+type noteRequest struct {
+	Title   types.String `json:"title"`
+	Content types.String `json:"content"`
+	DueAt   types.Time   `json:"due_at"`
+}
+
+// validate checks a POST or PUT body, or a PATCH one when partial.
+func (r *noteRequest) validate(partial bool) []interface{} {
+	var items []interface{}
+	switch {
+	case !r.Title.Assigned():
+		if !partial {
+			items = append(items, ginx.ValidationItem{Path: "title", Info: "title is required"})
+		}
+	case r.Title.Null() || strings.TrimSpace(r.Title.String()) == "":
+		items = append(items, ginx.ValidationItem{Path: "title", Info: "title must not be null or blank"})
+	case utf8.RuneCountInString(r.Title.String()) > maxTitleLength:
+		items = append(items, ginx.ValidationItem{Path: "title", Info: "title must be at most " + strconv.Itoa(maxTitleLength) + " characters"})
+	}
+	if r.Content.Assigned() && !r.Content.Null() && utf8.RuneCountInString(r.Content.String()) > maxContentLength {
+		items = append(items, ginx.ValidationItem{Path: "content", Info: "content must be at most " + strconv.Itoa(maxContentLength) + " characters"})
+	}
+	return items
+}
+
+// apply copies the request onto note, a PUT clears the absent fields, a PATCH keeps them.
+func (r *noteRequest) apply(note *Note, partial bool) {
+	if r.Title.Assigned() {
+		note.Title = strings.TrimSpace(r.Title.String())
+	}
+	if r.Content.Assigned() || !partial {
+		note.Content = types.NewNullString()
+		if r.Content.Assigned() {
+			note.Content = r.Content
+		}
+	}
+	if r.DueAt.Assigned() || !partial {
+		note.DueAt = types.NewNullTime()
+		if r.DueAt.Assigned() {
+			note.DueAt = r.DueAt
+			note.DueAt.SetToUTC()
+		}
+	}
+}
+
+type Option func(conf *conf)
+
+type conf struct {
+	read   []gin.HandlerFunc
+	write  []gin.HandlerFunc
+	binder *pagination.Binder
+}
+
+// Pagination sets the binder of GET /notes, the default one signs its cursors with a random key.
+func Pagination(binder *pagination.Binder) Option {
+	return func(conf *conf) {
+		conf.binder = binder
+	}
+}
+
+// ReadMiddleware runs before the GET handlers, eg. auth.RequireScopes("notes:read").
+func ReadMiddleware(handlers ...gin.HandlerFunc) Option {
+	return func(conf *conf) {
+		conf.read = append(conf.read, handlers...)
+	}
+}
+
+// WriteMiddleware runs before the POST, PUT, PATCH and DELETE handlers.
+func WriteMiddleware(handlers ...gin.HandlerFunc) Option {
+	return func(conf *conf) {
+		conf.write = append(conf.write, handlers...)
+	}
+}
+
+type handler struct {
+	repo   Repository
+	binder *pagination.Binder
+}
+
+// RegisterHandlers mounts the notes routes on group, usually /v1:
+// POST and GET /notes, GET, PUT, PATCH and DELETE /notes/:id.
+// GET /notes is paginated by cursor, PUT, PATCH and DELETE honor If-Match with the ETag of the note.
+func RegisterHandlers(group *gin.RouterGroup, repo Repository, opts ...Option) error {
+	conf := &conf{}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	if conf.binder == nil {
+		codec, err := pagination.NewCodec(nil)
+		if err != nil {
+			return err
+		}
+		conf.binder = pagination.NewBinder(codec)
+	}
+	h := &handler{repo: repo, binder: conf.binder}
+	read := func(handler gin.HandlerFunc) []gin.HandlerFunc {
+		return append(append([]gin.HandlerFunc{}, conf.read...), handler)
+	}
+	write := func(handler gin.HandlerFunc) []gin.HandlerFunc {
+		return append(append([]gin.HandlerFunc{}, conf.write...), handler)
+	}
+
+	notes := group.Group("/notes")
+	notes.POST("", write(h.create)...)
+	notes.GET("", read(h.list)...)
+	notes.GET("/:id", read(h.get)...)
+	notes.PUT("/:id", write(h.update(false))...)
+	notes.PATCH("/:id", write(h.update(true))...)
+	notes.DELETE("/:id", write(h.delete)...)
+	return nil
+}
+
+// OwnerResolver gives the owner of /notes/:id, to register as the authz.OwnerResolver of the route.
+func OwnerResolver(repo Repository) func(c *gin.Context) (string, error) {
+	return func(c *gin.Context) (string, error) {
+		note, err := repo.Get(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			return "", toAPIError(err)
+		}
+		return note.OwnerID, nil
+	}
+}
+
+func (h *handler) create(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req noteRequest
+	if err := gins.ShouldBindJSON(c, &req); err != nil {
+		gins.ResponseInputBindingError(c, ctx, err)
+		return
+	}
+	if items := req.validate(false); len(items) > 0 {
+		ginx.ResponseValidationError(c, items...)
+		return
+	}
+
+	id, err := uuid.GenerateC24()
+	if err != nil {
+		gins.ResponseError(c, ctx, err)
+		return
+	}
+	now := types.NewTime(time.Now().UTC())
+	note := &Note{ID: id.String(), Version: 1, CreatedAt: now, UpdatedAt: now}
+	if principal, ok := auth.PrincipalFromContext(ctx); ok {
+		note.OwnerID = principal.Subject
+	}
+	req.apply(note, false)
+	if err := h.repo.Create(ctx, note); err != nil {
+		gins.ResponseAPIErrorWithLogging(c, ctx, toAPIError(err))
+		return
+	}
+	c.Header("ETag", etag(note))
+	gins.ResponseCreated(c, note)
+}
+
+func (h *handler) list(c *gin.Context) {
+	ctx := c.Request.Context()
+	var after *Position
+	page, ok := h.binder.Bind(c, &after)
+	if !ok {
+		return
+	}
+	// one more note tells whether a next page exists
+	notes, total, err := h.repo.List(ctx, after, page.Limit+1)
+	if err != nil {
+		gins.ResponseAPIErrorWithLogging(c, ctx, toAPIError(err))
+		return
+	}
+	var next interface{}
+	if len(notes) > page.Limit {
+		notes = notes[:page.Limit]
+		next = PositionOf(notes[len(notes)-1])
+	}
+	meta, err := h.binder.Meta(page, next)
+	if err != nil {
+		gins.ResponseError(c, ctx, err)
+		return
+	}
+	meta.Total = &total
+	ginx.ResponseList(c, notes, meta)
+}
+
+func (h *handler) get(c *gin.Context) {
+	note, err := h.repo.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		gins.ResponseAPIErrorWithLogging(c, c.Request.Context(), toAPIError(err))
+		return
+	}
+	c.Header("ETag", etag(note))
+	gins.ResponseOK(c, note)
+}
+
+func (h *handler) update(partial bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		var req noteRequest
+		if err := gins.ShouldBindJSON(c, &req); err != nil {
+			gins.ResponseInputBindingError(c, ctx, err)
+			return
+		}
+		if items := req.validate(partial); len(items) > 0 {
+			ginx.ResponseValidationError(c, items...)
+			return
+		}
+
+		note, err := h.repo.Get(ctx, c.Param("id"))
+		if err != nil {
+			gins.ResponseAPIErrorWithLogging(c, ctx, toAPIError(err))
+			return
+		}
+		if !ifMatch(c, note) {
+			return
+		}
+		req.apply(note, partial)
+		note.UpdatedAt = types.NewTime(time.Now().UTC())
+		if err := h.repo.Update(ctx, note); err != nil {
+			gins.ResponseAPIErrorWithLogging(c, ctx, toAPIError(err))
+			return
+		}
+		c.Header("ETag", etag(note))
+		gins.ResponseOK(c, note)
+	}
+}
+
+func (h *handler) delete(c *gin.Context) {
+	ctx := c.Request.Context()
+	note, err := h.repo.Get(ctx, c.Param("id"))
+	if err != nil {
+		gins.ResponseAPIErrorWithLogging(c, ctx, toAPIError(err))
+		return
+	}
+	if !ifMatch(c, note) {
+		return
+	}
+	if err := h.repo.Delete(ctx, note.ID); err != nil {
+		gins.ResponseAPIErrorWithLogging(c, ctx, toAPIError(err))
+		return
+	}
+	gins.ResponseOK(c, note)
+}
+
+func etag(note *Note) string {
+	return strconv.Quote(strconv.FormatInt(note.Version, 10))
+}
+
+// ifMatch answers errors.ErrPreconditionFailed when the If-Match header is not the ETag of note.
+func ifMatch(c *gin.Context, note *Note) bool {
+	expected := c.GetHeader("If-Match")
+	if expected == "" || expected == "*" || expected == etag(note) {
+		return true
+	}
+	gins.ResponseAPIErrorWithLogging(c, c.Request.Context(), errors.APIErrorWithScene(errors.ErrPreconditionFailed,
+		errors.Field("if_match", expected), errors.Field("etag", etag(note))))
+	return false
+}
+
+// toAPIError maps the repository errors, a lost update race is a 409 the client can retry.
+func toAPIError(err error) *errors.APIError {
+	switch {
+	case stderrors.Is(err, errors.ErrBusinessRecordNotFound):
+		return errors.APIErrorWithScene(errors.ErrNotFound, errors.Cause(err), errors.Stack(errors.SmallerStacktrace(2, 1)))
+	case stderrors.Is(err, errors.ErrBusinessRecordDuplicated), stderrors.Is(err, errors.ErrBusinessRecordChanged):
+		return errors.APIErrorWithScene(errors.ErrConflict, errors.Cause(err), errors.Stack(errors.SmallerStacktrace(2, 1)))
+	}
+	return errors.ConvertToAPIError(err)
+}
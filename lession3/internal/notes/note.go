@@ -0,0 +1,22 @@
+// Package notes is the reference resource of the API, /v1/notes, showing how a business resource
+// binds WrappedType requests, maps repository errors and answers through gins.
+package notes
+
+import (
+	"github.com/AfterShip/golang-common/lang/types"
+)
+
+// Note is both the stored record and the response body, nullable fields are WrappedTypes
+// so they render null instead of a zero value.
+type Note struct {
+	ID      string       `json:"id"`
+	Title   string       `json:"title"`
+	Content types.String `json:"content"`
+	DueAt   types.Time   `json:"due_at"`
+	// OwnerID is the principal subject of the creator, empty for anonymous notes
+	OwnerID string `json:"owner_id"`
+	// Version is bumped on every update, it is the ETag of the note
+	Version   int64      `json:"version"`
+	CreatedAt types.Time `json:"created_at"`
+	UpdatedAt types.Time `json:"updated_at"`
+}
@@ -0,0 +1,127 @@
+package notes
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+)
+
+// Repository stores the notes.
+type Repository interface {
+	// Create returns errors.ErrBusinessRecordDuplicated when the id is taken.
+	Create(ctx context.Context, note *Note) error
+	// Get returns errors.ErrBusinessRecordNotFound for an unknown id.
+	Get(ctx context.Context, id string) (*Note, error)
+	// List returns up to limit notes by creation time, after the given position unless nil,
+	// and the total count of notes.
+	List(ctx context.Context, after *Position, limit int) ([]*Note, int, error)
+	// Update stores note when the stored version is still note.Version and bumps it,
+	// it returns errors.ErrBusinessRecordChanged when another update came first
+	// and errors.ErrBusinessRecordNotFound for an unknown id.
+	Update(ctx context.Context, note *Note) error
+	// Delete returns errors.ErrBusinessRecordNotFound for an unknown id.
+	Delete(ctx context.Context, id string) error
+}
+
+// Position is the place of a note in the list order, it is the payload of the notes cursors.
+type Position struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+}
+
+// PositionOf returns the position of note.
+func PositionOf(note *Note) *Position {
+	return &Position{CreatedAt: note.CreatedAt.Time(), ID: note.ID}
+}
+
+// before tells whether p sorts before the position of note.
+func (p *Position) before(note *Note) bool {
+	created := note.CreatedAt.Time()
+	if p.CreatedAt.Equal(created) {
+		return p.ID < note.ID
+	}
+	return p.CreatedAt.Before(created)
+}
+
+// MemoryRepository is a Repository local to the process, every replica has its own notes.
+type MemoryRepository struct {
+	mu    sync.RWMutex
+	notes map[string]Note
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{notes: make(map[string]Note)}
+}
+
+func (r *MemoryRepository) Create(_ context.Context, note *Note) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.notes[note.ID]; ok {
+		return errors.ErrBusinessRecordDuplicated
+	}
+	r.notes[note.ID] = *note
+	return nil
+}
+
+func (r *MemoryRepository) Get(_ context.Context, id string) (*Note, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	note, ok := r.notes[id]
+	if !ok {
+		return nil, errors.ErrBusinessRecordNotFound
+	}
+	return &note, nil
+}
+
+func (r *MemoryRepository) List(_ context.Context, after *Position, limit int) ([]*Note, int, error) {
+	r.mu.RLock()
+	notes := make([]*Note, 0, len(r.notes))
+	for _, note := range r.notes {
+		note := note
+		notes = append(notes, &note)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(notes, func(i, j int) bool {
+		return PositionOf(notes[i]).before(notes[j])
+	})
+	total := len(notes)
+	if after != nil {
+		start := sort.Search(len(notes), func(i int) bool {
+			return after.before(notes[i])
+		})
+		notes = notes[start:]
+	}
+	if len(notes) > limit {
+		notes = notes[:limit]
+	}
+	return notes, total, nil
+}
+
+func (r *MemoryRepository) Update(_ context.Context, note *Note) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.notes[note.ID]
+	if !ok {
+		return errors.ErrBusinessRecordNotFound
+	}
+	if stored.Version != note.Version {
+		return errors.ErrBusinessRecordChanged
+	}
+	note.Version++
+	r.notes[note.ID] = *note
+	return nil
+}
+
+func (r *MemoryRepository) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.notes[id]; !ok {
+		return errors.ErrBusinessRecordNotFound
+	}
+	delete(r.notes, id)
+	return nil
+}
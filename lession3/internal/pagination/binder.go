@@ -0,0 +1,111 @@
+package pagination
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/ginx"
+)
+
+const (
+	defaultLimit    = 20
+	defaultMaxLimit = 100
+	// maxCursorLength rejects oversized cursors before their signature is computed
+	maxCursorLength = 1024
+)
+
+// Page is the limit/cursor query of a list request.
+type Page struct {
+	Limit int
+	// Cursor is the raw cursor of the request, empty for the first page
+	Cursor string
+}
+
+type BinderOption func(b *Binder)
+
+// DefaultLimit is the limit of requests without one, default 20.
+func DefaultLimit(limit int) BinderOption {
+	return func(b *Binder) {
+		b.defaultLimit = limit
+	}
+}
+
+// MaxLimit is the largest limit accepted, default 100.
+func MaxLimit(limit int) BinderOption {
+	return func(b *Binder) {
+		b.maxLimit = limit
+	}
+}
+
+// Binder reads the limit and cursor query parameters of the list endpoints sharing a Codec.
+type Binder struct {
+	codec        *Codec
+	defaultLimit int
+	maxLimit     int
+}
+
+func NewBinder(codec *Codec, opts ...BinderOption) *Binder {
+	b := &Binder{codec: codec, defaultLimit: defaultLimit, maxLimit: defaultMaxLimit}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Bind validates the query and decodes the cursor into position, which is left as is on the first page.
+// It answers errors.ErrUnprocessableEntity with an item per bad parameter, and errors.ErrBadRequest
+// for a cursor failing its signature, then returns false and the handler must return.
+func (b *Binder) Bind(c *gin.Context, position interface{}) (Page, bool) {
+	page := Page{Limit: b.defaultLimit, Cursor: c.Query("cursor")}
+
+	var items []interface{}
+	if raw, ok := c.GetQuery("limit"); ok {
+		limit, err := strconv.Atoi(raw)
+		switch {
+		case err != nil:
+			items = append(items, ginx.ValidationItem{Path: "limit", Info: "limit must be an integer"})
+		case limit < 1 || limit > b.maxLimit:
+			items = append(items, ginx.ValidationItem{Path: "limit", Info: fmt.Sprintf("limit must be between 1 and %d", b.maxLimit)})
+		default:
+			page.Limit = limit
+		}
+	}
+	if _, ok := c.GetQuery("cursor"); ok && page.Cursor == "" {
+		items = append(items, ginx.ValidationItem{Path: "cursor", Info: "cursor must not be empty, omit it for the first page"})
+	} else if len(page.Cursor) > maxCursorLength {
+		items = append(items, ginx.ValidationItem{Path: "cursor", Info: fmt.Sprintf("cursor must be at most %d characters", maxCursorLength)})
+	}
+	if len(items) > 0 {
+		ginx.ResponseValidationError(c, items...)
+		return page, false
+	}
+
+	if page.Cursor != "" {
+		if err := b.codec.Decode(page.Cursor, position); err != nil {
+			gins.ResponseAPIErrorWithLogging(c, c.Request.Context(), errors.APIErrorWithScene(errors.ErrBadRequest,
+				errors.Cause(err), errors.Field("cursor", page.Cursor), errors.Stack(errors.SmallerStacktrace(2, 1))))
+			return page, false
+		}
+	}
+	return page, true
+}
+
+// Meta builds the list metadata of a page, next is the position after its last item,
+// nil when it is the last page.
+func (b *Binder) Meta(page Page, next interface{}) (ginx.ListMeta, error) {
+	meta := ginx.ListMeta{Limit: page.Limit}
+	if next == nil {
+		return meta, nil
+	}
+	cursor, err := b.codec.Encode(next)
+	if err != nil {
+		return meta, err
+	}
+	meta.HasNext = true
+	meta.NextCursor = cursor
+	return meta, nil
+}
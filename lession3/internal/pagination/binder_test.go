@@ -0,0 +1,73 @@
+package pagination
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestBinderBind(t *testing.T) {
+	codec, err := NewCodec([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := codec.Encode(position{ID: "note-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	binder := NewBinder(codec, DefaultLimit(10), MaxLimit(50))
+
+	tests := []struct {
+		name       string
+		query      string
+		wantOK     bool
+		wantStatus int
+		wantLimit  int
+		wantID     string
+	}{
+		{name: "first page", query: "", wantOK: true, wantLimit: 10},
+		{name: "limit", query: "limit=50", wantOK: true, wantLimit: 50},
+		{name: "next page", query: "cursor=" + valid, wantOK: true, wantLimit: 10, wantID: "note-1"},
+		{name: "limit not an integer", query: "limit=ten", wantStatus: http.StatusUnprocessableEntity},
+		{name: "limit over max", query: "limit=51", wantStatus: http.StatusUnprocessableEntity},
+		{name: "limit zero", query: "limit=0", wantStatus: http.StatusUnprocessableEntity},
+		{name: "empty cursor", query: "cursor=", wantStatus: http.StatusUnprocessableEntity},
+		{name: "oversized cursor", query: "cursor=" + strings.Repeat("a", maxCursorLength+1), wantStatus: http.StatusUnprocessableEntity},
+		{name: "tampered cursor", query: "cursor=x" + valid[1:], wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got  position
+				page Page
+				ok   bool
+			)
+			engine := gin.New()
+			engine.GET("/v1/notes", func(c *gin.Context) { page, ok = binder.Bind(c, &got) })
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/notes?"+tt.query, nil))
+			if ok != tt.wantOK {
+				t.Fatalf("Bind() ok = %v, want %v (status %d, body %s)", ok, tt.wantOK, w.Code, w.Body)
+			}
+			if !ok {
+				if w.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+				}
+				return
+			}
+			if page.Limit != tt.wantLimit {
+				t.Errorf("Limit = %d, want %d", page.Limit, tt.wantLimit)
+			}
+			if got.ID != tt.wantID {
+				t.Errorf("position ID = %q, want %q", got.ID, tt.wantID)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Package pagination is the cursor pagination of the list endpoints: opaque signed cursors,
+// the limit/cursor query binder and the list metadata answered through ginx.ResponseList.
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"strings"
+)
+
+// signatureSize is the truncated HMAC-SHA256 of a cursor, enough against forgery and keeps cursors short.
+const signatureSize = 16
+
+// ErrInvalidCursor is returned by Codec.Decode for a cursor that was not issued by the codec,
+// or was altered since.
+var ErrInvalidCursor = stderrors.New("pagination: invalid cursor")
+
+// Codec encodes list positions into opaque cursors, <base64url payload>.<base64url signature>.
+// The payload is JSON so a position is any struct the repository understands, eg. the sort
+// key and the id of the last item of a page. It is signed, not encrypted, do not put secrets in it.
+type Codec struct {
+	key []byte
+}
+
+// NewCodec signs the cursors with secret. An empty secret draws a random key,
+// then cursors only work on the replica that issued them and until it restarts.
+func NewCodec(secret []byte) (*Codec, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, sha256.Size)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return &Codec{key: secret}, nil
+}
+
+// Encode returns the cursor of position.
+func (c *Codec) Encode(position interface{}) (string, error) {
+	payload, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(c.sign(payload)), nil
+}
+
+// Decode verifies cursor and unmarshals its position, any failure is ErrInvalidCursor.
+func (c *Codec) Decode(cursor string, position interface{}) error {
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, c.sign(payload)) {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(payload, position); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+func (c *Codec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(payload)
+	return mac.Sum(nil)[:signatureSize]
+}
@@ -0,0 +1,97 @@
+package pagination
+
+import (
+	"encoding/base64"
+	stderrors "errors"
+	"strings"
+	"testing"
+)
+
+type position struct {
+	CreatedAt int64  `json:"created_at"`
+	ID        string `json:"id"`
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	codec, err := NewCodec([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := position{CreatedAt: 1589500800, ID: "note-1"}
+	cursor, err := codec.Encode(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got position
+	if err := codec.Decode(cursor, &got); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if got != want {
+		t.Fatalf("Decode() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCodecDecodeRejects(t *testing.T) {
+	codec, err := NewCodec([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewCodec([]byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := codec.Encode(position{CreatedAt: 1, ID: "note-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCursor, err := other.Encode(position{CreatedAt: 1, ID: "note-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(cursor, ".")
+	forgedPayload := base64.RawURLEncoding.EncodeToString([]byte(`{"created_at":1,"id":"note-2"}`))
+	unsignedGarbage := base64.RawURLEncoding.EncodeToString([]byte("not json"))
+	garbageCursor := unsignedGarbage + "." + base64.RawURLEncoding.EncodeToString(codec.sign([]byte("not json")))
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "empty", cursor: ""},
+		{name: "no signature", cursor: parts[0]},
+		{name: "extra part", cursor: cursor + ".x"},
+		{name: "payload not base64", cursor: "!!." + parts[1]},
+		{name: "signature not base64", cursor: parts[0] + ".!!"},
+		{name: "tampered payload", cursor: forgedPayload + "." + parts[1]},
+		{name: "truncated signature", cursor: parts[0] + "." + parts[1][:len(parts[1])-2]},
+		{name: "signed by another secret", cursor: otherCursor},
+		{name: "signed payload not json", cursor: garbageCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got position
+			if err := codec.Decode(tt.cursor, &got); !stderrors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("Decode(%q) error = %v, want %v", tt.cursor, err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestNewCodecRandomSecret(t *testing.T) {
+	a, err := NewCodec(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewCodec(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := a.Encode(position{ID: "note-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got position
+	if err := b.Decode(cursor, &got); !stderrors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("Decode() with another random secret error = %v, want %v", err, ErrInvalidCursor)
+	}
+}
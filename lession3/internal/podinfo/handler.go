@@ -0,0 +1,23 @@
+package podinfo
+
+import (
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/chaos"
+)
+
+const whoamiPath = "/whoami"
+
+// RegisterWhoamiHandler replaces handlers.RegisterWhoamiHandler of golang-common,
+// ?verbose adds the dependency module versions. injector may be nil when chaos is disabled.
+func RegisterWhoamiHandler(group *gin.RouterGroup, podInfoDir string, injector *chaos.Injector) {
+	group.GET(whoamiPath, func(c *gin.Context) {
+		_, verbose := c.GetQuery("verbose")
+		info := Collect(podInfoDir, verbose)
+		if injector != nil {
+			info.Chaos = injector.List()
+		}
+		gins.ResponseOK(c, info)
+	})
+}
@@ -0,0 +1,196 @@
+// Package podinfo describes the running process and the pod it lives in,
+// from the build info, the runtime and the Downward API.
+package podinfo
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AfterShip/golang-common/whoami"
+
+	"k8s_learning/internal/chaos"
+)
+
+// Downward API env vars, see the Deployment rendered by `web manifests`.
+const (
+	EnvPodName           = "POD_NAME"
+	EnvPodNamespace      = "POD_NAMESPACE"
+	EnvPodIP             = "POD_IP"
+	EnvNodeName          = "NODE_NAME"
+	EnvPodServiceAccount = "POD_SERVICE_ACCOUNT"
+
+	// DefaultPodInfoDir is the mount path of the Downward API volume holding labels and annotations.
+	DefaultPodInfoDir = "/etc/podinfo"
+)
+
+var startTime = time.Now()
+
+type Build struct {
+	Number   string `json:"number"`
+	Datetime string `json:"datetime"`
+}
+
+type Commit struct {
+	Hash   string `json:"hash"`
+	Branch string `json:"branch"`
+	Time   string `json:"time,omitempty"`
+}
+
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Replace string `json:"replace,omitempty"`
+}
+
+type Go struct {
+	Version    string `json:"version"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+	NumCPU     int    `json:"num_cpu"`
+	Goroutines int    `json:"goroutines"`
+}
+
+type Process struct {
+	PID       int       `json:"pid"`
+	Hostname  string    `json:"hostname"`
+	StartTime time.Time `json:"start_time"`
+	Uptime    string    `json:"uptime"`
+}
+
+type Pod struct {
+	Name           string            `json:"name,omitempty"`
+	Namespace      string            `json:"namespace,omitempty"`
+	IP             string            `json:"ip,omitempty"`
+	Node           string            `json:"node,omitempty"`
+	ServiceAccount string            `json:"service_account,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+}
+
+// WhoAmI keeps the fields of the golang-common whoami response and adds runtime and pod info.
+type WhoAmI struct {
+	Service      string   `json:"service"`
+	Version      string   `json:"version"`
+	Build        Build    `json:"build"`
+	Commit       Commit   `json:"commit"`
+	Module       Module   `json:"module"`
+	Go           Go       `json:"go"`
+	Process      Process  `json:"process"`
+	Pod          Pod      `json:"pod"`
+	Dependencies []Module `json:"dependencies,omitempty"`
+	// Chaos lists the active fault injections, a pod misbehaving on purpose says so
+	Chaos []chaos.Injection `json:"chaos,omitempty"`
+}
+
+// Collect builds the WhoAmI, podInfoDir holds the Downward API labels and annotations files.
+// The ldflags values of golang-common whoami win, runtime/debug.ReadBuildInfo fills the blanks.
+func Collect(podInfoDir string, withDependencies bool) WhoAmI {
+	info := WhoAmI{
+		Service: whoami.Name(),
+		Version: whoami.Version(),
+		Build: Build{
+			Number:   whoami.BuildNumber(),
+			Datetime: whoami.BuildAt(),
+		},
+		Commit: Commit{
+			Hash:   whoami.CommitHash(),
+			Branch: whoami.CommitBranch(),
+		},
+		Go: Go{
+			Version:    runtime.Version(),
+			GOMAXPROCS: runtime.GOMAXPROCS(0),
+			NumCPU:     runtime.NumCPU(),
+			Goroutines: runtime.NumGoroutine(),
+		},
+		Process: Process{
+			PID:       os.Getpid(),
+			StartTime: startTime,
+			Uptime:    time.Since(startTime).Truncate(time.Second).String(),
+		},
+		Pod: Pod{
+			Name:           os.Getenv(EnvPodName),
+			Namespace:      os.Getenv(EnvPodNamespace),
+			IP:             os.Getenv(EnvPodIP),
+			Node:           os.Getenv(EnvNodeName),
+			ServiceAccount: os.Getenv(EnvPodServiceAccount),
+			Labels:         readKeyValueFile(filepath.Join(podInfoDir, "labels")),
+			Annotations:    readKeyValueFile(filepath.Join(podInfoDir, "annotations")),
+		},
+	}
+	info.Process.Hostname, _ = os.Hostname()
+	if info.Pod.Name == "" {
+		// the hostname of a pod is its name unless spec.hostname is set
+		info.Pod.Name = os.Getenv("HOSTNAME")
+	}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		addBuildInfo(&info, buildInfo, withDependencies)
+	}
+	return info
+}
+
+// addBuildInfo fills the fields left blank by the ldflags from buildInfo.
+func addBuildInfo(info *WhoAmI, buildInfo *debug.BuildInfo, withDependencies bool) {
+	info.Module = Module{Path: buildInfo.Main.Path, Version: buildInfo.Main.Version}
+	if info.Service == "" {
+		info.Service = filepath.Base(buildInfo.Path)
+	}
+	if info.Version == "" && buildInfo.Main.Version != "(devel)" {
+		info.Version = buildInfo.Main.Version
+	}
+	if info.Commit.Hash == "" {
+		var modified bool
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit.Hash = setting.Value
+			case "vcs.time":
+				info.Commit.Time = setting.Value
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if modified && info.Commit.Hash != "" {
+			info.Commit.Hash += "-dirty"
+		}
+	}
+	if withDependencies {
+		for _, dep := range buildInfo.Deps {
+			module := Module{Path: dep.Path, Version: dep.Version}
+			if dep.Replace != nil {
+				module.Replace = dep.Replace.Path + "@" + dep.Replace.Version
+			}
+			info.Dependencies = append(info.Dependencies, module)
+		}
+	}
+}
+
+// readKeyValueFile parses the Downward API volume format, one key="value" per line,
+// a missing file yields nil.
+func readKeyValueFile(path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := strconv.Unquote(parts[1])
+		if err != nil {
+			value = parts[1]
+		}
+		values[parts[0]] = value
+	}
+	return values
+}
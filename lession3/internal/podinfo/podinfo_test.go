@@ -0,0 +1,149 @@
+package podinfo
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"testing"
+)
+
+func TestAddBuildInfo(t *testing.T) {
+	buildInfo := &debug.BuildInfo{
+		Path: "k8s_learning/cmd/web",
+		Main: debug.Module{Path: "k8s_learning", Version: "v1.2.3"},
+		Deps: []*debug.Module{
+			{Path: "github.com/gin-gonic/gin", Version: "v1.6.3"},
+			{Path: "github.com/AfterShip/golang-common", Version: "v0.1.0", Replace: &debug.Module{Path: "../golang-common", Version: "v0.0.0"}},
+		},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "abc123"},
+			{Key: "vcs.time", Value: "2026-10-18T00:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		ldflags          WhoAmI
+		buildInfo        *debug.BuildInfo
+		withDependencies bool
+		want             WhoAmI
+	}{
+		{
+			name:      "blanks filled from the build info",
+			buildInfo: buildInfo,
+			want: WhoAmI{
+				Service: "web",
+				Version: "v1.2.3",
+				Commit:  Commit{Hash: "abc123-dirty", Time: "2026-10-18T00:00:00Z"},
+				Module:  Module{Path: "k8s_learning", Version: "v1.2.3"},
+			},
+		},
+		{
+			name: "ldflags win",
+			ldflags: WhoAmI{
+				Service: "notes",
+				Version: "2.0.0",
+				Commit:  Commit{Hash: "def456", Branch: "main"},
+			},
+			buildInfo: buildInfo,
+			want: WhoAmI{
+				Service: "notes",
+				Version: "2.0.0",
+				Commit:  Commit{Hash: "def456", Branch: "main"},
+				Module:  Module{Path: "k8s_learning", Version: "v1.2.3"},
+			},
+		},
+		{
+			name: "devel version and clean tree",
+			buildInfo: &debug.BuildInfo{
+				Path:     "k8s_learning/cmd/web",
+				Main:     debug.Module{Path: "k8s_learning", Version: "(devel)"},
+				Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "abc123"}, {Key: "vcs.modified", Value: "false"}},
+			},
+			want: WhoAmI{
+				Service: "web",
+				Commit:  Commit{Hash: "abc123"},
+				Module:  Module{Path: "k8s_learning", Version: "(devel)"},
+			},
+		},
+		{
+			name:             "dependencies",
+			ldflags:          WhoAmI{Service: "web", Version: "2.0.0", Commit: Commit{Hash: "def456"}},
+			buildInfo:        buildInfo,
+			withDependencies: true,
+			want: WhoAmI{
+				Service: "web",
+				Version: "2.0.0",
+				Commit:  Commit{Hash: "def456"},
+				Module:  Module{Path: "k8s_learning", Version: "v1.2.3"},
+				Dependencies: []Module{
+					{Path: "github.com/gin-gonic/gin", Version: "v1.6.3"},
+					{Path: "github.com/AfterShip/golang-common", Version: "v0.1.0", Replace: "../golang-common@v0.0.0"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := tt.ldflags
+			addBuildInfo(&info, tt.buildInfo, tt.withDependencies)
+			if !reflect.DeepEqual(info, tt.want) {
+				t.Errorf("addBuildInfo() = %+v, want %+v", info, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectPod(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"labels":      "app=\"web\"\npod-template-hash=\"5d8f7b\"\nmalformed\n",
+		"annotations": "kubernetes.io/config.seen=\"2026-10-18T00:00:00Z\"\nnote=\"line\\nbreak\"\nraw=unquoted\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, value := range map[string]string{
+		EnvPodName:           "web-5d8f7b-x2v9q",
+		EnvPodNamespace:      "default",
+		EnvPodIP:             "10.0.0.7",
+		EnvNodeName:          "node-1",
+		EnvPodServiceAccount: "web",
+	} {
+		t.Setenv(key, value)
+	}
+
+	want := Pod{
+		Name:           "web-5d8f7b-x2v9q",
+		Namespace:      "default",
+		IP:             "10.0.0.7",
+		Node:           "node-1",
+		ServiceAccount: "web",
+		Labels:         map[string]string{"app": "web", "pod-template-hash": "5d8f7b"},
+		Annotations: map[string]string{
+			"kubernetes.io/config.seen": "2026-10-18T00:00:00Z",
+			"note":                      "line\nbreak",
+			"raw":                       "unquoted",
+		},
+	}
+	if got := Collect(dir, false).Pod; !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect().Pod = %+v, want %+v", got, want)
+	}
+}
+
+func TestCollectOutsideKubernetes(t *testing.T) {
+	t.Setenv(EnvPodName, "")
+	t.Setenv("HOSTNAME", "laptop")
+
+	pod := Collect(filepath.Join(t.TempDir(), "missing"), false).Pod
+	if pod.Name != "laptop" {
+		t.Errorf("Pod.Name = %q, want the HOSTNAME fallback", pod.Name)
+	}
+	if pod.Labels != nil || pod.Annotations != nil {
+		t.Errorf("labels %v and annotations %v read from a missing directory", pod.Labels, pod.Annotations)
+	}
+}
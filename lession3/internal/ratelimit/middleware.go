@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/AfterShip/golang-common/errors"
+	"github.com/AfterShip/golang-common/http/server/gins"
+	"github.com/AfterShip/golang-common/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"k8s_learning/internal/auth"
+	"k8s_learning/internal/ginx"
+	"k8s_learning/internal/metrics"
+)
+
+const (
+	HeaderLimit      = "X-RateLimit-Limit"
+	HeaderRemaining  = "X-RateLimit-Remaining"
+	HeaderReset      = "X-RateLimit-Reset"
+	HeaderRetryAfter = "Retry-After"
+)
+
+var rejectedTotal = metrics.NewCounter(
+	"ratelimit_rejected_total",
+	"Number of requests rejected with 429 by policy.",
+	"policy",
+)
+
+// KeyFunc identifies the client of a request, an empty key is not limited.
+type KeyFunc func(c *gin.Context) string
+
+// ByIP keys clients by gin.Context.ClientIP.
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByPrincipal keys clients by the principal set by the auth middlewares, which must run before
+// the limiter; anonymous requests, including the ones with a credential that did not verify,
+// fall back to ByIP so that sending a new credential on every request gets no new bucket.
+func ByPrincipal(c *gin.Context) string {
+	if principal, ok := auth.PrincipalFromContext(c.Request.Context()); ok {
+		return principal.Method + ":" + principal.Subject
+	}
+	return ByIP(c)
+}
+
+// Policy is a named limit, requests of the same client share one state per policy.
+// A Policy without Algorithm does not limit, eg. to exempt a route from the default.
+type Policy struct {
+	Name      string
+	Algorithm Algorithm
+	Key       KeyFunc
+}
+
+type Option func(conf *conf)
+
+type conf struct {
+	defaultPolicy Policy
+	routePolicies map[string]Policy
+}
+
+// DefaultPolicy applies to the routes without a RoutePolicy.
+func DefaultPolicy(policy Policy) Option {
+	return func(conf *conf) {
+		conf.defaultPolicy = policy
+	}
+}
+
+// RoutePolicy applies to a route template, optionally prefixed by a method,
+// eg. "/v1/notes/:id" or "POST /v1/notes", the method form wins.
+func RoutePolicy(route string, policy Policy) Option {
+	return func(conf *conf) {
+		conf.routePolicies[route] = policy
+	}
+}
+
+// Middleware answers errors.ErrTooManyRequests once a client is over the policy of the route.
+// Limited requests carry the X-RateLimit-* headers, rejected ones Retry-After too.
+// A Store error lets the request through, the limit protects the service and must not take it down.
+func Middleware(store Store, opts ...Option) gin.HandlerFunc {
+	conf := &conf{
+		routePolicies: make(map[string]Policy),
+	}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return func(c *gin.Context) {
+		policy := conf.policyOf(c)
+		if policy.Algorithm == nil {
+			c.Next()
+			return
+		}
+		keyFunc := policy.Key
+		if keyFunc == nil {
+			keyFunc = ByIP
+		}
+		key := keyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		result, err := store.Take(ctx, policy.Name+":"+key, policy.Algorithm, time.Now())
+		if err != nil {
+			logger.Warn(ctx, "[WARNING] rate limit store failed, request let through",
+				zap.String("category", "rate_limit"), zap.String("policy", policy.Name), zap.Error(err))
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set(HeaderLimit, strconv.Itoa(result.Limit))
+		header.Set(HeaderRemaining, strconv.Itoa(result.Remaining))
+		header.Set(HeaderReset, strconv.Itoa(seconds(result.Reset)))
+		if result.Allowed {
+			c.Next()
+			return
+		}
+
+		retryAfter := seconds(result.RetryAfter)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		header.Set(HeaderRetryAfter, strconv.Itoa(retryAfter))
+		rejectedTotal.With(policy.Name).Inc()
+		gins.ResponseAPIErrorWithLogging(c, ctx, errors.APIErrorWithScene(errors.ErrTooManyRequests,
+			errors.Field("rate_limit_policy", policy.Name),
+			errors.Field("rate_limit", result.Limit),
+			errors.Field("retry_after_seconds", retryAfter),
+		))
+	}
+}
+
+func (conf *conf) policyOf(c *gin.Context) Policy {
+	route := ginx.Route(c)
+	if policy, ok := conf.routePolicies[c.Request.Method+" "+route]; ok {
+		return policy
+	}
+	if policy, ok := conf.routePolicies[route]; ok {
+		return policy
+	}
+	return conf.defaultPolicy
+}
+
+// seconds rounds up, a client retrying after a rounded down Retry-After would be rejected again.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
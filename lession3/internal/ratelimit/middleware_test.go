@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"k8s_learning/internal/auth"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestEngine limits GET /v1 with policy, principal is set beforehand when not empty,
+// as the auth middlewares would.
+func newTestEngine(policy Policy, principal string) *gin.Engine {
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		if principal != "" {
+			auth.SetPrincipal(c, &auth.Principal{Subject: principal, Method: auth.MethodAPIKey})
+		}
+	})
+	engine.Use(Middleware(NewMemoryStore(), DefaultPolicy(policy)))
+	engine.GET("/v1", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return engine
+}
+
+func TestByPrincipal(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal string
+		want      string
+	}{
+		{name: "authenticated", principal: "key-1", want: "api_key:key-1"},
+		{name: "anonymous falls back to ip", want: "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			engine := newTestEngine(Policy{}, tt.principal)
+			engine.GET("/key", func(c *gin.Context) { got = ByPrincipal(c) })
+			req := httptest.NewRequest(http.MethodGet, "/key", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			// an unverified key must not get its own bucket
+			req.Header.Set("am-api-key", "random")
+			engine.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Fatalf("ByPrincipal() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	policy := Policy{Name: "default", Algorithm: TokenBucket{Rate: 0.001, Burst: 2}, Key: ByPrincipal}
+	tests := []struct {
+		name       string
+		principal  string
+		apiKeys    []string
+		wantStatus []int
+	}{
+		{
+			name:       "anonymous random keys share the ip bucket",
+			apiKeys:    []string{"k1", "k2", "k3"},
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:       "principal limited",
+			principal:  "key-1",
+			apiKeys:    []string{"", "", ""},
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newTestEngine(policy, tt.principal)
+			for i, key := range tt.apiKeys {
+				req := httptest.NewRequest(http.MethodGet, "/v1", nil)
+				req.Header.Set("am-api-key", key)
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, req)
+				if w.Code != tt.wantStatus[i] {
+					t.Fatalf("request %d: status = %d, want %d", i, w.Code, tt.wantStatus[i])
+				}
+				if w.Header().Get(HeaderLimit) != "2" {
+					t.Fatalf("request %d: %s = %q, want 2", i, HeaderLimit, w.Header().Get(HeaderLimit))
+				}
+				if w.Code == http.StatusTooManyRequests && w.Header().Get(HeaderRetryAfter) == "" {
+					t.Fatalf("request %d: %s missing", i, HeaderRetryAfter)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package ratelimit limits requests per client with a token bucket or a sliding window,
+// the state of every client lives in a Store so it can be shared by the replicas.
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Result is the decision on one request.
+type Result struct {
+	Allowed bool
+	// Limit is the burst of a token bucket, the requests per window of a sliding window.
+	Limit     int
+	Remaining int
+	// Reset is how long until the client is back to its full limit.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed, zero when allowed.
+	RetryAfter time.Duration
+}
+
+// State is what a Store keeps per key, each algorithm uses its own fields.
+type State struct {
+	// token bucket
+	Tokens  float64
+	Updated time.Time
+
+	// sliding window
+	WindowStart time.Time
+	Current     int
+	Previous    int
+}
+
+// Algorithm decides on a request and updates the state of its key,
+// Take is called by the Store with the state locked.
+type Algorithm interface {
+	Take(state *State, now time.Time) Result
+	// Idle is how long an untouched state takes to be equal to a new one, so it can be evicted.
+	Idle() time.Duration
+}
+
+// TokenBucket refills Rate tokens per second up to Burst, every request takes one.
+type TokenBucket struct {
+	Rate  float64
+	Burst int
+}
+
+func (b TokenBucket) Take(state *State, now time.Time) Result {
+	burst := float64(b.Burst)
+	if state.Updated.IsZero() {
+		state.Tokens = burst
+	} else if elapsed := now.Sub(state.Updated).Seconds(); elapsed > 0 {
+		state.Tokens = math.Min(burst, state.Tokens+elapsed*b.Rate)
+	}
+	state.Updated = now
+
+	result := Result{Limit: b.Burst}
+	if state.Tokens >= 1 {
+		state.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = b.duration(1 - state.Tokens)
+	}
+	result.Remaining = int(state.Tokens)
+	result.Reset = b.duration(burst - state.Tokens)
+	return result
+}
+
+func (b TokenBucket) Idle() time.Duration {
+	return b.duration(float64(b.Burst))
+}
+
+// duration is the time to refill the given tokens.
+func (b TokenBucket) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / b.Rate * float64(time.Second))
+}
+
+// SlidingWindow allows Limit requests per Window, the count of the previous fixed window
+// is weighted by its overlap with the sliding one, which smooths the bursts at window edges.
+type SlidingWindow struct {
+	Limit  int
+	Window time.Duration
+}
+
+func (w SlidingWindow) Take(state *State, now time.Time) Result {
+	start := now.Truncate(w.Window)
+	if !state.WindowStart.Equal(start) {
+		if state.WindowStart.Add(w.Window).Equal(start) {
+			state.Previous = state.Current
+		} else {
+			state.Previous = 0
+		}
+		state.Current = 0
+		state.WindowStart = start
+	}
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(w.Window)
+	estimated := float64(state.Previous)*weight + float64(state.Current)
+
+	result := Result{Limit: w.Limit}
+	if estimated+1 <= float64(w.Limit) {
+		state.Current++
+		estimated++
+		result.Allowed = true
+	} else if state.Current < w.Limit && state.Previous > 0 {
+		// wait for the previous window to slide out enough to fit one more
+		target := 1 - float64(w.Limit-1-state.Current)/float64(state.Previous)
+		result.RetryAfter = time.Duration(target*float64(w.Window)) - elapsed
+	} else {
+		result.RetryAfter = w.Window - elapsed
+	}
+	if result.RetryAfter < 0 {
+		result.RetryAfter = 0
+	}
+	result.Remaining = int(math.Max(0, math.Floor(float64(w.Limit)-estimated)))
+	if state.Current > 0 {
+		result.Reset = 2*w.Window - elapsed
+	} else {
+		result.Reset = w.Window - elapsed
+	}
+	return result
+}
+
+func (w SlidingWindow) Idle() time.Duration {
+	return 2 * w.Window
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, 5, 15, 0, 0, 0, 0, time.UTC)
+
+// step is a request at offset from epoch and the decision expected on it.
+type step struct {
+	at          time.Duration
+	wantAllowed bool
+}
+
+func TestTokenBucketTake(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket TokenBucket
+		steps  []step
+	}{
+		{
+			name:   "burst then rejected",
+			bucket: TokenBucket{Rate: 1, Burst: 2},
+			steps:  []step{{0, true}, {0, true}, {0, false}},
+		},
+		{
+			name:   "refills at rate",
+			bucket: TokenBucket{Rate: 2, Burst: 1},
+			steps:  []step{{0, true}, {100 * time.Millisecond, false}, {500 * time.Millisecond, true}},
+		},
+		{
+			name:   "refill capped at burst",
+			bucket: TokenBucket{Rate: 10, Burst: 2},
+			steps:  []step{{0, true}, {time.Hour, true}, {time.Hour, true}, {time.Hour, false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state State
+			for i, s := range tt.steps {
+				result := tt.bucket.Take(&state, epoch.Add(s.at))
+				if result.Allowed != s.wantAllowed {
+					t.Fatalf("step %d: Allowed = %v, want %v", i, result.Allowed, s.wantAllowed)
+				}
+				if !result.Allowed && result.RetryAfter <= 0 {
+					t.Fatalf("step %d: RetryAfter = %s, want positive", i, result.RetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestSlidingWindowTake(t *testing.T) {
+	tests := []struct {
+		name   string
+		window SlidingWindow
+		steps  []step
+	}{
+		{
+			name:   "limit within a window",
+			window: SlidingWindow{Limit: 2, Window: time.Second},
+			steps:  []step{{0, true}, {100 * time.Millisecond, true}, {200 * time.Millisecond, false}},
+		},
+		{
+			name:   "previous window weighted",
+			window: SlidingWindow{Limit: 2, Window: time.Second},
+			// 2 in the first window, half of them still count at 1.5s
+			steps: []step{{0, true}, {0, true}, {1500 * time.Millisecond, true}, {1500 * time.Millisecond, false}},
+		},
+		{
+			name:   "idle windows forgotten",
+			window: SlidingWindow{Limit: 1, Window: time.Second},
+			steps:  []step{{0, true}, {0, false}, {3 * time.Second, true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state State
+			for i, s := range tt.steps {
+				result := tt.window.Take(&state, epoch.Add(s.at))
+				if result.Allowed != s.wantAllowed {
+					t.Fatalf("step %d: Allowed = %v, want %v", i, result.Allowed, s.wantAllowed)
+				}
+				if !result.Allowed && result.RetryAfter <= 0 {
+					t.Fatalf("step %d: RetryAfter = %s, want positive", i, result.RetryAfter)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps the state of every key, eg. in memory or in redis for a limit shared by the replicas.
+type Store interface {
+	// Take runs algorithm on the state of key atomically.
+	Take(ctx context.Context, key string, algorithm Algorithm, now time.Time) (Result, error)
+}
+
+type MemoryStoreOption func(s *MemoryStore)
+
+// MaxKeys bounds the number of keys, the least recently used key is evicted to make room, default 100000.
+func MaxKeys(n int) MemoryStoreOption {
+	return func(s *MemoryStore) {
+		s.maxKeys = n
+	}
+}
+
+// SweepInterval is how often idle keys are dropped, default 1m.
+func SweepInterval(interval time.Duration) MemoryStoreOption {
+	return func(s *MemoryStore) {
+		s.sweepInterval = interval
+	}
+}
+
+// MemoryStore is a Store local to the process, a limit of N per replica is N * replicas overall.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds the *memoryEntry values, most recently used first
+	lru           *list.List
+	maxKeys       int
+	sweepInterval time.Duration
+	lastSweep     time.Time
+}
+
+type memoryEntry struct {
+	key     string
+	state   State
+	expires time.Time
+}
+
+func NewMemoryStore(opts ...MemoryStoreOption) *MemoryStore {
+	s := &MemoryStore{
+		entries:       make(map[string]*list.Element),
+		lru:           list.New(),
+		maxKeys:       100000,
+		sweepInterval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, algorithm Algorithm, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// sweeping on the request path avoids a goroutine to stop
+	if now.Sub(s.lastSweep) >= s.sweepInterval {
+		s.sweep(now)
+	}
+	var entry *memoryEntry
+	if elem, ok := s.entries[key]; ok {
+		entry = elem.Value.(*memoryEntry)
+		s.lru.MoveToFront(elem)
+		if !now.Before(entry.expires) {
+			entry.state = State{}
+		}
+	} else {
+		for len(s.entries) >= s.maxKeys {
+			s.remove(s.lru.Back())
+		}
+		entry = &memoryEntry{key: key}
+		s.entries[key] = s.lru.PushFront(entry)
+	}
+	result := algorithm.Take(&entry.state, now)
+	entry.expires = now.Add(algorithm.Idle())
+	return result, nil
+}
+
+// Len is the number of keys held, expired ones included until the next sweep.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// sweep drops the expired keys from the least recently used end, up to the first live one.
+// A live key with a longer idle time than the ones used after it keeps them until it expires,
+// they are reset when used again and evicted first when the store is full.
+func (s *MemoryStore) sweep(now time.Time) {
+	for elem := s.lru.Back(); elem != nil && !now.Before(elem.Value.(*memoryEntry).expires); elem = s.lru.Back() {
+		s.remove(elem)
+	}
+	s.lastSweep = now
+}
+
+func (s *MemoryStore) remove(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.entries, elem.Value.(*memoryEntry).key)
+}
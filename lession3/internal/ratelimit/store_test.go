@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	bucket := TokenBucket{Rate: 1, Burst: 1}
+	tests := []struct {
+		name string
+		// keys are taken in order, at epoch plus the index in seconds when spaced
+		keys        []string
+		spaced      bool
+		maxKeys     int
+		wantAllowed []bool
+		wantLen     int
+	}{
+		{
+			name:        "keys are independent",
+			keys:        []string{"a", "b", "a"},
+			maxKeys:     10,
+			wantAllowed: []bool{true, true, false},
+			wantLen:     2,
+		},
+		{
+			name:        "least recently used evicted",
+			keys:        []string{"a", "b", "a", "c", "a", "b"},
+			maxKeys:     2,
+			wantAllowed: []bool{true, true, false, true, false, true},
+			wantLen:     2,
+		},
+		{
+			name:        "expired state starts over",
+			keys:        []string{"a", "a", "a"},
+			spaced:      true,
+			maxKeys:     10,
+			wantAllowed: []bool{true, true, true},
+			wantLen:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore(MaxKeys(tt.maxKeys), SweepInterval(time.Hour))
+			for i, key := range tt.keys {
+				now := epoch
+				if tt.spaced {
+					now = epoch.Add(time.Duration(i) * time.Second)
+				}
+				result, err := store.Take(context.Background(), key, bucket, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Allowed != tt.wantAllowed[i] {
+					t.Fatalf("take %d of %q: Allowed = %v, want %v", i, key, result.Allowed, tt.wantAllowed[i])
+				}
+			}
+			if got := store.Len(); got != tt.wantLen {
+				t.Fatalf("Len() = %d, want %d", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreBounded(t *testing.T) {
+	store := NewMemoryStore(MaxKeys(100))
+	bucket := TokenBucket{Rate: 1, Burst: 1}
+	for i := 0; i < 10000; i++ {
+		if _, err := store.Take(context.Background(), fmt.Sprintf("junk-%d", i), bucket, epoch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := store.Len(); got != 100 {
+		t.Fatalf("Len() = %d, want 100", got)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore(SweepInterval(time.Minute))
+	bucket := TokenBucket{Rate: 1, Burst: 1}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := store.Take(context.Background(), key, bucket, epoch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Take(context.Background(), "d", bucket, epoch.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Len(); got != 1 {
+		t.Fatalf("Len() after sweep = %d, want 1", got)
+	}
+}
+
+func TestMemoryStoreSweepStopsAtLiveKey(t *testing.T) {
+	store := NewMemoryStore(SweepInterval(time.Minute))
+	window := SlidingWindow{Limit: 1, Window: time.Hour}
+	bucket := TokenBucket{Rate: 1, Burst: 1}
+	if _, err := store.Take(context.Background(), "hourly", window, epoch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Take(context.Background(), "a", bucket, epoch.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// "hourly" is live until epoch+2h and least recently used, the sweep stops there
+	if _, err := store.Take(context.Background(), "b", bucket, epoch.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Len(); got != 3 {
+		t.Fatalf("Len() after sweep = %d, want 3", got)
+	}
+	if _, err := store.Take(context.Background(), "c", bucket, epoch.Add(3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Len(); got != 1 {
+		t.Fatalf("Len() after the live key expired = %d, want 1", got)
+	}
+}
@@ -0,0 +1,62 @@
+// Package tracing complements github.com/AfterShip/golang-common/tracing with what travels
+// between services besides the trace ID: the remaining time budget of a request and the spans,
+// propagated with W3C traceparent and x-cloud-trace-context.
+package tracing
+
+import (
+	"context"
+	stderrors "errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HeaderRequestTimeout carries the time budget left to the callee, in milliseconds.
+const HeaderRequestTimeout = "X-Request-Timeout"
+
+// DefaultDeadlineMargin is kept by the caller to receive and handle the answer of the callee.
+const DefaultDeadlineMargin = 50 * time.Millisecond
+
+// ErrInvalidRequestTimeout is returned by ParseRequestTimeout for a value that is not a number
+// of milliseconds.
+var ErrInvalidRequestTimeout = stderrors.New("tracing: request timeout must be a non-negative integer of milliseconds")
+
+// ParseRequestTimeout reads a HeaderRequestTimeout value, 0 means the budget is spent.
+func ParseRequestTimeout(value string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, ErrInvalidRequestTimeout
+	}
+	if ms > math.MaxInt64/int64(time.Millisecond) {
+		return math.MaxInt64, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// FormatRequestTimeout renders budget as a HeaderRequestTimeout value, rounded down
+// so the callee never believes it has more time than the caller.
+func FormatRequestTimeout(budget time.Duration) string {
+	if budget < 0 {
+		budget = 0
+	}
+	return strconv.FormatInt(int64(budget/time.Millisecond), 10)
+}
+
+// OutboundRequestTimeout is the HeaderRequestTimeout value of a call made under ctx,
+// the time left to its deadline minus margin. ok is false when ctx has no deadline.
+func OutboundRequestTimeout(ctx context.Context, margin time.Duration) (value string, ok bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return "", false
+	}
+	return FormatRequestTimeout(time.Until(deadline) - margin), true
+}
+
+// SetRequestTimeoutHeader sets HeaderRequestTimeout on the header of an outbound request
+// when ctx has a deadline.
+func SetRequestTimeoutHeader(ctx context.Context, header http.Header, margin time.Duration) {
+	if value, ok := OutboundRequestTimeout(ctx, margin); ok {
+		header.Set(HeaderRequestTimeout, value)
+	}
+}
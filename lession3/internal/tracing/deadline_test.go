@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRequestTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "1500", want: 1500 * time.Millisecond},
+		{value: "0", want: 0},
+		{value: "9223372036854775807", want: math.MaxInt64},
+		{value: "", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "1.5", wantErr: true},
+		{value: "1s", wantErr: true},
+		{value: " 100", wantErr: true},
+		{value: "99999999999999999999", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseRequestTimeout(tt.value)
+			if tt.wantErr {
+				if err != ErrInvalidRequestTimeout {
+					t.Fatalf("ParseRequestTimeout() error = %v, want ErrInvalidRequestTimeout", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("ParseRequestTimeout() = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRequestTimeout(t *testing.T) {
+	tests := []struct {
+		budget time.Duration
+		want   string
+	}{
+		{budget: 1500 * time.Millisecond, want: "1500"},
+		{budget: 1999 * time.Microsecond, want: "1"},
+		{budget: 0, want: "0"},
+		{budget: -time.Second, want: "0"},
+	}
+	for _, tt := range tests {
+		if got := FormatRequestTimeout(tt.budget); got != tt.want {
+			t.Errorf("FormatRequestTimeout(%s) = %q, want %q", tt.budget, got, tt.want)
+		}
+	}
+}
+
+func TestSetRequestTimeoutHeader(t *testing.T) {
+	header := http.Header{}
+	SetRequestTimeoutHeader(context.Background(), header, DefaultDeadlineMargin)
+	if _, ok := header[HeaderRequestTimeout]; ok {
+		t.Fatalf("header set without deadline: %v", header)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	SetRequestTimeoutHeader(ctx, header, DefaultDeadlineMargin)
+	budget, err := ParseRequestTimeout(header.Get(HeaderRequestTimeout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := time.Second - DefaultDeadlineMargin; budget > max || budget < max-100*time.Millisecond {
+		t.Fatalf("budget = %s, want about %s", budget, max)
+	}
+}
@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/AfterShip/golang-common/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/net/trace"
+)
+
+// EventsLogOff disables the mirroring of events to logger.
+const EventsLogOff = "off"
+
+// FamilyComponent is the family of the events of lifecycle components, see ComponentEvents.
+const FamilyComponent = "component"
+
+var eventsLogLevels = map[string]zapcore.Level{
+	"debug": zapcore.DebugLevel,
+	"info":  zapcore.InfoLevel,
+	"warn":  zapcore.WarnLevel,
+	"error": zapcore.ErrorLevel,
+}
+
+// ValidEventsLogLevel tells whether SetEventsLogLevel accepts level.
+func ValidEventsLogLevel(level string) bool {
+	_, ok := eventsLogLevels[level]
+	return ok || level == EventsLogOff
+}
+
+var loggerLevels = map[zapcore.Level]string{
+	zapcore.DebugLevel: logger.LogLevelDebug,
+	zapcore.InfoLevel:  logger.LogLevelInfo,
+	zapcore.WarnLevel:  logger.LogLevelWarn,
+	zapcore.ErrorLevel: logger.LogLevelError,
+}
+
+var events = struct {
+	sync.Mutex
+	byKey    map[string]*Events
+	level    zapcore.Level
+	disabled bool
+}{byKey: make(map[string]*Events), level: zapcore.InfoLevel}
+
+// SetEventsLogLevel sets the level events are mirrored to logger at: debug, info, warn, error
+// or off, default info. Errors are mirrored at warn at least.
+func SetEventsLogLevel(level string) error {
+	events.Lock()
+	defer events.Unlock()
+	if level == EventsLogOff {
+		events.disabled = true
+		return nil
+	}
+	l, ok := eventsLogLevels[level]
+	if !ok {
+		return fmt.Errorf("tracing: events log level must be debug, info, warn, error or off, got %q", level)
+	}
+	events.level, events.disabled = l, false
+	return nil
+}
+
+// Events is the golang.org/x/net/trace.EventLog of a long-lived component, shown on
+// /debug/events of the admin listener and mirrored to logger with category "events".
+// It also holds the state of the component, so that Transition only records changes.
+type Events struct {
+	family string
+	title  string
+	log    trace.EventLog
+
+	mu    sync.Mutex
+	state string
+}
+
+// EventsOf returns the event log of title in family, created on first use
+// and shared by every caller asking for the same pair.
+func EventsOf(family, title string) *Events {
+	key := family + "\x00" + title
+	events.Lock()
+	defer events.Unlock()
+	e, ok := events.byKey[key]
+	if !ok {
+		e = &Events{family: family, title: title, log: trace.NewEventLog(family, title)}
+		events.byKey[key] = e
+	}
+	return e
+}
+
+// ComponentEvents returns the event log of a lifecycle component, which records its
+// transitions on its own; the component adds what it does in between.
+func ComponentEvents(name string) *Events {
+	return EventsOf(FamilyComponent, name)
+}
+
+// Printf records an event.
+func (e *Events) Printf(format string, a ...interface{}) {
+	e.log.Printf(format, a...)
+	e.mirror(false, fmt.Sprintf(format, a...))
+}
+
+// Errorf records an error, listed under the errors of the family on /debug/events.
+func (e *Events) Errorf(format string, a ...interface{}) {
+	e.log.Errorf(format, a...)
+	e.mirror(true, fmt.Sprintf(format, a...))
+}
+
+// Transition records the change of state, as an error when err is not nil.
+// It records nothing when the state did not change.
+func (e *Events) Transition(state string, err error) bool {
+	e.mu.Lock()
+	from := e.state
+	e.state = state
+	e.mu.Unlock()
+	if from == state {
+		return false
+	}
+	if from == "" {
+		from = "none"
+	}
+	if err != nil {
+		e.Errorf("%s -> %s: %v", from, state, err)
+	} else {
+		e.Printf("%s -> %s", from, state)
+	}
+	return true
+}
+
+// State is the last state passed to Transition.
+func (e *Events) State() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.state
+}
+
+func (e *Events) mirror(isError bool, msg string) {
+	events.Lock()
+	level, disabled := events.level, events.disabled
+	events.Unlock()
+	if disabled {
+		return
+	}
+	if isError && level < zapcore.WarnLevel {
+		level = zapcore.WarnLevel
+	}
+	logger.Print(context.Background(), loggerLevels[level], fmt.Sprintf("[%s] %s: %s", e.family, e.title, msg),
+		zap.String("category", "events"),
+		zap.String("family", e.family),
+		zap.String("title", e.title),
+		zap.String("state", e.State()),
+	)
+}
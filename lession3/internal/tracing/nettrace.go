@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/net/trace"
+)
+
+// maxEvents of a request trace, the x/net/trace default of 10 is short once outbound calls are traced.
+const maxEvents = 50
+
+type requestTraceKey struct{}
+
+// RequestTrace is the golang.org/x/net/trace.Trace of a request, shown on /debug/requests of the
+// admin listener. Events added after Finish, eg. by a goroutine the handler left running, are
+// dropped: x/net/trace recycles finished traces.
+type RequestTrace struct {
+	mu       sync.Mutex
+	tr       trace.Trace
+	finished bool
+}
+
+// NewRequestTrace opens a trace in family, the route template, and returns ctx carrying it.
+func NewRequestTrace(ctx context.Context, family, title string) (context.Context, *RequestTrace) {
+	tr := trace.New(family, title)
+	tr.SetMaxEvents(maxEvents)
+	t := &RequestTrace{tr: tr}
+	return context.WithValue(ctx, requestTraceKey{}, t), t
+}
+
+// RequestTraceFromContext returns the trace opened by NewRequestTrace, nil without one.
+func RequestTraceFromContext(ctx context.Context) *RequestTrace {
+	t, _ := ctx.Value(requestTraceKey{}).(*RequestTrace)
+	return t
+}
+
+// LazyPrintf adds an event, formatted only when /debug/requests renders it.
+func (t *RequestTrace) LazyPrintf(format string, a ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.finished {
+		t.tr.LazyPrintf(format, a...)
+	}
+}
+
+// SetError files the trace under the errors of its family.
+func (t *RequestTrace) SetError() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.finished {
+		t.tr.SetError()
+	}
+}
+
+func (t *RequestTrace) Finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.finished {
+		t.finished = true
+		t.tr.Finish()
+	}
+}
+
+// LazyPrintf adds an event to the request trace of ctx, if any, so that handlers and the
+// outbound client can show what a request did on /debug/requests.
+func LazyPrintf(ctx context.Context, format string, a ...interface{}) {
+	if t := RequestTraceFromContext(ctx); t != nil {
+		t.LazyPrintf(format, a...)
+	}
+}
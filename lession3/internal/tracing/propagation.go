@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	commontracing "github.com/AfterShip/golang-common/tracing"
+)
+
+const (
+	// HeaderTraceparent is the W3C Trace Context header: version-trace_id-parent_id-flags.
+	HeaderTraceparent = "traceparent"
+	// HeaderTracestate is the vendor specific part of W3C Trace Context, passed on as is.
+	HeaderTracestate = "tracestate"
+
+	traceparentVersion = "00"
+	flagSampled        = 0x01
+	maxTracestateLen   = 512
+)
+
+// ParseTraceparent parses a W3C traceparent, rejecting version ff and zero IDs.
+// Versions after 00 are read as 00, as the specification asks.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return sc, fmt.Errorf("tracing: traceparent %q: want 4 fields", value)
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || !isLowerHex(version) || version == "ff" {
+		return sc, fmt.Errorf("tracing: traceparent %q: invalid version", value)
+	}
+	if version == traceparentVersion && len(parts) != 4 {
+		return sc, fmt.Errorf("tracing: traceparent %q: want 4 fields", value)
+	}
+	if len(traceID) != 32 || !isLowerHex(traceID) {
+		return sc, fmt.Errorf("tracing: traceparent %q: invalid trace id", value)
+	}
+	if len(spanID) != 16 || !isLowerHex(spanID) {
+		return sc, fmt.Errorf("tracing: traceparent %q: invalid parent id", value)
+	}
+	if len(flags) != 2 || !isLowerHex(flags) {
+		return sc, fmt.Errorf("tracing: traceparent %q: invalid flags", value)
+	}
+	_, _ = hex.Decode(sc.TraceID[:], []byte(traceID))
+	_, _ = hex.Decode(sc.SpanID[:], []byte(spanID))
+	if !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return SpanContext{}, fmt.Errorf("tracing: traceparent %q: zero id", value)
+	}
+	f, _ := strconv.ParseUint(flags, 16, 8)
+	sc.Sampled = f&flagSampled != 0
+	return sc, nil
+}
+
+// FormatTraceparent writes sc as a version 00 traceparent.
+func FormatTraceparent(sc SpanContext) string {
+	flags := 0
+	if sc.Sampled {
+		flags = flagSampled
+	}
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseCloudTraceContext parses x-cloud-trace-context, TRACE_ID[/SPAN_ID][;o=OPTIONS],
+// the span ID being a decimal uint64 and o=1 telling the trace is sampled.
+func ParseCloudTraceContext(value string) (SpanContext, error) {
+	var sc SpanContext
+	value = strings.TrimSpace(value)
+	options := ""
+	if i := strings.IndexByte(value, ';'); i >= 0 {
+		value, options = value[:i], value[i+1:]
+	}
+	traceID, spanID := value, ""
+	if i := strings.IndexByte(value, '/'); i >= 0 {
+		traceID, spanID = value[:i], value[i+1:]
+	}
+	traceID = strings.ToLower(traceID)
+	if len(traceID) != 32 || !isLowerHex(traceID) {
+		return sc, fmt.Errorf("tracing: x-cloud-trace-context %q: invalid trace id", value)
+	}
+	_, _ = hex.Decode(sc.TraceID[:], []byte(traceID))
+	if !sc.TraceID.IsValid() {
+		return SpanContext{}, fmt.Errorf("tracing: x-cloud-trace-context %q: zero trace id", value)
+	}
+	if spanID != "" {
+		id, err := strconv.ParseUint(spanID, 10, 64)
+		if err != nil {
+			return SpanContext{}, fmt.Errorf("tracing: x-cloud-trace-context %q: invalid span id", value)
+		}
+		binary.BigEndian.PutUint64(sc.SpanID[:], id)
+	}
+	sc.Sampled = options == "o=1"
+	return sc, nil
+}
+
+// FormatCloudTraceContext writes sc as x-cloud-trace-context.
+func FormatCloudTraceContext(sc SpanContext) string {
+	o := 0
+	if sc.Sampled {
+		o = 1
+	}
+	return fmt.Sprintf("%s/%d;o=%d", sc.TraceID, binary.BigEndian.Uint64(sc.SpanID[:]), o)
+}
+
+// Extract reads the span context sent by the caller, from traceparent and tracestate, or
+// from x-cloud-trace-context when traceparent is missing or invalid. The span context is
+// not valid when neither header could be parsed.
+func Extract(header http.Header) SpanContext {
+	if sc, err := ParseTraceparent(header.Get(HeaderTraceparent)); err == nil {
+		if state := strings.TrimSpace(strings.Join(header.Values(HeaderTracestate), ",")); len(state) <= maxTracestateLen {
+			sc.TraceState = state
+		}
+		sc.Remote = true
+		return sc
+	}
+	if sc, err := ParseCloudTraceContext(header.Get(commontracing.HeaderXCloudTraceContext)); err == nil {
+		sc.Remote = true
+		return sc
+	}
+	return SpanContext{}
+}
+
+// Inject sets traceparent, tracestate and x-cloud-trace-context of header to the span context of ctx.
+func Inject(ctx context.Context, header http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(HeaderTraceparent, FormatTraceparent(sc))
+	if sc.TraceState != "" {
+		header.Set(HeaderTracestate, sc.TraceState)
+	} else {
+		header.Del(HeaderTracestate)
+	}
+	header.Set(commontracing.HeaderXCloudTraceContext, FormatCloudTraceContext(sc))
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
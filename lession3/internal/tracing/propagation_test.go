@@ -0,0 +1,256 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func mustSpanContext(t *testing.T, traceparent string) SpanContext {
+	t.Helper()
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+func TestParseTraceparent(t *testing.T) {
+	zeroTraceID := strings.Repeat("0", 32)
+	zeroSpanID := strings.Repeat("0", 16)
+	tests := []struct {
+		name        string
+		value       string
+		wantErr     bool
+		wantSampled bool
+	}{
+		{name: "sampled", value: "00-" + testTraceID + "-" + testSpanID + "-01", wantSampled: true},
+		{name: "not sampled", value: "00-" + testTraceID + "-" + testSpanID + "-00"},
+		{name: "other flags", value: "00-" + testTraceID + "-" + testSpanID + "-03", wantSampled: true},
+		{name: "surrounding spaces", value: " 00-" + testTraceID + "-" + testSpanID + "-01 ", wantSampled: true},
+		{name: "future version", value: "cc-" + testTraceID + "-" + testSpanID + "-01", wantSampled: true},
+		{name: "future version with more fields", value: "cc-" + testTraceID + "-" + testSpanID + "-01-what-the-future-holds", wantSampled: true},
+		{name: "version 00 with more fields", value: "00-" + testTraceID + "-" + testSpanID + "-01-extra", wantErr: true},
+		{name: "version ff", value: "ff-" + testTraceID + "-" + testSpanID + "-01", wantErr: true},
+		{name: "uppercase version", value: "0A-" + testTraceID + "-" + testSpanID + "-01", wantErr: true},
+		{name: "zero trace id", value: "00-" + zeroTraceID + "-" + testSpanID + "-01", wantErr: true},
+		{name: "zero parent id", value: "00-" + testTraceID + "-" + zeroSpanID + "-01", wantErr: true},
+		{name: "uppercase trace id", value: "00-" + strings.ToUpper(testTraceID) + "-" + testSpanID + "-01", wantErr: true},
+		{name: "uppercase parent id", value: "00-" + testTraceID + "-" + strings.ToUpper("00f067aa0ba902bb") + "-01", wantErr: true},
+		{name: "uppercase flags", value: "00-" + testTraceID + "-" + testSpanID + "-0A", wantErr: true},
+		{name: "short trace id", value: "00-" + testTraceID[1:] + "-" + testSpanID + "-01", wantErr: true},
+		{name: "short flags", value: "00-" + testTraceID + "-" + testSpanID + "-1", wantErr: true},
+		{name: "missing field", value: "00-" + testTraceID + "-" + testSpanID, wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTraceparent() = %+v, want an error", sc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTraceparent() error = %v", err)
+			}
+			if sc.TraceID.String() != testTraceID || sc.SpanID.String() != testSpanID || sc.Sampled != tt.wantSampled {
+				t.Fatalf("ParseTraceparent() = %s %s sampled %v, want %s %s sampled %v",
+					sc.TraceID, sc.SpanID, sc.Sampled, testTraceID, testSpanID, tt.wantSampled)
+			}
+		})
+	}
+}
+
+func TestFormatTraceparent(t *testing.T) {
+	for _, value := range []string{
+		"00-" + testTraceID + "-" + testSpanID + "-01",
+		"00-" + testTraceID + "-" + testSpanID + "-00",
+	} {
+		if got := FormatTraceparent(mustSpanContext(t, value)); got != value {
+			t.Errorf("FormatTraceparent(ParseTraceparent(%q)) = %q", value, got)
+		}
+	}
+	// later versions and flags other than sampled are written back as version 00
+	sc := mustSpanContext(t, "cc-"+testTraceID+"-"+testSpanID+"-03-extra")
+	if got, want := FormatTraceparent(sc), "00-"+testTraceID+"-"+testSpanID+"-01"; got != want {
+		t.Errorf("FormatTraceparent() = %q, want %q", got, want)
+	}
+}
+
+func TestParseCloudTraceContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantErr     bool
+		wantSpanID  string
+		wantSampled bool
+		// wantFormat is FormatCloudTraceContext of the result
+		wantFormat string
+	}{
+		{
+			name:        "sampled",
+			value:       testTraceID + "/1;o=1",
+			wantSpanID:  "0000000000000001",
+			wantSampled: true,
+			wantFormat:  testTraceID + "/1;o=1",
+		},
+		{
+			name:       "not sampled",
+			value:      testTraceID + "/18446744073709551615;o=0",
+			wantSpanID: "ffffffffffffffff",
+			wantFormat: testTraceID + "/18446744073709551615;o=0",
+		},
+		{
+			name:       "without options",
+			value:      testTraceID + "/12345",
+			wantSpanID: "0000000000003039",
+			wantFormat: testTraceID + "/12345;o=0",
+		},
+		{
+			name:        "without span id",
+			value:       testTraceID + ";o=1",
+			wantSpanID:  "0000000000000000",
+			wantSampled: true,
+			wantFormat:  testTraceID + "/0;o=1",
+		},
+		{
+			name:        "uppercase trace id",
+			value:       strings.ToUpper(testTraceID) + "/1;o=1",
+			wantSpanID:  "0000000000000001",
+			wantSampled: true,
+			wantFormat:  testTraceID + "/1;o=1",
+		},
+		{name: "hex span id", value: testTraceID + "/00f067aa0ba902b7;o=1", wantErr: true},
+		{name: "span id overflow", value: testTraceID + "/18446744073709551616;o=1", wantErr: true},
+		{name: "zero trace id", value: strings.Repeat("0", 32) + "/1;o=1", wantErr: true},
+		{name: "short trace id", value: testTraceID[1:] + "/1;o=1", wantErr: true},
+		{name: "am-trace-id", value: "8957898503b9414c8607cf0d7bb320ab/0", wantSpanID: "0000000000000000", wantFormat: "8957898503b9414c8607cf0d7bb320ab/0;o=0"},
+		{name: "empty", value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseCloudTraceContext(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseCloudTraceContext() = %+v, want an error", sc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCloudTraceContext() error = %v", err)
+			}
+			if sc.SpanID.String() != tt.wantSpanID || sc.Sampled != tt.wantSampled {
+				t.Fatalf("ParseCloudTraceContext() = span %s sampled %v, want span %s sampled %v", sc.SpanID, sc.Sampled, tt.wantSpanID, tt.wantSampled)
+			}
+			got := FormatCloudTraceContext(sc)
+			if got != tt.wantFormat {
+				t.Fatalf("FormatCloudTraceContext() = %q, want %q", got, tt.wantFormat)
+			}
+			again, err := ParseCloudTraceContext(got)
+			if err != nil || again != sc {
+				t.Fatalf("ParseCloudTraceContext(%q) = %+v, %v, want %+v", got, again, err, sc)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	traceparent := "00-" + testTraceID + "-" + testSpanID + "-01"
+	cloudTraceID := "105445aa7843bc8bf206b12000100000"
+	cloud := cloudTraceID + "/1;o=1"
+	tests := []struct {
+		name           string
+		headers        http.Header
+		wantTraceID    string
+		wantTraceState string
+	}{
+		{name: "none"},
+		{
+			name:        "traceparent first",
+			headers:     http.Header{"Traceparent": {traceparent}, "X-Cloud-Trace-Context": {cloud}},
+			wantTraceID: testTraceID,
+		},
+		{
+			name:        "x-cloud-trace-context when traceparent is invalid",
+			headers:     http.Header{"Traceparent": {"ff-" + testTraceID + "-" + testSpanID + "-01"}, "X-Cloud-Trace-Context": {cloud}},
+			wantTraceID: cloudTraceID,
+		},
+		{
+			name:        "x-cloud-trace-context alone",
+			headers:     http.Header{"X-Cloud-Trace-Context": {cloud}},
+			wantTraceID: cloudTraceID,
+		},
+		{
+			name:    "both invalid",
+			headers: http.Header{"Traceparent": {"garbage"}, "X-Cloud-Trace-Context": {"garbage"}},
+		},
+		{
+			name:           "tracestate joined",
+			headers:        http.Header{"Traceparent": {traceparent}, "Tracestate": {"a=1", "b=2"}},
+			wantTraceID:    testTraceID,
+			wantTraceState: "a=1,b=2",
+		},
+		{
+			name:        "oversized tracestate dropped",
+			headers:     http.Header{"Traceparent": {traceparent}, "Tracestate": {"a=" + strings.Repeat("x", maxTracestateLen)}},
+			wantTraceID: testTraceID,
+		},
+		{
+			name:        "tracestate ignored with x-cloud-trace-context",
+			headers:     http.Header{"X-Cloud-Trace-Context": {cloud}, "Tracestate": {"a=1"}},
+			wantTraceID: cloudTraceID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := Extract(tt.headers)
+			if tt.wantTraceID == "" {
+				if sc.IsValid() {
+					t.Fatalf("Extract() = %+v, want an invalid span context", sc)
+				}
+				return
+			}
+			if sc.TraceID.String() != tt.wantTraceID || !sc.Remote || !sc.Sampled {
+				t.Fatalf("Extract() = %+v, want the sampled remote trace %s", sc, tt.wantTraceID)
+			}
+			if sc.TraceState != tt.wantTraceState {
+				t.Fatalf("TraceState = %q, want %q", sc.TraceState, tt.wantTraceState)
+			}
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	header := http.Header{"Tracestate": {"stale=1"}}
+	Inject(context.Background(), header)
+	if got := header.Get(HeaderTracestate); got != "stale=1" {
+		t.Fatalf("Inject() without span changed the header: %v", header)
+	}
+
+	sc := mustSpanContext(t, "00-"+testTraceID+"-"+testSpanID+"-01")
+	ctx, span := NewTracer().StartSpan(ContextWithRemoteSpanContext(context.Background(), sc), "call")
+	Inject(ctx, header)
+	if _, ok := header[HeaderTracestate]; ok {
+		t.Errorf("stale tracestate kept: %v", header)
+	}
+	for name, extract := range map[string]func(string) (SpanContext, error){
+		HeaderTraceparent:       ParseTraceparent,
+		"X-Cloud-Trace-Context": ParseCloudTraceContext,
+	} {
+		got, err := extract(header.Get(name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.TraceID != sc.TraceID || got.SpanID != span.SpanContext().SpanID || !got.Sampled {
+			t.Errorf("%s = %+v, want the trace %s and the span %s", name, got, sc.TraceID, span.SpanContext().SpanID)
+		}
+	}
+}
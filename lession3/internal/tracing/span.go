@@ -0,0 +1,323 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceID identifies a trace, 16 bytes written as 32 lowercase hex digits.
+type TraceID [16]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID identifies a span within its trace, 8 bytes written as 16 lowercase hex digits.
+type SpanID [8]byte
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is what a span passes on to its children, in the process or through the headers.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	// TraceState is the W3C tracestate, carried as is
+	TraceState string
+	// Remote is true when the span context was received from another service
+	Remote bool
+}
+
+// IsValid tells whether sc has a trace ID, a span ID may be missing, eg. in x-cloud-trace-context.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid()
+}
+
+// SpanKind tells the role of a span in a call between services.
+type SpanKind string
+
+const (
+	SpanKindInternal SpanKind = "internal"
+	SpanKindServer   SpanKind = "server"
+	SpanKindClient   SpanKind = "client"
+)
+
+// StatusCode of a span, unset until SetStatus is called.
+type StatusCode string
+
+const (
+	StatusUnset StatusCode = "unset"
+	StatusOK    StatusCode = "ok"
+	StatusError StatusCode = "error"
+)
+
+// Status of a span.
+type Status struct {
+	Code    StatusCode `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+// SpanData is the snapshot of an ended span handed to the exporters.
+type SpanData struct {
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	RemoteParent bool                   `json:"remote_parent,omitempty"`
+	TraceState   string                 `json:"trace_state,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         SpanKind               `json:"kind"`
+	StartTime    time.Time              `json:"start_time"`
+	EndTime      time.Time              `json:"end_time"`
+	Duration     time.Duration          `json:"duration"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Status       Status                 `json:"status"`
+}
+
+// Span is a timed operation of a trace. Only sampled spans record their attributes and status
+// and reach the exporters; the others are there to pass their SpanContext on.
+type Span struct {
+	tracer *Tracer
+	name   string
+	kind   SpanKind
+	sc     SpanContext
+	parent SpanContext
+	start  time.Time
+
+	mu         sync.Mutex
+	attributes map[string]interface{}
+	status     Status
+	ended      bool
+}
+
+type SpanOption func(s *Span)
+
+// Kind sets the kind of the span, default SpanKindInternal.
+func Kind(kind SpanKind) SpanOption {
+	return func(s *Span) {
+		s.kind = kind
+	}
+}
+
+// Attribute sets an attribute from the start of the span.
+func Attribute(key string, value interface{}) SpanOption {
+	return func(s *Span) {
+		s.attributes[key] = value
+	}
+}
+
+type spanKey struct{}
+
+// StartSpan starts a span named name with the default tracer, see Tracer.StartSpan.
+func StartSpan(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	return DefaultTracer().StartSpan(ctx, name, opts...)
+}
+
+// SpanFromContext returns the span of ctx, nil without one.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns the span context of ctx, either of its span or received
+// through ContextWithRemoteSpanContext.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	return SpanContext{}
+}
+
+// ContextWithRemoteSpanContext makes sc, extracted from the headers of a request, the parent
+// of the next span started from the returned context.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return context.WithValue(ctx, spanKey{}, &Span{sc: sc, ended: true})
+}
+
+func (s *Span) SpanContext() SpanContext {
+	return s.sc
+}
+
+// IsRecording tells whether the span is sampled and not ended yet.
+func (s *Span) IsRecording() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sc.Sampled && !s.ended
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sc.Sampled && !s.ended {
+		s.attributes[key] = value
+	}
+}
+
+func (s *Span) SetStatus(code StatusCode, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sc.Sampled && !s.ended {
+		s.status = Status{Code: code, Message: message}
+	}
+}
+
+// RecordError sets the status to StatusError with the message of err.
+func (s *Span) RecordError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// End hands a sampled span to the exporters of its tracer, only the first call counts.
+func (s *Span) End() {
+	end := time.Now()
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	if !s.sc.Sampled {
+		s.mu.Unlock()
+		return
+	}
+	data := SpanData{
+		TraceID:    s.sc.TraceID.String(),
+		SpanID:     s.sc.SpanID.String(),
+		TraceState: s.sc.TraceState,
+		Name:       s.name,
+		Kind:       s.kind,
+		StartTime:  s.start,
+		EndTime:    end,
+		Duration:   end.Sub(s.start),
+		Attributes: s.attributes,
+		Status:     s.status,
+	}
+	if s.parent.SpanID.IsValid() {
+		data.ParentSpanID, data.RemoteParent = s.parent.SpanID.String(), s.parent.Remote
+	}
+	s.mu.Unlock()
+	s.tracer.export(data)
+}
+
+type TracerOption func(t *Tracer)
+
+// SampleRatio is the share of the new traces sampled, in [0, 1], default 1. The decision is
+// taken once at the root from the trace ID, children and remote parents keep their sampled flag.
+func SampleRatio(ratio float64) TracerOption {
+	return func(t *Tracer) {
+		t.ratio = ratio
+	}
+}
+
+// Exporters receive the sampled spans once ended.
+func Exporters(exporters ...Exporter) TracerOption {
+	return func(t *Tracer) {
+		t.exporters = append(t.exporters, exporters...)
+	}
+}
+
+// Tracer starts spans, samples the new traces and exports the ended spans.
+type Tracer struct {
+	ratio     float64
+	exporters []Exporter
+}
+
+func NewTracer(opts ...TracerOption) *Tracer {
+	t := &Tracer{ratio: 1}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+var defaultTracer atomic.Value
+
+func init() {
+	defaultTracer.Store(NewTracer())
+}
+
+// DefaultTracer is used by StartSpan, it samples every trace and exports nothing until SetDefaultTracer.
+func DefaultTracer() *Tracer {
+	return defaultTracer.Load().(*Tracer)
+}
+
+func SetDefaultTracer(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// StartSpan starts a span named name, child of the span or remote span context of ctx,
+// and returns ctx carrying it. Without a parent the span starts a new trace.
+func (t *Tracer) StartSpan(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+	s := &Span{
+		tracer:     t,
+		name:       name,
+		kind:       SpanKindInternal,
+		parent:     parent,
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+		status:     Status{Code: StatusUnset},
+	}
+	if parent.IsValid() {
+		s.sc = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled, TraceState: parent.TraceState}
+	} else {
+		s.sc.TraceID = newTraceID()
+		s.sc.Sampled = t.sample(s.sc.TraceID)
+	}
+	s.sc.SpanID = newSpanID()
+	for _, opt := range opts {
+		opt(s)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// sample keeps the traces whose ID falls under ratio, so that every service sampling at
+// the same ratio keeps the same traces.
+func (t *Tracer) sample(id TraceID) bool {
+	switch {
+	case t.ratio >= 1:
+		return true
+	case t.ratio <= 0:
+		return false
+	}
+	// the low 8 bytes, random in both W3C and uuid-like trace IDs
+	return binary.BigEndian.Uint64(id[8:])>>1 < uint64(t.ratio*(1<<63))
+}
+
+func (t *Tracer) export(data SpanData) {
+	for _, e := range t.exporters {
+		e.ExportSpan(data)
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func newTestTracer(opts ...TracerOption) (*Tracer, *InMemoryExporter) {
+	exporter := NewInMemoryExporter()
+	return NewTracer(append(opts, Exporters(exporter))...), exporter
+}
+
+func TestStartSpanParents(t *testing.T) {
+	tracer, exporter := newTestTracer()
+	remote := mustSpanContext(t, "00-"+testTraceID+"-"+testSpanID+"-01")
+	remote.TraceState = "a=1"
+
+	ctx, server := tracer.StartSpan(ContextWithRemoteSpanContext(context.Background(), remote), "server", Kind(SpanKindServer))
+	_, child := tracer.StartSpan(ctx, "child")
+	child.End()
+	server.End()
+	_, root := tracer.StartSpan(context.Background(), "root")
+	root.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(spans))
+	}
+	childData, serverData, rootData := spans[0], spans[1], spans[2]
+
+	if serverData.TraceID != testTraceID || serverData.ParentSpanID != testSpanID || !serverData.RemoteParent {
+		t.Errorf("server span = %+v, want the remote span %s of trace %s as parent", serverData, testSpanID, testTraceID)
+	}
+	if serverData.SpanID == testSpanID || serverData.Kind != SpanKindServer || serverData.TraceState != "a=1" {
+		t.Errorf("server span = %+v, want its own span id, kind server and the tracestate", serverData)
+	}
+	if childData.TraceID != testTraceID || childData.ParentSpanID != serverData.SpanID || childData.RemoteParent {
+		t.Errorf("child span = %+v, want the local parent %s", childData, serverData.SpanID)
+	}
+	if childData.SpanID == serverData.SpanID || childData.Kind != SpanKindInternal {
+		t.Errorf("child span = %+v, want its own span id and kind internal", childData)
+	}
+	if rootData.TraceID == testTraceID || rootData.ParentSpanID != "" {
+		t.Errorf("root span = %+v, want a new trace without parent", rootData)
+	}
+}
+
+func TestStartSpanCloudParentWithoutSpanID(t *testing.T) {
+	tracer, exporter := newTestTracer()
+	remote, err := ParseCloudTraceContext(testTraceID + ";o=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tracer.StartSpan(ContextWithRemoteSpanContext(context.Background(), remote), "server")
+	span.End()
+	data := exporter.Spans()[0]
+	if data.TraceID != testTraceID || data.ParentSpanID != "" {
+		t.Fatalf("span = %+v, want trace %s without parent span", data, testTraceID)
+	}
+}
+
+func TestStartSpanSampling(t *testing.T) {
+	sampled := mustSpanContext(t, "00-"+testTraceID+"-"+testSpanID+"-01")
+	notSampled := mustSpanContext(t, "00-"+testTraceID+"-"+testSpanID+"-00")
+	tests := []struct {
+		name        string
+		ratio       float64
+		parent      *SpanContext
+		wantSampled bool
+	}{
+		{name: "root always", ratio: 1, wantSampled: true},
+		{name: "root never", ratio: 0},
+		{name: "sampled parent kept", ratio: 0, parent: &sampled, wantSampled: true},
+		{name: "unsampled parent kept", ratio: 1, parent: &notSampled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer, exporter := newTestTracer(SampleRatio(tt.ratio))
+			ctx := context.Background()
+			if tt.parent != nil {
+				ctx = ContextWithRemoteSpanContext(ctx, *tt.parent)
+			}
+			ctx, span := tracer.StartSpan(ctx, "span")
+			_, child := tracer.StartSpan(ctx, "child")
+			if span.IsRecording() != tt.wantSampled || child.SpanContext().Sampled != tt.wantSampled {
+				t.Fatalf("recording %v, child sampled %v, want %v", span.IsRecording(), child.SpanContext().Sampled, tt.wantSampled)
+			}
+			child.End()
+			span.End()
+			if got := len(exporter.Spans()); got != map[bool]int{true: 2, false: 0}[tt.wantSampled] {
+				t.Fatalf("exported %d spans, sampled %v", got, tt.wantSampled)
+			}
+		})
+	}
+}
+
+func TestTracerSampleDeterministic(t *testing.T) {
+	half := NewTracer(SampleRatio(0.5))
+	other := NewTracer(SampleRatio(0.5))
+	var low, high TraceID
+	binary.BigEndian.PutUint64(high[8:], ^uint64(0))
+	if !half.sample(low) || half.sample(high) {
+		t.Fatalf("sample(low) = %v, sample(high) = %v, want the IDs under the ratio kept", half.sample(low), half.sample(high))
+	}
+
+	kept := 0
+	const n = 10000
+	for i := 0; i < n; i++ {
+		id := newTraceID()
+		decision := half.sample(id)
+		if decision != other.sample(id) || decision != half.sample(id) {
+			t.Fatalf("sample(%s) differs between calls or tracers", id)
+		}
+		if decision {
+			kept++
+		}
+	}
+	if kept < n*45/100 || kept > n*55/100 {
+		t.Errorf("kept %d of %d traces at ratio 0.5", kept, n)
+	}
+}
+
+func TestSpanEnd(t *testing.T) {
+	tracer, exporter := newTestTracer()
+	_, span := tracer.StartSpan(context.Background(), "span", Attribute("a", 1))
+	span.SetAttribute("b", "2")
+	span.RecordError(errors.New("boom"))
+	span.End()
+	span.End()
+	span.SetAttribute("late", true)
+	span.SetStatus(StatusOK, "")
+
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans, want the first End only", len(spans))
+	}
+	data := spans[0]
+	if len(data.Attributes) != 2 || data.Attributes["a"] != 1 || data.Attributes["b"] != "2" {
+		t.Errorf("attributes = %v, want a and b", data.Attributes)
+	}
+	if data.Status != (Status{Code: StatusError, Message: "boom"}) {
+		t.Errorf("status = %+v, want the recorded error", data.Status)
+	}
+	if span.IsRecording() {
+		t.Error("ended span still recording")
+	}
+}
@@ -11,8 +11,9 @@ nameFlag="-X github.com/AfterShip/golang-common/whoami.name=CRMProcessor" \
 && buildNumberFlag="-X github.com/AfterShip/golang-common/whoami.buildNumber="${buildNumber}"" \
 && buildAtFlag="-X github.com/AfterShip/golang-common/whoami.buildAt="`date '+%Y-%m-%dT%H:%M:%S%z'`"" \
 && buildOnFlag="-X github.com/AfterShip/golang-common/whoami.buildOn="`hostname`"" \
-&& gitCommitFlag="-X github.com/AfterShip/golang-common/whoami.gitCommit="`git rev-parse HEAD`@`git name-rev --name-only HEAD`"" \
-&& ldflags="${nameFlag} ${versionFlag} ${buildNumberFlag} ${buildAtFlag} ${buildOnFlag} ${gitCommitFlag}" \
+&& commitHashFlag="-X github.com/AfterShip/golang-common/whoami.commitHash="`git rev-parse HEAD`"" \
+&& commitBranchFlag="-X github.com/AfterShip/golang-common/whoami.commitBranch="`git name-rev --name-only HEAD`"" \
+&& ldflags="${nameFlag} ${versionFlag} ${buildNumberFlag} ${buildAtFlag} ${buildOnFlag} ${commitHashFlag} ${commitBranchFlag}" \
 && go build  -ldflags "${ldflags}" -mod=vendor ./cmd/web
 
 #can build manual in pod